@@ -14,20 +14,40 @@ var (
 	ErrTypedefAlreadyDefined = errors.New("typedef already defined")
 	ErrStructAlreadyDefined  = errors.New("struct already defined")
 	ErrFuncDifferentType     = errors.New("function redefined with different type")
+	ErrFuncRedefined         = errors.New("function already defined")
 	ErrFuncDeclInvalid       = errors.New("invalid function declaration")
+	ErrStructTooManyFields   = errors.New("too many struct fields")
+	ErrFuncTooManyParams     = errors.New("too many function parameters")
 )
 
-type ternaryCheck struct {
-	n    node.Node
-	seen int
+// Limits contains the configurable maximums for declarations.
+type Limits struct {
+	StructFields int
+	FuncParams   int
+	// LargeStruct is the struct size in bytes above which we warn. Zero
+	// disables the warning.
+	LargeStruct int
+}
+
+// DefaultLimits are generous enough not to bother any sensible program.
+var DefaultLimits = Limits{
+	StructFields: 64,
+	FuncParams:   64,
+	LargeStruct:  4096,
 }
 
 // Analyzer maintains the state when we check our forest of ASTs. This state
 // means mainly information about user-defined types (structs, typedefs) and
 // type-checking (what is some node's type).
 type Analyzer struct {
-	fn   string
-	errs []error
+	fn     string
+	errs   []error
+	warns  []error
+	limits Limits
+	// diags contains both errors and warnings in the order they were found
+	diags []Diagnostic
+	// dialect tells which words may not name variables
+	dialect *Dialect
 
 	// res will contain everything that it's meant to be passed onwards after
 	// the analysis stage.
@@ -40,17 +60,32 @@ type Analyzer struct {
 	scope *scope
 	// curfunc stores the type of the function we're currently analyzing
 	curfunc *types.Function
+	// funcname is the name of the function definition we are in for
+	// reporting errors, also while checking its return type and parameters
+	funcname string
 
 	// loops is a LIFO of loops used to connect "break" and "continue"
 	loops []node.Loop
-	// canassign keeps track of valid lvalues
-	canassign map[node.NodeId]struct{}
-	// ternaryvals is used to match pairs of "?" and ":"
-	ternaryvals map[node.NodeId]*ternaryCheck
 	// structaccess is used to propagate struct information for "." and "->"
 	structaccess map[node.NodeId]*types.Struct
+	// fundefs contains the function definitions met so far
+	fundefs map[string]*node.FunDef
 	// returns tracks how many valid return statements each function has
 	returns map[*types.Function]int
+	// nullness contains the variables currently known to be NULL or non-null
+	nullness nullState
+	// structrefs contains the names of the structs types have referred to
+	structrefs map[string]struct{}
+	// structdefs are the struct definitions not yet seen referred to, see
+	// lintUnusedStructs
+	structdefs []*node.Struct
+	// defining is the struct whose members we are typing, so it does not
+	// count as a reference to itself
+	defining string
+	// labels and gotos are collected for each function to make sure every
+	// goto has a target
+	labels map[string]*node.Label
+	gotos  []*node.Goto
 }
 
 func (s *Analyzer) Results() *Results {
@@ -59,6 +94,8 @@ func (s *Analyzer) Results() *Results {
 
 func (s *Analyzer) reset() {
 	s.errs = []error{}
+	s.warns = []error{}
+	s.diags = nil
 	s.scope = newScope(nil, nil)
 	s.res = &Results{
 		Functions:    Functions{},
@@ -67,29 +104,44 @@ func (s *Analyzer) reset() {
 		Structs:      Structs{},
 		StructFwds:   StructFwds{},
 		NodeTypes:    NodeTypes{},
+		NonNull:      NonNull{},
+		Sizes:        Sizes{},
+		LValues:      LValues{},
 	}
-	s.canassign = map[node.NodeId]struct{}{}
-	s.ternaryvals = map[node.NodeId]*ternaryCheck{}
 	s.structaccess = map[node.NodeId]*types.Struct{}
 	s.returns = map[*types.Function]int{}
+	s.fundefs = map[string]*node.FunDef{}
+	s.structrefs = map[string]struct{}{}
+	s.structdefs = nil
+	s.nullness = nullState{}
 }
 
 func New(fn string) *Analyzer {
-	ret := &Analyzer{fn: fn}
+	ret := &Analyzer{fn: fn, limits: DefaultLimits, dialect: defaultdialect}
 	ret.reset()
 	return ret
 }
 
+// SetLimits replaces the declaration maximums used during analysis.
+func (s *Analyzer) SetLimits(limits Limits) {
+	s.limits = limits
+}
+
+// SetDialect replaces the reserved words of plain C0. It should match the one
+// given to the parser.
+func (s *Analyzer) SetDialect(d *Dialect) {
+	s.dialect = d
+}
+
 func (s *Analyzer) setAssignable(n node.Node) {
-	if _, ok := s.canassign[n.Id()]; ok {
+	if _, ok := s.res.LValues[n.Id()]; ok {
 		panic(fmt.Sprintf("node %s is assigning too hard", n))
 	}
-	s.canassign[n.Id()] = struct{}{}
+	s.res.LValues[n.Id()] = struct{}{}
 }
 
 func (s *Analyzer) isAssignable(n node.Node) bool {
-	_, ok := s.canassign[n.Id()]
-	return ok
+	return s.res.IsLValue(n)
 }
 
 func (s *Analyzer) setStructAccess(n node.Node, st *types.Struct) {
@@ -166,11 +218,18 @@ func (s *Analyzer) addStruct(n *node.Struct) error {
 	if _, ok := s.res.Structs[n.Name]; ok {
 		return fmt.Errorf("%w: %q", ErrStructAlreadyDefined, n.Name)
 	}
+	if len(n.Members) > s.limits.StructFields {
+		return fmt.Errorf("%w: %q has %d, maximum is %d",
+			ErrStructTooManyFields, n.Name, len(n.Members), s.limits.StructFields)
+	}
+	s.defining = n.Name
 	st, err := s.StructFromNode(n)
+	s.defining = ""
 	if err != nil {
 		return err
 	}
 	s.res.Structs[n.Name] = st
+	s.structdefs = append(s.structdefs, n)
 	return nil
 }
 
@@ -186,24 +245,52 @@ func (s *Analyzer) getStructFwd(name string) *types.StructForward {
 	return s.res.StructFwds[name]
 }
 
-func (p *Analyzer) errorf(n node.Node, format string, a ...interface{}) error {
+// diagnose records a diagnostic about n. See errorf and warnf.
+func (p *Analyzer) diagnose(sev Severity, n node.Node, format string, a ...interface{}) *SyntaxError {
 	err := &SyntaxError{
 		Node:    n,
 		Fn:      p.fn,
+		Func:    p.funcname,
 		Wrapped: fmt.Errorf(format, a...),
 	}
+	p.diags = append(p.diags, Diagnostic{Severity: sev, Err: err})
+	return err
+}
+
+func (p *Analyzer) errorf(n node.Node, format string, a ...interface{}) error {
+	err := p.diagnose(SEVERITY_ERROR, n, format, a...)
 	p.errs = append(p.errs, err)
 	return err
 }
 
+// Diagnostics returns the errors and warnings found during analysis in the
+// order they were found.
+func (s *Analyzer) Diagnostics() []Diagnostic {
+	return s.diags
+}
+
 // Analyze finds syntax errors and does type-checking. It uses depth-first
 // traversal of the syntax tree defined by the given root node.
 func (s *Analyzer) Analyze(nodes []node.Node) (errs []error) {
+	s.checkAll(nodes)
+	s.lintUnusedStructs()
+	return s.errs
+}
+
+// AnalyzeMore analyzes more nodes in the context of what has been analyzed
+// before, so eg. functions and typedefs declared earlier may be used. Only the
+// errors found in the given nodes are returned. Unused structs are not warned
+// about, as more nodes referring to them may still follow.
+func (s *Analyzer) AnalyzeMore(nodes []node.Node) []error {
+	before := len(s.errs)
+	s.checkAll(nodes)
+	return s.errs[before:]
+}
+
+func (s *Analyzer) checkAll(nodes []node.Node) {
 	for _, node := range nodes {
 		s.check(node)
-		s.checkTernaries()
 	}
-	return s.errs
 }
 
 func (s *Analyzer) withScope(n node.Node, what func()) {
@@ -220,7 +307,11 @@ func (s *Analyzer) withFunction(f *node.FunDef, what func()) {
 		s.errorf(f, "%w: %q", ErrFuncDeclInvalid, f.Name)
 		return
 	}
+	s.nullness = nullState{}
+	s.labels = map[string]*node.Label{}
+	s.gotos = nil
 	what()
+	s.checkGotos()
 	s.curfunc = nil
 }
 
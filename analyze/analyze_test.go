@@ -2,15 +2,18 @@ package analyze_test
 
 import (
 	"errors"
+	"strings"
 	"testing"
 
 	"github.com/susji/c0/analyze"
 	"github.com/susji/c0/lex"
 	"github.com/susji/c0/node"
 	"github.com/susji/c0/parse"
+	"github.com/susji/c0/span"
 
 	"github.com/susji/c0/testers/assert"
 	"github.com/susji/c0/testers/require"
+	"github.com/susji/c0/types"
 )
 
 func nodes(t *testing.T, code string) ([]node.Node, *analyze.Analyzer) {
@@ -61,10 +64,18 @@ func TestTernary(t *testing.T) {
 	}
 
 	table := []entry{
-		{"void a() { true ? 1; }", analyze.ErrTernaryMissingValue},
-		{"void b() { 1 : 0; }", analyze.ErrTernaryMissingCond},
 		{"void c() { true ? 1 : 0; }", nil},
 		{`void d() { "jep" ? 1 : 0; }`, analyze.ErrTernaryCondBool},
+		{`void e() { true ? 1 : 'a'; }`, analyze.ErrTernaryValueTypes},
+		{`void f() { int* p = alloc(int); int* q = true ? p : NULL; }`, nil},
+		{`void f() { int a = true ? 1 : 2; }`, nil},
+		{`void f() { int a = true ? 1 : false; }`, analyze.ErrTernaryValueTypes},
+		{`void f() { int* p = alloc(int); int* q = false ? NULL : p; }`, nil},
+		{`void f() { int* p = alloc(int); int q = false ? NULL : p; }`, analyze.ErrAssignTypeMismatch},
+		{`void f() { int* p = alloc(int); bool* q = true ? p : NULL; }`, analyze.ErrAssignTypeMismatch},
+		{`void g(int a) { int b = a > 0 ? a : a < 0 ? -a : 0; }`, nil},
+		{`void h(int a) { bool b = a > 0 ? a : true; }`, analyze.ErrTernaryValueTypes},
+		{`void i(int a) { int b = a ? 1 : 2; }`, analyze.ErrTernaryCondBool},
 	}
 
 	for _, cur := range table {
@@ -83,6 +94,58 @@ func TestTernary(t *testing.T) {
 	}
 }
 
+func TestCanonical(t *testing.T) {
+	n, s := nodes(t, "typedef int* ip; void f() { ip x = NULL; x; }")
+	require.Equal(t, 0, len(s.Analyze(n)))
+	res := s.Results()
+	var x *types.Type
+	node.Walk(n[1], func(n node.Node, _ int) bool {
+		if v, ok := n.(*node.Variable); ok && v.Value == "x" {
+			x = res.NodeTypes[v.Id()]
+		}
+		return true
+	})
+	require.NotNil(t, x)
+	intptr := types.NewType(types.TYPE_INT, 1, 0)
+	assert.True(t, s.Canonical(x).Matches(intptr))
+
+	// A type retaining the typedef layer resolves with accumulated levels.
+	ip := res.Typedefs["ip"]
+	require.NotNil(t, ip)
+	wrapped := types.NewTypeExtra(types.TYPE_INT, 1, 2, ip)
+	assert.True(t, s.Canonical(wrapped).Matches(types.NewType(types.TYPE_INT, 2, 2)))
+	assert.Nil(t, s.Canonical(nil))
+}
+
+func TestTernaryFuncallArgs(t *testing.T) {
+	type entry struct {
+		code    string
+		wanterr error
+	}
+
+	table := []entry{
+		{`int f(int a, int b) { return a + b; }
+void g(bool c, bool d) { f(c ? 1 : 2, d ? 3 : 4); }`, nil},
+		{`int f(int a, int b) { return a + b; }
+void g(bool c, bool d) { f(c ? 1 : 2, d ? true : false); }`, analyze.ErrFuncallArgType},
+	}
+
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			n, s := nodes(t, cur.code)
+			require.Equal(t, 2, len(n))
+			errs := s.Analyze(n)
+			t.Log(errs)
+			if cur.wanterr == nil {
+				assert.Equal(t, 0, len(errs))
+			} else {
+				require.Equal(t, 1, len(errs))
+				assert.True(t, errors.Is(errs[0], cur.wanterr))
+			}
+		})
+	}
+}
+
 func TestTypedef(t *testing.T) {
 	type entry struct {
 		code     string
@@ -232,6 +295,54 @@ bool f() {
 `,
 			wanterrs: []error{},
 		},
+		{
+			code: `
+typedef int cmp(int a, int b);
+int f(int a, int b) { return a - b; }
+int g(int a, int b) {
+	cmp*[] h = alloc_array(cmp*, 2);
+	h[0] = &f;
+	h[1] = h[0];
+	return (*h[0])(a, b) + (*h[1])(b, a);
+}
+`,
+			wanterrs: []error{},
+		},
+		{
+			code: `
+typedef int cmp(int a, int b);
+int f(int a, int b) { return a - b; }
+int g(int a, int b) {
+	cmp*[] h;
+	h[0] = &f;
+	return (*h[0])(a, true);
+}
+`,
+			wanterrs: []error{analyze.ErrFuncallArgType},
+		},
+		{
+			// Function pointers have to be explicitly dereferenced.
+			code: `
+typedef int cmp(int a, int b);
+int f(int a, int b) { return a - b; }
+int g(int a, int b) {
+	cmp*[] h;
+	h[0] = &f;
+	return h[0](a, b);
+}
+`,
+			wanterrs: []error{analyze.ErrFuncallWrongPtrType},
+		},
+		{
+			code: `
+typedef int cmp(int a, int b);
+int g(int a, int b) {
+	cmp** h;
+	return (*h)(a, b);
+}
+`,
+			wanterrs: []error{analyze.ErrFuncallWrongPtrType},
+		},
 	}
 
 	for _, cur := range table {
@@ -309,6 +420,324 @@ func TestLValues(t *testing.T) {
 	}
 }
 
+func TestChainedAssign(t *testing.T) {
+	type entry struct {
+		code     string
+		wanterrs []error
+	}
+
+	table := []entry{
+		{
+			code:     "void f(int a, int b) { a = b = 1; }",
+			wanterrs: nil,
+		},
+		{
+			code:     "void f(int a, int b, int c) { a += b -= c *= 2; }",
+			wanterrs: nil,
+		},
+		{
+			code:     "void f(int b) { int a = b = 1; }",
+			wanterrs: nil,
+		},
+		{
+			code:     "void f(int a) { a = 1 = 2; }",
+			wanterrs: []error{analyze.ErrAssignNotLValue},
+		},
+		{
+			code:     "void f(int a, int b) { a = b + 1 = 2; }",
+			wanterrs: []error{analyze.ErrAssignNotLValue},
+		},
+		{
+			code:     "void f(int a, bool b) { a = b = true; }",
+			wanterrs: []error{analyze.ErrAssignTypeMismatch},
+		},
+		{
+			code:     "void f(int a, bool b) { b = a = 1; }",
+			wanterrs: []error{analyze.ErrAssignTypeMismatch},
+		},
+	}
+
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			n, s := nodes(t, cur.code)
+			goterrs := s.Analyze(n)
+			t.Log(goterrs)
+			require.Equal(t, len(cur.wanterrs), len(goterrs))
+			for i, curerr := range cur.wanterrs {
+				assert.True(t, errors.Is(goterrs[i], curerr))
+			}
+		})
+	}
+}
+
+func TestChainedAssignTypes(t *testing.T) {
+	n, s := nodes(t, "void f(int a, int b) { a = b = 1; }")
+	require.Equal(t, 0, len(s.Analyze(n)))
+	res := s.Results()
+	assigns := 0
+	node.Walk(n[0], func(n node.Node, _ int) bool {
+		if oa, ok := n.(*node.OpAssign); ok {
+			assigns++
+			k := res.NodeTypes[oa.Id()]
+			require.NotNil(t, k)
+			assert.True(t, k.Matches(types.NewType(types.TYPE_INT, 0, 0)))
+		}
+		return true
+	})
+	assert.Equal(t, 2, assigns)
+}
+
+func TestMultipleDeclarators(t *testing.T) {
+	type entry struct {
+		code     string
+		wanterrs []error
+	}
+
+	table := []entry{
+		{
+			code:     "int f() { int a, b = 2, c; a = c = b; return a; }",
+			wanterrs: nil,
+		},
+		{
+			code:     "int f() { int a = 1, b = a + 1; return b; }",
+			wanterrs: nil,
+		},
+		{
+			code:     "void f() { int* p = NULL, q = alloc(int); }",
+			wanterrs: nil,
+		},
+		{
+			code:     "void f() { int a, a; }",
+			wanterrs: []error{analyze.ErrVarAlreadyDefined},
+		},
+		{
+			code:     "void f(int b) { int a, b; }",
+			wanterrs: []error{analyze.ErrVarAlreadyDefined},
+		},
+		{
+			code:     "void f() { int a, b = true; }",
+			wanterrs: []error{analyze.ErrAssignTypeMismatch},
+		},
+		{
+			code:     "void f() { for (int i = 0, n = 10; i < n; i++) {} }",
+			wanterrs: nil,
+		},
+		{
+			code:     "void f() { for (int i = 0, n = 10; i < n; i++) {} n; }",
+			wanterrs: []error{analyze.ErrVarNotDefined},
+		},
+	}
+
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			n, s := nodes(t, cur.code)
+			goterrs := s.Analyze(n)
+			t.Log(goterrs)
+			if len(cur.wanterrs) == 0 {
+				assert.Equal(t, 0, len(goterrs))
+				return
+			}
+			require.True(t, len(goterrs) > 0)
+			assert.True(t, errors.Is(goterrs[0], cur.wanterrs[0]))
+		})
+	}
+}
+
+func TestSizeOf(t *testing.T) {
+	type entry struct {
+		code    string
+		want    int32
+		wanterr error
+	}
+
+	structs := `
+struct s { int a; char b; };
+struct t { char c; struct s x; bool b; };
+struct fwd;
+`
+	table := []entry{
+		{"int f() { return sizeof(int); }", 4, nil},
+		{"int f() { return sizeof(bool); }", 1, nil},
+		{"int f() { return sizeof(char); }", 1, nil},
+		{"int f() { return sizeof(string); }", 8, nil},
+		{"int f() { return sizeof(int[]); }", 8, nil},
+		{"int f() { return sizeof(void*); }", 8, nil},
+		{"int f() { return sizeof(struct s); }", 8, nil},
+		{"int f() { return sizeof(struct t); }", 16, nil},
+		{"int f() { return sizeof(struct fwd*); }", 8, nil},
+		{"int f() { return sizeof(void); }", 0, analyze.ErrSizeOfVoid},
+		{"int f() { return sizeof(struct fwd); }", 0, analyze.ErrSizeOfUnknown},
+		{"int f() { return sizeof(struct nope); }", 0, analyze.ErrTypeUnrecognizedStruct},
+		{"bool f() { return sizeof(int); }", 0, analyze.ErrReturnMistyped},
+	}
+
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			n, s := nodes(t, structs+cur.code)
+			errs := s.Analyze(n)
+			t.Log(errs)
+			if cur.wanterr != nil {
+				require.True(t, len(errs) > 0)
+				assert.True(t, errors.Is(errs[0], cur.wanterr))
+				return
+			}
+			require.Equal(t, 0, len(errs))
+			var so *node.SizeOf
+			node.Walk(n[len(n)-1], func(n node.Node, _ int) bool {
+				if t, ok := n.(*node.SizeOf); ok {
+					so = t
+				}
+				return true
+			})
+			require.NotNil(t, so)
+			num, ok := s.Results().FoldSizeOf(so)
+			require.True(t, ok)
+			assert.Equal(t, cur.want, num.Value)
+		})
+	}
+}
+
+func TestArrayAllocMismatchMessage(t *testing.T) {
+	type entry struct {
+		code string
+		want string
+	}
+
+	table := []entry{
+		{`void f() { int[][] a = alloc_array(int, 1); }`,
+			"expected int[][], got int[]: 1 array dimensions instead of 2"},
+		{`void f() { int[] a = alloc_array(int[], 1); }`,
+			"expected int[], got int[][]: 2 array dimensions instead of 1"},
+		{`void f() { string[] a = alloc_array(int, 1); }`,
+			"expected string[], got int[]: array elements are int instead of string"},
+		{`void f() { int a = alloc_array(int, 1); }`,
+			"expected int, got int[]: unexpected array"},
+		{`void f() { int[] a = alloc_array(int, 1); a = 1; }`,
+			"expected int[], got int: not an array"},
+	}
+
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			n, s := nodes(t, cur.code)
+			goterrs := s.Analyze(n)
+			t.Log(goterrs)
+			require.Equal(t, 1, len(goterrs))
+			assert.True(t, errors.Is(goterrs[0], analyze.ErrAssignTypeMismatch))
+			assert.True(t, strings.HasSuffix(goterrs[0].Error(), cur.want))
+		})
+	}
+}
+
+func TestArrayPointerMismatch(t *testing.T) {
+	type entry struct {
+		code    string
+		wanterr error
+	}
+
+	table := []entry{
+		{"void f() { int[] a; int* p = a; }", analyze.ErrArrayPointerMismatch},
+		{"void f() { int* p; int[] a = p; }", analyze.ErrArrayPointerMismatch},
+		{"void f() { int[] a; int* p; p = a; }", analyze.ErrArrayPointerMismatch},
+		{"void f() { int*[] a; int* p; a = p; }", analyze.ErrArrayPointerMismatch},
+		{"void f() { int[] a = NULL; }", analyze.ErrAssignTypeMismatch},
+		{"void f() { int[] a; int b = a; }", analyze.ErrAssignTypeMismatch},
+		{"void f() { int[] a; int[] b = a; }", nil},
+		{"void f() { int* p; int* q = p; }", nil},
+		{"void f() { int*[] a = alloc_array(int*, 1); int* p = a[0]; }", nil},
+	}
+
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			n, s := nodes(t, cur.code)
+			errs := s.Analyze(n)
+			t.Log(errs)
+			if cur.wanterr == nil {
+				assert.Equal(t, 0, len(errs))
+				return
+			}
+			require.Equal(t, 1, len(errs))
+			assert.True(t, errors.Is(errs[0], cur.wanterr))
+			assert.True(t, errors.Is(errs[0], analyze.ErrAssignTypeMismatch))
+			if cur.wanterr != analyze.ErrArrayPointerMismatch {
+				assert.False(t, errors.Is(errs[0], analyze.ErrArrayPointerMismatch))
+			}
+		})
+	}
+}
+
+func TestStructAssignByValue(t *testing.T) {
+	type entry struct {
+		code    string
+		wanterr error
+	}
+
+	const st = "struct s { int x; }; typedef struct s S; "
+	table := []entry{
+		{st + "void f() { struct s a; struct s b; a = b; }", analyze.ErrStructAssignByValue},
+		{st + "void f() { S a; S b; a = b; }", analyze.ErrStructAssignByValue},
+		{st + "void f(struct s* p, struct s* q) { *p = *q; }", analyze.ErrStructAssignByValue},
+		{st + "void f(struct s[] p, struct s[] q) { p[0] = q[1]; }", analyze.ErrStructAssignByValue},
+		{st + "struct t { struct s in; }; void f(struct t* p, struct t* q) { p->in = q->in; }",
+			analyze.ErrStructAssignByValue},
+		{st + "void f() { struct s a; struct s b; a.x = b.x; }", nil},
+		{st + "void f(struct s* p, struct s* q) { p->x = q->x; }", nil},
+		// Pointers and arrays of structs are references, so they may be
+		// assigned and compared like any other.
+		{st + "void f(struct s* p, struct s* q) { p = q; }", nil},
+		{st + "void f(struct s* p, struct s* q) { assert(p == q); }", nil},
+		{st + "void f(struct s[] p, struct s[] q) { p = q; }", nil},
+		// This is consistent with equality.
+		{st + "void f() { struct s a; struct s b; assert(a == b); }", analyze.ErrCompareBadType},
+	}
+
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			n, s := nodes(t, cur.code)
+			goterrs := s.Analyze(n)
+			t.Log(goterrs)
+			if cur.wanterr == nil {
+				assert.Equal(t, 0, len(goterrs))
+				return
+			}
+			require.True(t, len(goterrs) > 0)
+			assert.True(t, errors.Is(goterrs[0], cur.wanterr))
+		})
+	}
+}
+
+func TestChainedAssignLink(t *testing.T) {
+	type entry struct {
+		code string
+		// link is the target of the failing assignment, if any
+		link string
+	}
+
+	table := []entry{
+		{"void f() { int a; int b; a = b = 3; }", ""},
+		{"void f() { int a; bool b; a = b = true; }", "a"},
+		{"void f() { int a; int b; a = b = true; }", "b"},
+	}
+
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			n, s := nodes(t, cur.code)
+			goterrs := s.Analyze(n)
+			t.Log(goterrs)
+			if cur.link == "" {
+				assert.Equal(t, 0, len(goterrs))
+				return
+			}
+			require.Equal(t, 1, len(goterrs))
+			assert.True(t, errors.Is(goterrs[0], analyze.ErrAssignTypeMismatch))
+			var serr *analyze.SyntaxError
+			require.True(t, errors.As(goterrs[0], &serr))
+			oa, ok := serr.Node.(*node.OpAssign)
+			require.True(t, ok)
+			assert.Equal(t, cur.link, oa.To.(*node.Variable).Value)
+		})
+	}
+}
+
 func TestArrayAlloc(t *testing.T) {
 	type entry struct {
 		code    string
@@ -323,6 +752,12 @@ func TestArrayAlloc(t *testing.T) {
 		{`void f() { int a = alloc_array(int, 1); }`, analyze.ErrAssignTypeMismatch},
 		{`void f() { int[][] a = alloc_array(int, 1); }`, analyze.ErrAssignTypeMismatch},
 		{`void f() { string[] a = alloc_array(int, 1); }`, analyze.ErrAssignTypeMismatch},
+		{`void f() { alloc_array(void, 3); }`, analyze.ErrAllocVoid},
+		{`void f() { void*[] a = alloc_array(void*, 3); }`, nil},
+		{`void f() { int[] a = alloc_array(int, -1); }`, analyze.ErrAllocArrayNegative},
+		{`void f() { int[] a = alloc_array(int, 1 - 2 * 3); }`, analyze.ErrAllocArrayNegative},
+		{`void f(int n) { int[] a = alloc_array(int, -n); }`, nil},
+		{`void f() { int[] a = alloc_array(int, 0); }`, nil},
 		{`
 struct zap {
 	int[] ai;
@@ -380,6 +815,7 @@ func TestAlloc(t *testing.T) {
 		{`void h() { int **a = alloc(int*); }`, nil},
 		{`void g() { int **a = alloc(int); }`, analyze.ErrAssignTypeMismatch},
 		{`void g() { int *a = alloc(bool); }`, analyze.ErrAssignTypeMismatch},
+		{`void g() { alloc(void); }`, analyze.ErrAllocVoid},
 	}
 
 	for _, cur := range table {
@@ -447,6 +883,10 @@ func TestArraySub(t *testing.T) {
 		{`void f() { int[] a; int b; b = a["jep"]; }`, analyze.ErrArraySubNotInt},
 		{`void f() { int[] a; a[0] = 1; }`, nil},
 		{`void f() { int[] a; a[0][0] = 1; }`, analyze.ErrArraySubNotArray},
+		{`void f() { string s; s[0]; }`, analyze.ErrStringNotIndexable},
+		{`void f() { string s; char c = s[0]; }`, analyze.ErrStringNotIndexable},
+		{`void f() { string[] s; string t = s[0]; }`, nil},
+		{`void f() { string[] s; s[0][0]; }`, analyze.ErrStringNotIndexable},
 	}
 
 	for _, cur := range table {
@@ -650,6 +1090,24 @@ struct fwd * zapper(struct fwd *zap) {
 	return zap;
 }`,
 			analyze.ErrTypeUnrecognizedStruct},
+		{`
+struct fwd;
+struct fwd g();`,
+			analyze.ErrFuncReturnStructFwd},
+		{`
+struct fwd;
+struct fwd* g();`,
+			nil},
+		{`
+struct fwd;
+struct fwd[] g();`,
+			nil},
+		{`
+struct fwd;
+struct fwd g(struct fwd* p) {
+	return *p;
+}`,
+			analyze.ErrFuncReturnStructFwd},
 	}
 
 	for _, cur := range table {
@@ -721,7 +1179,7 @@ struct nester {
 	}
 }
 
-func TestLoop(t *testing.T) {
+func TestDoWhile(t *testing.T) {
 	type entry struct {
 		code    string
 		wanterr error
@@ -731,29 +1189,45 @@ func TestLoop(t *testing.T) {
 		{`
 int f() {
 	int i = 10;
-	while (i > 0) {
+	do {
 		i--;
-		break;
+		if (i == 5)
+			break;
 		continue;
-	}
-	return 0;
+	} while (i > 0);
+	return i;
 }
 `,
 			nil,
 		},
 		{`
 int f() {
-	break;
+	int i = 10;
+	do {
+		i--;
+	} while (i);
+	return i;
 }
 `,
-			analyze.ErrBreakOutsideLoop,
+			analyze.ErrCondType,
 		},
 		{`
 int f() {
-	continue;
+	do {
+		error("x");
+	} while (true);
 }
 `,
-			analyze.ErrContinueOutsideLoop,
+			nil,
+		},
+		{`
+void f() {
+	do {
+		int i = 0;
+	} while (i > 0);
+}
+`,
+			analyze.ErrVarNotDefined,
 		},
 	}
 
@@ -772,16 +1246,80 @@ int f() {
 	}
 }
 
-func TestReturn(t *testing.T) {
+func TestLoop(t *testing.T) {
 	type entry struct {
 		code    string
 		wanterr error
+		// unloop replaces the function's first statement, a loop, with
+		// its body. The parser already refuses break and continue
+		// outside loops, so this is how we get them past it.
+		unloop bool
 	}
 
 	table := []entry{
 		{`
 int f() {
-	return 1;
+	int i = 10;
+	while (i > 0) {
+		i--;
+		break;
+		continue;
+	}
+	return 0;
+}
+`,
+			nil,
+			false,
+		},
+		{`
+int f() {
+	while (true)
+		break;
+}
+`,
+			analyze.ErrBreakOutsideLoop,
+			true,
+		},
+		{`
+int f() {
+	while (true)
+		continue;
+}
+`,
+			analyze.ErrContinueOutsideLoop,
+			true,
+		},
+	}
+
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			n, s := nodes(t, cur.code)
+			if cur.unloop {
+				body := &n[0].(*node.FunDef).Body
+				body.Value[0] = body.Value[0].(*node.While).Body
+			}
+			goterrs := s.Analyze(n)
+			t.Log(goterrs)
+			if cur.wanterr == nil {
+				assert.Equal(t, 0, len(goterrs))
+			} else {
+				require.True(t, len(goterrs) > 0)
+				assert.True(t, errors.Is(goterrs[0], cur.wanterr))
+			}
+		})
+	}
+}
+
+func TestReturn(t *testing.T) {
+	type entry struct {
+		code    string
+		wanterr error
+	}
+
+	table := []entry{
+		{`
+int f() {
+	return 1;
 }
 `,
 			nil,
@@ -810,6 +1348,40 @@ void f() {
 		{`
 int f() {
 }
+`,
+			analyze.ErrReturnMissing,
+		},
+		{`
+int f() {
+	error("x");
+}
+`,
+			nil,
+		},
+		{`
+int f(bool c) {
+	if (c) error("x");
+}
+`,
+			analyze.ErrReturnMissing,
+		},
+		{`
+int f(bool c) {
+	if (c) {
+		error("x");
+	} else {
+		error("y");
+	}
+}
+`,
+			nil,
+		},
+		{`
+int f(bool c) {
+	while (c) {
+		error("x");
+	}
+}
 `,
 			analyze.ErrReturnMissing,
 		},
@@ -830,6 +1402,85 @@ int f() {
 	}
 }
 
+func TestErrorStmt(t *testing.T) {
+	type entry struct {
+		code    string
+		wanterr error
+	}
+
+	table := []entry{
+		{`void f() { error("boom"); }`, nil},
+		{`void f(string s) { error(s); }`, nil},
+		{`void f() { error(1); }`, analyze.ErrErrorNotString},
+		{`void f() { error('c'); }`, analyze.ErrErrorNotString},
+		{`void f(string[] s) { error(s); }`, analyze.ErrErrorNotString},
+		{`void f() { error(nope); }`, analyze.ErrVarNotDefined},
+	}
+
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			n, s := nodes(t, cur.code)
+			goterrs := s.Analyze(n)
+			t.Log(goterrs)
+			if cur.wanterr == nil {
+				assert.Equal(t, 0, len(goterrs))
+			} else {
+				require.Equal(t, 1, len(goterrs))
+				assert.True(t, errors.Is(goterrs[0], cur.wanterr))
+			}
+		})
+	}
+}
+
+// TestStmtArgPosition makes sure errors in the arguments of assert and error
+// point into the argument instead of the keyword.
+func TestStmtArgPosition(t *testing.T) {
+	type entry struct {
+		code    string
+		wanterr error
+		col     int
+	}
+
+	table := []entry{
+		{"void f() {\n\tassert(1 + true);\n}", analyze.ErrArithNonInteger, 9},
+		{"void f() {\n\tassert(1 + 2);\n}", analyze.ErrCondType, 11},
+		{"void f() {\n\terror(123);\n}", analyze.ErrErrorNotString, 8},
+		{"void f() {\n\terror(\"a\" + 1);\n}", analyze.ErrArithNonInteger, 8},
+	}
+
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			n, s := nodes(t, cur.code)
+			goterrs := s.Analyze(n)
+			t.Log(goterrs)
+			require.True(t, len(goterrs) > 0)
+			assert.True(t, errors.Is(goterrs[0], cur.wanterr))
+			var serr *analyze.SyntaxError
+			require.True(t, errors.As(goterrs[0], &serr))
+			assert.Equal(t, 2, serr.Node.Tok().Lineno())
+			assert.Equal(t, cur.col, serr.Node.Tok().Col())
+
+			var arg node.Node
+			node.Walk(n[0], func(n node.Node, _ int) bool {
+				switch t := n.(type) {
+				case *node.Assert:
+					arg = t.Expr
+				case *node.Error:
+					arg = t.Expr
+				}
+				return true
+			})
+			require.NotNil(t, arg)
+			within := false
+			node.Walk(arg, func(n node.Node, _ int) bool {
+				within = within || n == serr.Node
+				return true
+			})
+			assert.True(t, within)
+		})
+	}
+}
+
 func TestComparison(t *testing.T) {
 	type entry struct {
 		code    string
@@ -874,10 +1525,51 @@ void h() {
 	int *a; int *b;
 	a != b;
 }
+`,
+			nil,
+		},
+		{`
+void h() {
+	int* a; int* b;
+	a == b;
+}
+`,
+			nil,
+		},
+		{`
+void h() {
+	int* a; char* b;
+	a == b;
+}
+`,
+			analyze.ErrComparePointerTypes,
+		},
+		{`
+void h() {
+	int** a; int* b;
+	a == b;
+}
+`,
+			analyze.ErrComparePointerTypes,
+		},
+		{`
+void h() {
+	int* a; int b;
+	a == b;
+}
 `,
 			analyze.ErrCompareBadType,
 		},
 		{`
+void h() {
+	int* a;
+	a == NULL;
+	NULL != a;
+}
+`,
+			nil,
+		},
+		{`
 void h() {
 	int a; int *b;
 	a != b;
@@ -916,7 +1608,7 @@ void h() {
 	a == b;
 }
 `,
-			analyze.ErrCompareBadType,
+			nil,
 		},
 		{`
 struct st {
@@ -1007,6 +1699,218 @@ void f() {
 	}
 }
 
+func TestCastArray(t *testing.T) {
+	type entry struct {
+		code    string
+		wanterr error
+	}
+
+	table := []entry{
+		{"void f() { int[] a; (void *)a; }", analyze.ErrCastArray},
+		{"void f() { int[] a; (int[])a; }", analyze.ErrCastArray},
+		{"void f() { int *p; (int[])p; }", analyze.ErrCastArray},
+		{"void f() { void *p; (int[][])p; }", analyze.ErrCastArray},
+		{"void f() { int *p; (void *)p; }", nil},
+		{"void f() { void *p; (int *)p; }", nil},
+		{"void f() { int[] a; (void *)a[0]; }", analyze.ErrCastVoidPointer},
+	}
+
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			n, s := nodes(t, cur.code)
+			errs := s.Analyze(n)
+			t.Log(errs)
+			if cur.wanterr == nil {
+				assert.Equal(t, 0, len(errs))
+			} else {
+				require.Equal(t, 1, len(errs))
+				assert.True(t, errors.Is(errs[0], cur.wanterr))
+			}
+		})
+	}
+}
+
+func TestDialectReserved(t *testing.T) {
+	code := "int f(int const) { int konst = const; return konst; }"
+	n, s := nodes(t, code)
+	assert.Equal(t, 0, len(s.Analyze(n)))
+
+	// The parser would not let these through, but the analyzer should not
+	// depend on it.
+	for _, word := range []string{"const", "konst"} {
+		t.Run(word, func(t *testing.T) {
+			d := analyze.DefaultDialect()
+			d.Reserve(word)
+			n, s := nodes(t, code)
+			s.SetDialect(d)
+			errs := s.Analyze(n)
+			t.Log(errs)
+			require.True(t, len(errs) > 0)
+			assert.True(t, errors.Is(errs[0], analyze.ErrVarDeclReserved))
+		})
+	}
+
+	// The default dialect reserves "do" for the parser too, so we parse
+	// with a placeholder name and rename the declaration afterwards.
+	type entry struct {
+		code   string
+		rename func(*node.FunDef)
+	}
+	table := []entry{
+		{"int f() { int x; return 0; }", func(fd *node.FunDef) {
+			fd.Body.Value[0].(*node.OpAssign).To.(*node.VarDecl).Name = "do"
+		}},
+		{"void f(int x) { }", func(fd *node.FunDef) {
+			fd.Params[0].Name = "do"
+		}},
+	}
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			n, s := nodes(t, cur.code)
+			cur.rename(n[0].(*node.FunDef))
+			errs := s.Analyze(n)
+			t.Log(errs)
+			require.True(t, len(errs) > 0)
+			assert.True(t, errors.Is(errs[0], analyze.ErrVarDeclReserved))
+		})
+	}
+}
+
+func TestShadowsGlobal(t *testing.T) {
+	type entry struct {
+		code    string
+		wanterr error
+	}
+
+	table := []entry{
+		{"void f() { int g; }", analyze.ErrVarDeclShadowsGlobal},
+		{"void f(int g) { }", analyze.ErrVarDeclShadowsGlobal},
+		{"void f() { for (int g = 0; g < 1; g++) {} }", analyze.ErrVarDeclShadowsGlobal},
+		{"int f() { int l = g; return l + g; }", nil},
+		{"void f() { g = 2; g++; }", nil},
+		{"void f() { bool g2 = g == 1; }", nil},
+	}
+
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			// C0 has no global variables, so the parser does not accept
+			// them. The analyzer checks a top-level declaration in the
+			// outermost scope though, which gives us "int g;".
+			toks, lexerrs := lex.Lex([]rune("int g"))
+			require.Equal(t, 0, len(lexerrs))
+			g, err := parse.New().SimpleStmt(toks)
+			require.Nil(t, err)
+			n, s := nodes(t, cur.code)
+			errs := s.Analyze(append([]node.Node{g}, n...))
+			t.Log(errs)
+			if cur.wanterr == nil {
+				assert.Equal(t, 0, len(errs))
+				return
+			}
+			require.True(t, len(errs) > 0)
+			assert.True(t, errors.Is(errs[0], cur.wanterr))
+		})
+	}
+
+	// A second global of the same name is not shadowing.
+	n, s := nodes(t, "int f() { return 1; }")
+	for i := 0; i < 2; i++ {
+		toks, _ := lex.Lex([]rune("int g"))
+		g, err := parse.New().SimpleStmt(toks)
+		require.Nil(t, err)
+		n = append(n, g)
+	}
+	errs := s.Analyze(n)
+	t.Log(errs)
+	require.True(t, len(errs) > 0)
+	assert.True(t, errors.Is(errs[0], analyze.ErrVarAlreadyDefined))
+}
+
+func TestCastLValue(t *testing.T) {
+	type entry struct {
+		code    string
+		wanterr error
+	}
+
+	// A cast gives a value instead of a place in memory, but dereferencing
+	// the pointer it gives is as good as any other dereference.
+	table := []entry{
+		{"void f() { int* p; (int*)p = NULL; }", analyze.ErrAssignNotLValue},
+		{"void f() { void* p; (int*)p = NULL; }", analyze.ErrAssignNotLValue},
+		{"void f() { int* p; *(int*)p = 1; }", nil},
+		{"void f() { void* p; *(int*)p = 1; }", nil},
+		{"void f() { void* p; *(int*)p += 1; }", nil},
+		{"void f() { void* p; (*(int*)p)++; }", nil},
+		{"void f() { int* p; void* q; q = (void*)p; }", nil},
+		{"void f() { int* p; *(bool*)(void*)p = 1; }", analyze.ErrAssignTypeMismatch},
+	}
+
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			n, s := nodes(t, cur.code)
+			errs := s.Analyze(n)
+			t.Log(errs)
+			if cur.wanterr == nil {
+				assert.Equal(t, 0, len(errs))
+			} else {
+				require.Equal(t, 1, len(errs))
+				assert.True(t, errors.Is(errs[0], cur.wanterr))
+			}
+		})
+	}
+}
+
+func TestIsLValue(t *testing.T) {
+	// Each function ends with an assignment to an lvalue.
+	table := []string{
+		"void f() { int x; int y; x = y + 1; }",
+		"void f(int* p) { *p = 1; }",
+		"void f(int[] a) { a[0] = a[1] * 2; }",
+		"struct s { int x; }; void f(struct s* p) { p->x = 1; }",
+		"void f(int* p) { int x; x = *p; }",
+	}
+
+	for _, cur := range table {
+		t.Run(cur, func(t *testing.T) {
+			n, s := nodes(t, cur)
+			require.Equal(t, 0, len(s.Analyze(n)))
+			var oa *node.OpAssign
+			node.Walk(n[len(n)-1], func(n node.Node, _ int) bool {
+				if t, ok := n.(*node.OpAssign); ok {
+					oa = t
+				}
+				return true
+			})
+			require.NotNil(t, oa)
+			res := s.Results()
+			assert.True(t, res.IsLValue(oa.To))
+			// The assignment itself gives a value.
+			assert.False(t, res.IsLValue(oa))
+		})
+	}
+
+	n, s := nodes(t, "void f(int* p) { int x; x = *p + 1; }")
+	require.Equal(t, 0, len(s.Analyze(n)))
+	res := s.Results()
+	var rhs *node.OpBinary
+	var deref *node.OpUnary
+	node.Walk(n[0], func(n node.Node, _ int) bool {
+		switch t := n.(type) {
+		case *node.OpBinary:
+			rhs = t
+		case *node.OpUnary:
+			deref = t
+		}
+		return true
+	})
+	require.NotNil(t, rhs)
+	require.NotNil(t, deref)
+	assert.False(t, res.IsLValue(rhs))
+	assert.False(t, res.IsLValue(rhs.Right))
+	// A dereference on the right-hand side still names a place in memory.
+	assert.True(t, res.IsLValue(deref))
+}
+
 func TestUnary(t *testing.T) {
 	type entry struct {
 		code    string
@@ -1098,3 +2002,1160 @@ void g() {
 		})
 	}
 }
+
+func TestLoopBoundMutated(t *testing.T) {
+	type entry struct {
+		code     string
+		wantwarn bool
+	}
+
+	table := []entry{
+		{`
+void f(int n) {
+	for (int i = 0; i < n; i++) {
+		n = n - 1;
+	}
+}
+`,
+			true,
+		},
+		{`
+void f(int n) {
+	int i = 0;
+	while (i < n) {
+		i++;
+		n--;
+	}
+}
+`,
+			true,
+		},
+		{`
+void f(int n) {
+	for (int i = 0; n > i; i++) {
+		n += 1;
+	}
+}
+`,
+			true,
+		},
+		{`
+void f(int n) {
+	for (int i = 0; i < 10; i++) {
+		n = n - 1;
+	}
+}
+`,
+			false,
+		},
+		{`
+void f(int n) {
+	for (int i = 0; i < n; i++) {
+		int m = n;
+		m = m + 1;
+	}
+}
+`,
+			false,
+		},
+		{`
+void f(int n) {
+	int i = 0;
+	while (n > i) {
+		i++;
+	}
+}
+`,
+			false,
+		},
+		{`
+void f(int j) {
+	while (0 < j) {
+		j--;
+	}
+}
+`,
+			false,
+		},
+		{`
+void f(int n) {
+	int i = 0;
+	while (n > i) {
+		i += 2;
+		n = n / 2;
+	}
+}
+`,
+			true,
+		},
+		{`
+void f(int a, int b) {
+	while (a < b) {
+		a = b;
+	}
+}
+`,
+			false,
+		},
+	}
+
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			n, s := nodes(t, cur.code)
+			require.Equal(t, 0, len(s.Analyze(n)))
+			warns := s.Warnings()
+			t.Log(warns)
+			if !cur.wantwarn {
+				assert.Equal(t, 0, len(warns))
+			} else {
+				require.True(t, len(warns) > 0)
+				assert.True(t, errors.Is(warns[0], analyze.WarnLoopBoundMutated))
+			}
+		})
+	}
+}
+
+func TestArithRecoveryType(t *testing.T) {
+	type entry struct {
+		code    string
+		wanterr error
+	}
+
+	table := []entry{
+		{`void f(int a) { int x = (a + true) * 2; }`, analyze.ErrArithNonInteger},
+		{`void f(int a) { bool x = (a - true) * 2 > 0; }`, analyze.ErrArithNonInteger},
+		{`int f(int a) { return -(a * "x") / 2; }`, analyze.ErrArithNonInteger},
+	}
+
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			n, s := nodes(t, cur.code)
+			goterrs := s.Analyze(n)
+			t.Log(goterrs)
+			require.Equal(t, 1, len(goterrs))
+			assert.True(t, errors.Is(goterrs[0], cur.wanterr))
+			// The erroneous operation is still typed, so its parents are too.
+			res := s.Results()
+			node.Walk(n[0], func(n node.Node, _ int) bool {
+				if _, ok := n.(*node.OpBinary); ok {
+					assert.NotNil(t, res.NodeTypes[n.Id()])
+				}
+				return true
+			})
+		})
+	}
+}
+
+func TestLogic(t *testing.T) {
+	type entry struct {
+		code    string
+		wanterr error
+	}
+
+	table := []entry{
+		{`int f(int a) { if (a > 0 && a < 5) { return 1; } return 0; }`, nil},
+		{`bool f(bool a, bool b) { return a || !b; }`, nil},
+		{`bool f(int a) { return a && true; }`, analyze.ErrLogicNonBool},
+		{`bool f(int a) { return true || a; }`, analyze.ErrLogicNonBool},
+		{`bool f(int a) { return a + true > 0 || a < 1; }`, analyze.ErrArithNonInteger},
+	}
+
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			n, s := nodes(t, cur.code)
+			goterrs := s.Analyze(n)
+			t.Log(goterrs)
+			if cur.wanterr == nil {
+				assert.Equal(t, 0, len(goterrs))
+				return
+			}
+			// The result is boolean regardless, so nothing cascades.
+			require.Equal(t, 1, len(goterrs))
+			assert.True(t, errors.Is(goterrs[0], cur.wanterr))
+		})
+	}
+}
+
+func TestPointerArithmetic(t *testing.T) {
+	type entry struct {
+		code    string
+		wanterr error
+	}
+
+	table := []entry{
+		{`void f() { int a; a + 1; }`, nil},
+		{`void f() { int* p; p + 1; }`, analyze.ErrPointerArithmetic},
+		{`void f() { int* p; 1 - p; }`, analyze.ErrPointerArithmetic},
+		{`void f() { int* p; int x = *p + 1; }`, nil},
+		{`void f() { int** p; int* q = *p * 2; }`, analyze.ErrPointerArithmetic},
+		{`void f() { int*[] p; p + 1; }`, analyze.ErrArithNonInteger},
+	}
+
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			n, s := nodes(t, cur.code)
+			goterrs := s.Analyze(n)
+			t.Log(goterrs)
+			if cur.wanterr == nil {
+				assert.Equal(t, 0, len(goterrs))
+				return
+			}
+			require.True(t, len(goterrs) > 0)
+			assert.True(t, errors.Is(goterrs[0], cur.wanterr))
+			// Pointer arithmetic is still non-integer arithmetic.
+			assert.True(t, errors.Is(goterrs[0], analyze.ErrArithNonInteger))
+		})
+	}
+}
+
+func TestEmptyStmt(t *testing.T) {
+	n, s := nodes(t, `
+int f(int n) {
+	;
+	{ ; ; }
+	int i = 0;
+	for (;;) {
+		if (i > n)
+			break;
+		else
+			;
+		i++;
+	}
+	for (; i > 0;)
+		i--;
+	return i;
+}
+`)
+	errs := s.Analyze(n)
+	t.Log(errs)
+	assert.Equal(t, 0, len(errs))
+}
+
+func TestIncrement(t *testing.T) {
+	type entry struct {
+		code    string
+		wanterr error
+	}
+
+	table := []entry{
+		{`void f() { int i = 0; i++; }`, nil},
+		{`void f() { int i = 0; --i; }`, nil},
+		{`void f(int[] a, int* p) { a[0]++; (*p)--; }`, nil},
+		{`struct s { int x; }; void f(struct s* p) { p->x++; }`, nil},
+		{`void f() { 5++; }`, analyze.ErrIncrementNonLValue},
+		{`void f(int a) { (1 + a)++; }`, analyze.ErrIncrementNonLValue},
+		{`void f() { bool b = true; b++; }`, analyze.ErrIncrementNonInt},
+		{`void f() { char c = 'a'; c--; }`, analyze.ErrIncrementNonInt},
+	}
+
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			n, s := nodes(t, cur.code)
+			goterrs := s.Analyze(n)
+			t.Log(goterrs)
+			if cur.wanterr == nil {
+				assert.Equal(t, 0, len(goterrs))
+			} else {
+				require.True(t, len(goterrs) > 0)
+				assert.True(t, errors.Is(goterrs[0], cur.wanterr))
+			}
+		})
+	}
+}
+
+func TestBrokenSwap(t *testing.T) {
+	type entry struct {
+		code     string
+		wantwarn bool
+	}
+
+	table := []entry{
+		{`
+void f(int a, int b) {
+	a = b;
+	b = a;
+}
+`,
+			true,
+		},
+		{`
+void f(int a, int b) {
+	if (a < b) {
+		b = a;
+		a = b;
+	}
+}
+`,
+			true,
+		},
+		{`
+void f(int a, int b) {
+	int tmp = a;
+	a = b;
+	b = tmp;
+}
+`,
+			false,
+		},
+		{`
+void f(int a, int b, int c) {
+	a = b;
+	b = c;
+}
+`,
+			false,
+		},
+		{`
+void f(int a, int b) {
+	a = b;
+	b += a;
+}
+`,
+			false,
+		},
+	}
+
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			n, s := nodes(t, cur.code)
+			require.Equal(t, 0, len(s.Analyze(n)))
+			warns := s.Warnings()
+			t.Log(warns)
+			if !cur.wantwarn {
+				assert.Equal(t, 0, len(warns))
+			} else {
+				require.Equal(t, 1, len(warns))
+				assert.True(t, errors.Is(warns[0], analyze.WarnBrokenSwap))
+			}
+		})
+	}
+}
+
+func TestNonNull(t *testing.T) {
+	type entry struct {
+		code string
+		// want lists the nullness of each use of variable `p'
+		want []bool
+	}
+
+	table := []entry{
+		{`
+void f() {
+	int* p = alloc(int);
+	*p = 1;
+	p = NULL;
+	int* q = p;
+}
+`,
+			[]bool{true, false, false},
+		},
+		{`
+void f() {
+	int[] p = alloc_array(int, 10);
+	p[0] = 1;
+	int[] q = p;
+}
+`,
+			[]bool{true, true},
+		},
+		{`
+void f(bool c) {
+	int* p = alloc(int);
+	if (c) {
+		p = NULL;
+	}
+	*p = 1;
+}
+`,
+			[]bool{false, false},
+		},
+		{`
+void f(bool c) {
+	int* p = NULL;
+	if (c) {
+		p = alloc(int);
+		*p = 1;
+	}
+	*p = 2;
+}
+`,
+			[]bool{false, true, false},
+		},
+		{`
+void f(bool c) {
+	int* p = alloc(int);
+	while (c) {
+		*p = 1;
+		p = NULL;
+	}
+}
+`,
+			[]bool{false, false},
+		},
+	}
+
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			n, s := nodes(t, cur.code)
+			require.Equal(t, 0, len(s.Analyze(n)))
+			res := s.Results()
+			got := []bool{}
+			node.Walk(n[0], func(n node.Node, _ int) bool {
+				if v, ok := n.(*node.Variable); ok && v.Value == "p" {
+					got = append(got, res.IsNonNull(v))
+				}
+				return true
+			})
+			assert.Equal(t, cur.want, got)
+		})
+	}
+}
+
+func TestNullDeref(t *testing.T) {
+	type entry struct {
+		code    string
+		wanterr error
+	}
+
+	table := []entry{
+		{`
+void f() {
+	int* p = NULL;
+	*p = 1;
+}
+`,
+			analyze.ErrNullDeref,
+		},
+		{`
+void f() {
+	int* p = alloc(int);
+	*p = 1;
+}
+`,
+			nil,
+		},
+		{`
+struct st {
+	int x;
+};
+int f() {
+	struct st* p = alloc(struct st);
+	p = NULL;
+	return p->x;
+}
+`,
+			analyze.ErrNullDeref,
+		},
+		{`
+void f(bool c) {
+	int* p = NULL;
+	if (c) {
+		p = alloc(int);
+	}
+	*p = 1;
+}
+`,
+			nil,
+		},
+		{`
+void f(bool c) {
+	int* p = NULL;
+	if (c) {
+		p = NULL;
+	} else {
+		*p = 1;
+	}
+}
+`,
+			analyze.ErrNullDeref,
+		},
+		{`
+void f(int* q) {
+	int* p = NULL;
+	p = q;
+	*p = 1;
+}
+`,
+			nil,
+		},
+		{`
+void f(bool c) {
+	int* p = NULL;
+	while (c) {
+		*p = 1;
+		p = alloc(int);
+	}
+}
+`,
+			nil,
+		},
+		{`
+int f() {
+	int* p = NULL;
+	if (p != NULL) {
+		return *p;
+	}
+	return 0;
+}
+`,
+			nil,
+		},
+		{`
+int f() {
+	int* p = NULL;
+	return p == NULL ? 0 : *p;
+}
+`,
+			nil,
+		},
+		{`
+int f() {
+	int* p = NULL;
+	if (NULL == p) {
+		return 0;
+	} else {
+		return *p;
+	}
+}
+`,
+			nil,
+		},
+		{`
+int f(int* p) {
+	if (p == NULL) {
+		return *p;
+	}
+	return 0;
+}
+`,
+			analyze.ErrNullDeref,
+		},
+		{`
+void f() {
+	int* p = NULL;
+	bool first = true;
+L:
+	if (!first) *p = 1;
+	first = false;
+	p = alloc(int);
+	goto L;
+}
+`,
+			nil,
+		},
+		{`
+void f() {
+	int* p = NULL;
+L:
+	p = NULL;
+	*p = 1;
+	goto L;
+}
+`,
+			analyze.ErrNullDeref,
+		},
+	}
+
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			n, s := nodes(t, cur.code)
+			goterrs := s.Analyze(n)
+			t.Log(goterrs)
+			if cur.wanterr == nil {
+				assert.Equal(t, 0, len(goterrs))
+			} else {
+				require.True(t, len(goterrs) > 0)
+				assert.True(t, errors.Is(goterrs[0], cur.wanterr))
+			}
+		})
+	}
+}
+
+func TestLimits(t *testing.T) {
+	type entry struct {
+		code    string
+		wanterr error
+	}
+
+	limits := analyze.Limits{StructFields: 3, FuncParams: 2}
+	table := []entry{
+		{"struct st { int a; int b; int c; };", nil},
+		{"struct st { int a; int b; int c; int d; };", analyze.ErrStructTooManyFields},
+		{"void f(int a, int b) {}", nil},
+		{"void f(int a, int b, int c) {}", analyze.ErrFuncTooManyParams},
+		{"void f(int a, int b, int c);", analyze.ErrFuncTooManyParams},
+		{"void f() {}", nil},
+	}
+
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			n, s := nodes(t, cur.code)
+			s.SetLimits(limits)
+			goterrs := s.Analyze(n)
+			t.Log(goterrs)
+			if cur.wanterr == nil {
+				assert.Equal(t, 0, len(goterrs))
+			} else {
+				require.True(t, len(goterrs) > 0)
+				assert.True(t, errors.Is(goterrs[0], cur.wanterr))
+			}
+		})
+	}
+}
+
+func TestLargeStruct(t *testing.T) {
+	type entry struct {
+		code     string
+		wantwarn bool
+	}
+
+	limits := analyze.DefaultLimits
+	limits.LargeStruct = 64
+	table := []entry{
+		{`
+struct a { int x; int y; };
+struct b { struct a first; struct a second; };
+void use(struct b* p) {}
+`, false},
+		{`
+struct a { int x; int y; int z; int w; };
+struct b { struct a first; struct a second; };
+struct c { struct b first; struct b second; };
+struct d { struct c inner; bool flag; };
+void use(struct d* p) {}
+`, true},
+		{`
+struct a { int x; int y; int z; int w; };
+struct b { struct a* first; struct a* second; };
+struct c { struct b* first; struct b* second; };
+struct d { struct c* inner; bool flag; };
+void use(struct d* p) {}
+`, false},
+	}
+
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			n, s := nodes(t, cur.code)
+			s.SetLimits(limits)
+			require.Equal(t, 0, len(s.Analyze(n)))
+			warns := s.Warnings()
+			t.Log(warns)
+			if !cur.wantwarn {
+				assert.Equal(t, 0, len(warns))
+			} else {
+				// Both "c" (64 bytes) and "d" (68 bytes) are large but only
+				// "d" exceeds the limit.
+				require.Equal(t, 1, len(warns))
+				assert.True(t, errors.Is(warns[0], analyze.WarnLargeStruct))
+				assert.True(t, strings.Contains(warns[0].Error(), `"d" is 68 bytes`))
+			}
+		})
+	}
+}
+
+func TestUnusedStruct(t *testing.T) {
+	type entry struct {
+		code string
+		// unused lists the structs we should be warned about
+		unused []string
+	}
+
+	table := []entry{
+		{`struct s { int a; };`, []string{"s"}},
+		{`struct s; void f(struct s* p) {}`, nil},
+		{`struct s { int a; }; void f() { struct s* p; }`, nil},
+		{`
+struct a { int x; };
+struct b { struct a* p; };
+`, []string{"b"}},
+		{`
+struct a;
+struct b { struct a* p; };
+struct a { int x; };
+void f(struct b* p) {}
+`, nil},
+		{`struct node; struct node { struct node* next; };`, []string{"node"}},
+		{`struct s { int a; }; typedef struct s* sp;`, nil},
+		{`struct s { int a; }; int f() { return sizeof(struct s); }`, nil},
+		{`struct s { int a; }; void f() { alloc(struct s); }`, nil},
+		{`struct s { int a; }; int f(struct s* p) { return p->a; }`, nil},
+	}
+
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			n, s := nodes(t, cur.code)
+			require.Equal(t, 0, len(s.Analyze(n)))
+			warns := s.Warnings()
+			t.Log(warns)
+			require.Equal(t, len(cur.unused), len(warns))
+			for i, name := range cur.unused {
+				assert.True(t, errors.Is(warns[i], analyze.WarnUnusedStruct))
+				assert.True(t, strings.Contains(warns[i].Error(), `"`+name+`"`))
+			}
+		})
+	}
+}
+
+func TestUnusedStructOnce(t *testing.T) {
+	n, s := nodes(t, `struct s { int a; };`)
+	require.Equal(t, 0, len(s.Analyze(n)))
+	require.Equal(t, 1, len(s.Warnings()))
+	n, _ = nodes(t, `int f() { return 1; }`)
+	require.Equal(t, 0, len(s.AnalyzeMore(n)))
+	assert.Equal(t, 1, len(s.Warnings()))
+}
+
+func TestUnusedStructLater(t *testing.T) {
+	// Like in a REPL, the struct is used only in a later chunk.
+	n, s := nodes(t, `struct s { int a; };`)
+	require.Equal(t, 0, len(s.AnalyzeMore(n)))
+	n, _ = nodes(t, `int f(struct s* p) { return p->a; }`)
+	require.Equal(t, 0, len(s.AnalyzeMore(n)))
+	assert.Equal(t, 0, len(s.Warnings()))
+}
+
+func TestDefaultLimits(t *testing.T) {
+	n, s := nodes(t, `
+struct st { int a; int b; int c; int d; int e; int f; int g; int h; };
+int fun(int a, int b, int c, int d, int e, int f, int g, int h) { return a; }
+`)
+	assert.Equal(t, 0, len(s.Analyze(n)))
+}
+
+func TestForScope(t *testing.T) {
+	type entry struct {
+		code    string
+		wanterr error
+	}
+
+	table := []entry{
+		{`
+int f(int n) {
+	for (int i = 0; i < n; i++) {
+		n--;
+	}
+	return n;
+}
+`,
+			nil,
+		},
+		{`
+int f(int n) {
+	for (int i = 0; i < n; i++) {}
+	return i;
+}
+`,
+			analyze.ErrVarNotDefined,
+		},
+		{`
+int f(int n) {
+	for (int i = 0; i < n; i++) {
+		int j = i;
+	}
+	for (int i = 0; i < n; i++) {
+		int j = i;
+	}
+	return n;
+}
+`,
+			nil,
+		},
+		{
+			// C0 does not permit shadowing, so an earlier "i" cannot be
+			// redeclared by the loop.
+			`
+int f(int n) {
+	int i = 0;
+	for (int i = 0; i < n; i++) {}
+	return i;
+}
+`,
+			analyze.ErrVarAlreadyDefined,
+		},
+		{`
+int f(int n) {
+	int i;
+	for (i = 0; i < n; i++) {}
+	return i;
+}
+`,
+			nil,
+		},
+	}
+
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			n, s := nodes(t, cur.code)
+			goterrs := s.Analyze(n)
+			t.Log(goterrs)
+			if cur.wanterr == nil {
+				assert.Equal(t, 0, len(goterrs))
+			} else {
+				require.True(t, len(goterrs) > 0)
+				assert.True(t, errors.Is(goterrs[0], cur.wanterr))
+			}
+		})
+	}
+}
+
+func TestLabelGoto(t *testing.T) {
+	type entry struct {
+		code    string
+		wanterr error
+	}
+
+	table := []entry{
+		{`
+int f(int a) {
+	if (a > 0)
+		goto positive;
+	return 0;
+positive:
+	return 1;
+}
+`,
+			nil,
+		},
+		{`
+int f() {
+	int i = 0;
+again:
+	i++;
+	if (i < 10)
+		goto again;
+	return i;
+}
+`,
+			nil,
+		},
+		{`
+int f() {
+	goto nowhere;
+	return 0;
+}
+`,
+			analyze.ErrGotoUndefinedLabel,
+		},
+		{`
+int f() {
+same:
+	return 0;
+same:
+	return 1;
+}
+`,
+			analyze.ErrLabelAlreadyDefined,
+		},
+		{`
+void f() {
+end:
+	return;
+}
+void g() {
+	goto end;
+}
+`,
+			analyze.ErrGotoUndefinedLabel,
+		},
+	}
+
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			n, s := nodes(t, cur.code)
+			goterrs := s.Analyze(n)
+			t.Log(goterrs)
+			if cur.wanterr == nil {
+				assert.Equal(t, 0, len(goterrs))
+			} else {
+				require.True(t, len(goterrs) > 0)
+				assert.True(t, errors.Is(goterrs[0], cur.wanterr))
+			}
+		})
+	}
+}
+
+func TestFuncRedefined(t *testing.T) {
+	type entry struct {
+		code    string
+		wanterr error
+	}
+
+	table := []entry{
+		{"int f(); int f() { return 1; }", nil},
+		{"int f() { return 1; } int f();", nil},
+		{"int f(); bool f(int a);", analyze.ErrFuncDifferentType},
+		{"int f() { return 1; } int f() { return 2; }", analyze.ErrFuncRedefined},
+		{"#use \"testdata/fundecl.h0\"\nint f() { return 2; }", nil},
+		{"#use \"testdata/fundef.h0\"\nint f() { return 2; }", analyze.ErrFuncRedefined},
+	}
+
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			toks, lexerrs := lex.Lex([]rune(cur.code))
+			require.Equal(t, 0, len(lexerrs))
+			// The parser already complains about definitions colliding
+			// across files, but we want to see that the analyzer does not
+			// let them through either.
+			p := parse.New()
+			p.Parse(toks)
+			goterrs := analyze.New(p.Fn()).Analyze(p.Nodes())
+			t.Log(goterrs)
+			if cur.wanterr == nil {
+				assert.Equal(t, 0, len(goterrs))
+			} else {
+				require.Equal(t, 1, len(goterrs))
+				assert.True(t, errors.Is(goterrs[0], cur.wanterr))
+			}
+		})
+	}
+}
+
+func TestGroupByFunction(t *testing.T) {
+	n, s := nodes(t, `
+struct s { int a; };
+struct s { int b; };
+int f() {
+	return true;
+}
+void g() {
+	int a = false;
+	bool b = 1;
+}
+int h() {
+	return 1;
+}
+`)
+	errs := s.Analyze(n)
+	require.Equal(t, 4, len(errs))
+	got := analyze.GroupByFunction(errs)
+	t.Log(got)
+	lines := strings.Split(got, "\n")
+	require.Equal(t, 7, len(lines))
+	assert.True(t, errors.Is(errs[0], analyze.ErrStructAlreadyDefined))
+	assert.Equal(t, errs[0].Error(), lines[0])
+	assert.Equal(t, "In function f:", lines[1])
+	assert.Equal(t, "\t"+errs[1].Error(), lines[2])
+	assert.Equal(t, "In function g:", lines[3])
+	assert.Equal(t, "\t"+errs[2].Error(), lines[4])
+	assert.Equal(t, "\t"+errs[3].Error(), lines[5])
+	assert.Equal(t, "", lines[6])
+}
+
+func TestComparisonAsStmt(t *testing.T) {
+	type entry struct {
+		code     string
+		wantwarn bool
+	}
+
+	table := []entry{
+		{"void f(int a, int b) { a == b; }", true},
+		{"void f(int a, int b) { if (a < b) a == b; }", true},
+		{"void f(int a, int b) { if (a < b) {} else a == b; }", true},
+		{"void f(int a, int b) { while (a < b) a == b; }", true},
+		{"void f(int a, int b) { for (int i = 0; i < b; i == 1) {} }", true},
+		{"void f(int a, int b) { do { a == b + 1; } while (a < b); }", true},
+		{"void f(int a, int b) { a = b; }", false},
+		{"int g() { return 1; } void f() { g(); }", false},
+		{"bool f(int a, int b) { return a == b; }", false},
+		{"void f(int a, int b) { bool c = a == b; }", false},
+		{"void f(int a, int b) { if (a == b) {} }", false},
+		{"void f(int a, int b) { assert(a == b); }", false},
+	}
+
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			n, s := nodes(t, cur.code)
+			require.Equal(t, 0, len(s.Analyze(n)))
+			warns := s.Warnings()
+			t.Log(warns)
+			if !cur.wantwarn {
+				assert.Equal(t, 0, len(warns))
+			} else {
+				require.Equal(t, 1, len(warns))
+				assert.True(t, errors.Is(warns[0], analyze.WarnComparisonAsStmt))
+			}
+		})
+	}
+}
+
+func TestCharIntCompare(t *testing.T) {
+	type entry struct {
+		code     string
+		wanterr  error
+		wantwarn bool
+	}
+
+	table := []entry{
+		{"bool f(char c) { return c < 65; }", nil, false},
+		{"bool f(char c) { return 65 >= c; }", nil, false},
+		{"bool f(char c) { return c <= 0x7F; }", nil, false},
+		{"bool f(char c) { return c > 'a'; }", nil, false},
+		{"bool f(char c) { return c > 60 + 5; }", nil, false},
+		{"bool f(char c, int i) { return c < i; }", nil, true},
+		{"bool f(char c, int i) { return i > c; }", nil, true},
+		{"bool f(char c) { return c < 128; }", nil, true},
+		{"bool f(char c) { return c < -1; }", nil, true},
+		{"bool f(int i, int j) { return i < j; }", nil, false},
+		{"bool f(char c, bool b) { return c < b; }", analyze.ErrCompareNonInteger, false},
+		{"bool f(char c, string s) { return c < s; }", analyze.ErrCompareNonInteger, false},
+	}
+
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			n, s := nodes(t, cur.code)
+			errs := s.Analyze(n)
+			warns := s.Warnings()
+			t.Log(errs, warns)
+			if cur.wanterr == nil {
+				assert.Equal(t, 0, len(errs))
+			} else {
+				require.Equal(t, 1, len(errs))
+				assert.True(t, errors.Is(errs[0], cur.wanterr))
+			}
+			if !cur.wantwarn {
+				assert.Equal(t, 0, len(warns))
+			} else {
+				require.Equal(t, 1, len(warns))
+				assert.True(t, errors.Is(warns[0], analyze.WarnCharIntCompare))
+			}
+		})
+	}
+}
+
+func TestConstantCond(t *testing.T) {
+	type entry struct {
+		code     string
+		wantwarn bool
+	}
+
+	table := []entry{
+		{"void f() { if (true) {} }", true},
+		{"void f() { while (1 < 2) {} }", true},
+		{"void f() { for (int i = 0; false; i++) {} }", true},
+		{"void f() { do {} while (!(1 == 1)); }", true},
+		{"void f() { int a = 1; if (a == 2) {} }", false},
+		{"void f(int n) { while (n < 2) { n++; } }", false},
+		{"void f() { for (;;) { break; } }", false},
+		{"void f() { assert(false); }", false},
+		{"int f() { return 1 < 2 ? 1 : 0; }", false},
+	}
+
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			n, s := nodes(t, cur.code)
+			errs := s.Analyze(n)
+			warns := s.Warnings()
+			t.Log(errs, warns)
+			require.Equal(t, 0, len(errs))
+			if !cur.wantwarn {
+				assert.Equal(t, 0, len(warns))
+				return
+			}
+			require.Equal(t, 1, len(warns))
+			assert.True(t, errors.Is(warns[0], analyze.WarnConstantCondition))
+		})
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	n, s := nodes(t, `
+int f(int a) {
+	if (true) {
+		a == 1;
+	}
+	return "x";
+}
+`)
+	errs := s.Analyze(n)
+	t.Log(errs, s.Warnings())
+	require.Equal(t, 1, len(errs))
+	require.Equal(t, 2, len(s.Warnings()))
+
+	diags := s.Diagnostics()
+	require.Equal(t, 3, len(diags))
+	want := []struct {
+		sev analyze.Severity
+		err error
+	}{
+		{analyze.SEVERITY_WARNING, analyze.WarnComparisonAsStmt},
+		{analyze.SEVERITY_WARNING, analyze.WarnConstantCondition},
+		{analyze.SEVERITY_ERROR, analyze.ErrReturnMistyped},
+	}
+	for i, d := range diags {
+		t.Log(d)
+		assert.Equal(t, want[i].sev, d.Severity)
+		assert.True(t, errors.Is(d.Err, want[i].err))
+	}
+	assert.Equal(t, errs[0], error(diags[2].Err))
+	assert.True(t, strings.HasPrefix(diags[0].String(), "warning: "))
+	assert.True(t, strings.HasPrefix(diags[2].String(), "error: "))
+}
+
+func TestMultipleErrors(t *testing.T) {
+	type entry struct {
+		code     string
+		wanterrs []error
+	}
+
+	table := []entry{
+		{`void f() { bool a = "x" + true; }`, []error{
+			analyze.ErrArithNonInteger, analyze.ErrAssignTypeMismatch}},
+		{`void f() { int a = "x" < true; }`, []error{
+			analyze.ErrCompareNonInteger, analyze.ErrAssignTypeMismatch}},
+		{`void f() { 1 = true; }`, []error{
+			analyze.ErrAssignNotLValue, analyze.ErrAssignTypeMismatch}},
+		{`void f(int* p, int* q) { bool b = p + q; }`, []error{
+			analyze.ErrPointerArithmetic, analyze.ErrPointerArithmetic,
+			analyze.ErrAssignTypeMismatch}},
+		{`void f(int[] a) { bool b = a[true] + 1; }`, []error{
+			analyze.ErrArraySubNotInt, analyze.ErrAssignTypeMismatch}},
+		// A valid target is not reported for no reason.
+		{`void f() { int a = "x" + true; }`, []error{
+			analyze.ErrArithNonInteger}},
+		{`void f() { 1 = 2; }`, []error{
+			analyze.ErrAssignNotLValue}},
+	}
+
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			n, s := nodes(t, cur.code)
+			errs := s.Analyze(n)
+			t.Log(errs)
+			require.Equal(t, len(cur.wanterrs), len(errs))
+			for i, wanterr := range cur.wanterrs {
+				assert.True(t, errors.Is(errs[i], wanterr))
+			}
+		})
+	}
+}
+
+// TestKindSpan makes sure errors about a type cover all of it, including the
+// pointer and array suffixes.
+func TestKindSpan(t *testing.T) {
+	type entry struct {
+		code     string
+		from, to int
+		wanterr  error
+	}
+
+	table := []entry{
+		{"void f() {\n\tstruct foo*[] a;\n}", 2, 15, analyze.ErrTypeUnrecognizedStruct},
+		{"void f() {\n\tstruct foo a;\n}", 2, 12, analyze.ErrTypeUnrecognizedStruct},
+		{"void f() {\n\tint a = alloc(struct foo **);\n}", 16, 29, analyze.ErrTypeUnrecognizedStruct},
+		{"int f() {\n\treturn sizeof(struct nope);\n}", 16, 27, analyze.ErrTypeUnrecognizedStruct},
+	}
+
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			n, s := nodes(t, cur.code)
+			errs := s.Analyze(n)
+			t.Log(errs)
+			require.True(t, len(errs) > 0)
+			assert.True(t, errors.Is(errs[0], cur.wanterr))
+			var serr *analyze.SyntaxError
+			require.True(t, errors.As(errs[0], &serr))
+			assert.Equal(t, span.Span{Lineno0: 2, Col0: cur.from, Lineno: 2, Col: cur.to},
+				serr.Span())
+		})
+	}
+}
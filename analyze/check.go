@@ -19,17 +19,21 @@ import (
 
 var (
 	ErrCondType                 = errors.New("condition not boolean")
-	ErrTernaryMissingCond       = errors.New("ternary operator missing '?'")
-	ErrTernaryMissingValue      = errors.New("ternary operator missing ':'")
 	ErrTernaryCondBool          = errors.New("ternary condition not boolean")
+	ErrTernaryValueTypes        = errors.New("ternary values have different types")
 	ErrCompareNonInteger        = errors.New("non-integer comparison")
 	ErrCompareTypes             = errors.New("types for comparison do not match")
-	ErrCompareBadType           = errors.New("equality can only be evaluated for integers, booleans, characters and arrays")
+	ErrCompareBadType           = errors.New("equality can only be evaluated for integers, booleans, characters, arrays and pointers")
+	ErrComparePointerTypes      = errors.New("comparing pointers of different types")
 	ErrVarNotDefined            = errors.New("variable has not been defined")
 	ErrArithNonInteger          = errors.New("non-integer arithmetic")
 	ErrArithTypes               = errors.New("types for arithmetic do not match")
+	ErrLogicNonBool             = errors.New("non-boolean logical operand")
+	ErrPointerArithmetic        = fmt.Errorf("%w: C0 does not permit pointer arithmetic", ErrArithNonInteger)
 	ErrAssignTypeMismatch       = errors.New("assignment type mismatch")
+	ErrArrayPointerMismatch     = fmt.Errorf("%w: arrays and pointers are distinct in C0", ErrAssignTypeMismatch)
 	ErrAssignNotLValue          = errors.New("cannot assign to a non-lvalue")
+	ErrStructAssignByValue      = errors.New("structs cannot be assigned by value")
 	ErrTypedefNotFound          = errors.New("typedef not found")
 	ErrFuncallNotFound          = errors.New("calling non-declared function")
 	ErrFuncallArgType           = errors.New("function argument type mismatch")
@@ -37,10 +41,14 @@ var (
 	ErrFuncallWrongPtrType      = errors.New("expecting function pointer")
 	ErrVarDeclShadowsFunction   = errors.New("variable declaration already a function")
 	ErrVarDeclShadowsTypedef    = errors.New("variable declaration already a typedef")
+	ErrVarDeclShadowsGlobal     = errors.New("variable declaration shadows a global variable")
 	ErrAllocArrayBadExpr        = errors.New("`alloc_array' expression should result in integer")
+	ErrAllocArrayNegative       = errors.New("`alloc_array' size is negative")
+	ErrAllocVoid                = errors.New("cannot allocate `void'")
 	ErrArraySubBadExpr          = errors.New("bad array subscript expression")
 	ErrArraySubNotArray         = errors.New("trying to subscript a non-array")
 	ErrArraySubNotInt           = errors.New("array subscript a non-integer")
+	ErrStringNotIndexable       = errors.New("strings are not char arrays and cannot be subscripted")
 	ErrStructDecNotField        = errors.New("struct deconstruction needs a field name")
 	ErrStructDecFieldNotFound   = errors.New("struct field not found")
 	ErrStructNotAccessingStruct = errors.New("trying to access a field of a non-struct")
@@ -53,10 +61,20 @@ var (
 	ErrReturnMistyped           = errors.New("`return' expression is mistyped")
 	ErrReturnMissing            = errors.New("`return' statement missing for non-void function")
 	ErrFuncParamStruct          = errors.New("function parameter may not be plain struct")
+	ErrFuncReturnStructFwd      = errors.New("function may not return a forward-declared struct by value")
 	ErrVarDeclVoid              = errors.New("`void' as a variable type is unacceptable")
+	ErrVarDeclReserved          = errors.New("variable name is a reserved word")
 	ErrCastVoid                 = errors.New("cannot cast to void")
 	ErrCastVoidPointer          = errors.New("cannot cast to void pointer")
+	ErrCastArray                = errors.New("arrays cannot be cast")
 	ErrNegateNonBool            = errors.New("cannot negate non-boolean")
+	ErrIncrementNonLValue       = errors.New("cannot increment or decrement a non-lvalue")
+	ErrIncrementNonInt          = errors.New("cannot increment or decrement a non-integer")
+	ErrSizeOfVoid               = errors.New("cannot take the size of void")
+	ErrSizeOfUnknown            = errors.New("size of type is unknown")
+	ErrLabelAlreadyDefined      = errors.New("label is already defined")
+	ErrGotoUndefinedLabel       = errors.New("goto to an undefined label")
+	ErrErrorNotString           = errors.New("`error' expects a string")
 )
 
 var (
@@ -64,6 +82,7 @@ var (
 	typeInt  = types.NewType(types.TYPE_INT, 0, 0)
 	typeChar = types.NewType(types.TYPE_CHAR, 0, 0)
 	typeVoid = types.NewType(types.TYPE_VOID, 0, 0)
+	typeStr  = types.NewType(types.TYPE_STRING, 0, 0)
 )
 
 func min(a, b int) int {
@@ -73,48 +92,39 @@ func min(a, b int) int {
 	return b
 }
 
-// Stores all ternary value nodes (':') we have reached from a condition node
-// ('?)'. We use this to make sure we have valid ':' ... '?' pairs.
-func (s *Analyzer) checkTernaryCond(tc *node.OpBinary) {
-	k := s.getType(tc.Left)
-	if k == nil {
+// checkTernary makes sure the condition is boolean and that both values have
+// the same type, which the whole expression then gets. A NULL value takes the
+// type of a pointer on the other side.
+func (s *Analyzer) checkTernary(n *node.Ternary) {
+	if k := s.getType(n.Cond); k != nil && !k.Matches(typeBool) {
+		s.errorf(n, "%w: got %s", ErrTernaryCondBool, k)
+	}
+	kt := s.getType(n.True)
+	kf := s.getType(n.False)
+	if kt == nil || kf == nil {
 		return
 	}
-	if !k.Matches(typeBool) {
-		s.errorf(tc, "%w: got %s", ErrTernaryCondBool, k)
-	}
-	tv, ok := tc.Right.(*node.OpBinary)
-	if !ok || tv.Op != node.OPBIN_TERNARYVALS {
-		s.errorf(tc, "%w", ErrTernaryMissingValue)
-		return
-	} else if _, ok := s.ternaryvals[tv.Id()]; !ok {
-		s.errorf(tv, "%w", ErrTernaryMissingValue)
-		return
+	switch {
+	case kt.Type == types.TYPE_NULL && kf.PointerLevel > 0:
+		s.setType(n, kf)
+	case kf.Type == types.TYPE_NULL && kt.PointerLevel > 0:
+		s.setType(n, kt)
+	case kt.Matches(kf):
+		s.setType(n, kt)
+	default:
+		s.errorf(n, "%w: %s vs. %s", ErrTernaryValueTypes, kt, kf)
 	}
-	s.ternaryvals[tv.Id()].seen++
-}
-
-// MarkTernaryVal is the other half of ternary checking. Once we meet a ':'
-// node, we store a count of 1 with its ID. Later on, if we find the respective
-// '?', it will do a +1 with the same ID. After we have parsed the expression,
-// all valid pairs of ('?', ':') indexed with the ':' ID will have a count of
-// 2.
-func (s *Analyzer) MarkTernaryVal(tv *node.OpBinary) {
-	s.ternaryvals[tv.Id()] = &ternaryCheck{n: tv, seen: 1}
 }
 
 func (s *Analyzer) checkArraySub(b *node.OpBinary) {
 	// For array subscripts, the left node must be an array. The right has to
-	// be an int.
+	// be an int. Pointer levels always apply to the array elements as types
+	// are written like "int*[]", so arrays of pointers are fine.
 	tl := s.getType(b.Left)
 	tr := s.getType(b.Right)
 	if tl == nil {
 		s.errorf(b, "%w: array", ErrArraySubBadExpr)
 		return
-	} else {
-		if tl.ArrayLevel < 1 || tl.PointerLevel != 0 {
-			s.errorf(b.Left, "%w: got %s", ErrArraySubNotArray, tl)
-		}
 	}
 	if tr == nil {
 		s.errorf(b, "%w: subscript", ErrArraySubBadExpr)
@@ -123,6 +133,12 @@ func (s *Analyzer) checkArraySub(b *node.OpBinary) {
 	if !tr.Matches(typeInt) {
 		s.errorf(b.Right, "%w: got %s", ErrArraySubNotInt, tr)
 	}
+	if tl.ArrayLevel == 0 && tl.PointerLevel == 0 && tl.Type == types.TYPE_STRING {
+		// C0 strings are opaque values instead of char arrays. Their
+		// characters are only accessible through the string library.
+		s.errorf(b.Left, "%w: use string_charat", ErrStringNotIndexable)
+		return
+	}
 	if tl.ArrayLevel == 0 {
 		s.errorf(b.Left, "%w: got %s", ErrArraySubNotArray, tl)
 		return
@@ -146,6 +162,14 @@ func (s *Analyzer) checkComp(b *node.OpBinary) {
 	if kl == nil || kr == nil {
 		return
 	}
+	// Characters may be ordered against integers, see lintCharIntComp.
+	if kl.Matches(typeChar) && kr.Matches(typeInt) {
+		s.lintCharIntComp(b, b.Right)
+		return
+	} else if kl.Matches(typeInt) && kr.Matches(typeChar) {
+		s.lintCharIntComp(b, b.Left)
+		return
+	}
 	if !kl.Matches(kr) || !(kl.Matches(typeInt) || kl.Matches(typeChar)) {
 		s.errorf(b.Left, "%w: %s vs. %s", ErrCompareNonInteger, kl, kr)
 		return
@@ -159,11 +183,30 @@ func (s *Analyzer) checkComp(b *node.OpBinary) {
 }
 
 func (s *Analyzer) checkArith(b *node.OpBinary) {
+	// Like with comparisons, arithmetic always results in an integer. This
+	// keeps a single bad operand from causing more errors further up.
+	s.setType(b, typeInt.Copy())
+
 	kl := s.getType(b.Left)
 	kr := s.getType(b.Right)
 	if kl == nil || kr == nil {
 		return
 	}
+	// Each pointer operand is reported, but after them it makes little
+	// sense to complain about the operands not matching.
+	pointers := false
+	for _, operand := range []struct {
+		n node.Node
+		k *types.Type
+	}{{b.Left, kl}, {b.Right, kr}} {
+		if operand.k.PointerLevel > 0 && operand.k.ArrayLevel == 0 {
+			s.errorf(operand.n, "%w: got %s", ErrPointerArithmetic, operand.k)
+			pointers = true
+		}
+	}
+	if pointers {
+		return
+	}
 	if !kl.Matches(kr) || !kr.Matches(typeInt) {
 		s.errorf(b.Left, "%w: %s vs. %s", ErrArithNonInteger, kl, kr)
 		return
@@ -175,7 +218,19 @@ func (s *Analyzer) checkArith(b *node.OpBinary) {
 			ErrArithTypes,
 			kl, kr)
 	}
-	s.setType(b, kl)
+}
+
+// checkLogic makes sure both operands of && and || are boolean. Like with
+// comparisons, the result is boolean regardless.
+func (s *Analyzer) checkLogic(b *node.OpBinary) {
+	s.setType(b, typeBool.Copy())
+
+	for _, operand := range []node.Node{b.Left, b.Right} {
+		k := s.getType(operand)
+		if k != nil && !k.Matches(typeBool) {
+			s.errorf(operand, "%w: got %s", ErrLogicNonBool, k)
+		}
+	}
 }
 
 func (s *Analyzer) checkAtom(n node.Node, k types.TypeEnum) {
@@ -183,14 +238,18 @@ func (s *Analyzer) checkAtom(n node.Node, k types.TypeEnum) {
 	s.setType(n, nk)
 }
 
+// checkAssign gives the assignment the type of its target. This way each link
+// of a chained assignment is checked against the one to its right.
 func (s *Analyzer) checkAssign(n *node.OpAssign) {
 	// For an lvalue to be valid, it has to fulfill two conditions:
 	//   - it has to be suitably typed
 	//   - its node type has to be a thing in memory, ie. struct member or
 	//     a plain variable
 	if !s.isAssignable(n.To) {
+		// We still check the types below, as they may well be wrong too.
+		// Targets which failed to be analyzed have no type, so they do
+		// not get that far.
 		s.errorf(n.To, "%w: %s", ErrAssignNotLValue, n.To)
-		return
 	}
 	if n.What == nil {
 		// Assignment may be without first value.
@@ -208,11 +267,60 @@ func (s *Analyzer) checkAssign(n *node.OpAssign) {
 	//
 	if !kt.Matches(kw) &&
 		!(kt.PointerLevel > 0 && kw.Type == types.TYPE_NULL) {
-		s.errorf(n, "%w: %s vs %s", ErrAssignTypeMismatch, kt, kw)
+		if arrayPointer(kt, kw) || arrayPointer(kw, kt) {
+			// Unlike in C, arrays do not decay into pointers.
+			s.errorf(n, "%w: expected %s, got %s",
+				ErrArrayPointerMismatch, kt, kw)
+		} else if why := arrayMismatch(kt, kw); why != "" {
+			s.errorf(n, "%w: expected %s, got %s: %s",
+				ErrAssignTypeMismatch, kt, kw, why)
+		} else if link, ok := n.What.(*node.OpAssign); ok {
+			// With "a = b = c", the type of "b = c" is that of "b", so
+			// name it to make clear which link of the chain is wrong.
+			s.errorf(n, "%w: %s vs %s of assignment to %s",
+				ErrAssignTypeMismatch, kt, kw, link.To)
+		} else {
+			s.errorf(n, "%w: %s vs %s", ErrAssignTypeMismatch, kt, kw)
+		}
+	} else if isValueStruct(s.Canonical(kt)) && isValueStruct(s.Canonical(kw)) {
+		// Like with equality, C0 does not consider structs as a whole, so
+		// they have to be copied field by field.
+		s.errorf(n, "%w: %s", ErrStructAssignByValue, kt)
 	}
 	s.setType(n, kt)
 }
 
+func isValueStruct(k *types.Type) bool {
+	return k.Type == types.TYPE_STRUCT && k.PointerLevel == 0 && k.ArrayLevel == 0
+}
+
+// arrayPointer tells if ka is an array and kp a pointer.
+func arrayPointer(ka, kp *types.Type) bool {
+	return ka.ArrayLevel > 0 && kp.ArrayLevel == 0 && kp.PointerLevel > 0 &&
+		kp.Type != types.TYPE_NULL
+}
+
+// arrayMismatch explains why two types do not match if either of them is an
+// array. This is mostly useful with multi-dimensional arrays given by
+// "alloc_array", where it is easy to miss a dimension.
+func arrayMismatch(kt, kw *types.Type) string {
+	if kt.ArrayLevel == 0 && kw.ArrayLevel == 0 {
+		return ""
+	}
+	et, ew := kt.Copy(), kw.Copy()
+	et.ArrayLevel, ew.ArrayLevel = 0, 0
+	switch {
+	case kt.ArrayLevel == 0:
+		return "unexpected array"
+	case kw.ArrayLevel == 0:
+		return "not an array"
+	case et.Matches(ew):
+		return fmt.Sprintf("%d array dimensions instead of %d",
+			kw.ArrayLevel, kt.ArrayLevel)
+	}
+	return fmt.Sprintf("array elements are %s instead of %s", ew, et)
+}
+
 func (s *Analyzer) getStructFieldType(n *node.Variable, st *types.Struct) *types.Type {
 	if st == nil {
 		return nil
@@ -285,6 +393,15 @@ func (s *Analyzer) checkVariable(n *node.Variable) {
 }
 
 func (s *Analyzer) isNameShadowed(n node.Node, name string) bool {
+	// The parser should have caught these already.
+	if s.dialect.IsReserved(name) {
+		s.errorf(n, "%w: %q", ErrVarDeclReserved, name)
+		return true
+	}
+	if s.scope.global(name) {
+		s.errorf(n, "%w: %q", ErrVarDeclShadowsGlobal, name)
+		return true
+	}
 	if fd := s.getFunction(name); fd != nil {
 		s.errorf(n, "%w: %q", ErrVarDeclShadowsFunction, name)
 		return true
@@ -309,7 +426,7 @@ func (s *Analyzer) checkVarDecl(n *node.VarDecl) {
 		return
 	}
 	if err := s.scope.add(n.Name, t); err != nil {
-		s.errorf(n, "variable %q has already been defined", n.Name)
+		s.errorf(n, "%w: %q", err, n.Name)
 		return
 	}
 	if t.Type == types.TYPE_VOID && t.PointerLevel == 0 {
@@ -353,7 +470,9 @@ func (s *Analyzer) checkFunCall(n *node.OpBinary) {
 		if ct == nil {
 			return
 		}
-		if ct.Type != types.TYPE_FUNC {
+		// Function pointers have to be explicitly dereferenced before
+		// calling, that is, "(*fp)(...)".
+		if ct.Type != types.TYPE_FUNC || ct.PointerLevel > 0 || ct.ArrayLevel > 0 {
 			s.errorf(t, "%w: got %s", ErrFuncallWrongPtrType, ct)
 			return
 		}
@@ -378,6 +497,9 @@ func (s *Analyzer) checkFunCall(n *node.OpBinary) {
 	for i := 0; i < min(ngot, nwant); i++ {
 		typegot := s.getType(got[i])
 		typewant := want[i]
+		if typegot == nil {
+			continue
+		}
 		if !typewant.Matches(typegot) {
 			s.errorf(n, "%w: wanted %s, got %s",
 				ErrFuncallArgType, &typewant, typegot)
@@ -387,9 +509,15 @@ func (s *Analyzer) checkFunCall(n *node.OpBinary) {
 }
 
 func (s *Analyzer) checkFunDecl(n *node.FunDecl) {
-	if s.isNameShadowed(n, n.Name) {
+	// A function may be declared many times as long as the types match,
+	// which setFunction checks.
+	if s.getFunction(n.Name) == nil && s.isNameShadowed(n, n.Name) {
 		return
 	}
+	if len(n.Params) > s.limits.FuncParams {
+		s.errorf(n, "%w: %q has %d, maximum is %d",
+			ErrFuncTooManyParams, n.Name, len(n.Params), s.limits.FuncParams)
+	}
 	for _, param := range n.Params {
 		pt, err := s.KindToType(&param.Kind)
 		if err != nil {
@@ -403,6 +531,13 @@ func (s *Analyzer) checkFunDecl(n *node.FunDecl) {
 	}
 	if err := s.setFunction(n); err != nil {
 		s.errorf(n, "%w", err)
+		return
+	}
+	// Like with variables, we cannot pass around a struct value of unknown
+	// size.
+	rt := &s.getFunction(n.Name).Returns
+	if rt.Type == types.TYPE_STRUCT_FWD && rt.PointerLevel == 0 && rt.ArrayLevel == 0 {
+		s.errorf(n, "%w: %q", ErrFuncReturnStructFwd, n.Name)
 	}
 }
 
@@ -414,6 +549,12 @@ func (s *Analyzer) checkCast(n *node.Cast) {
 	if kc.Kind == types.TYPE_VOID && kc.PointerLevel < 1 {
 		s.errorf(n, "%w", ErrCastVoid)
 	}
+	// Arrays are not pointers in C0, so there is nothing to convert them to
+	// or from.
+	if kc.ArrayLevel > 0 {
+		s.errorf(n, "%w: cannot cast to an array", ErrCastArray)
+		goto end
+	}
 	// If kw is nil, its traversal failed and produced no usable type.
 	if kw == nil {
 		goto end
@@ -423,7 +564,9 @@ func (s *Analyzer) checkCast(n *node.Cast) {
 	case *node.Null:
 		s.errorf(n, "NULL cannot be cast")
 	default:
-		if kw.PointerLevel < 1 && kc.PointerLevel > 0 {
+		if kw.ArrayLevel > 0 {
+			s.errorf(n, "%w: %s is %s", ErrCastArray, n.What, kw)
+		} else if kw.PointerLevel < 1 && kc.PointerLevel > 0 {
 			s.errorf(n, "%w: %s is %s", ErrCastVoidPointer, n.What, kw)
 		}
 	}
@@ -445,18 +588,16 @@ func (s *Analyzer) checkUnary(n *node.OpUnary) {
 		if kt.Type == types.TYPE_NULL {
 			s.errorf(n, "derefencing NULL")
 			return
-		} else if kt.PointerLevel < 1 {
+		} else if kt.PointerLevel < 1 || kt.ArrayLevel > 0 {
 			s.errorf(n, "dereferencing non-pointer %q", n.To)
 			return
 		}
 		nt := kt.Copy()
 		nt.DecPtr()
 		s.setType(n, nt)
-		// As we do not permit pointer arithmetics, deferencing should only
-		// appear in front of pointers.
-		if s.isAssignable(n.To) {
-			s.setAssignable(n)
-		}
+		// Whatever gave us the pointer, be it a variable, a cast, or a
+		// function call, dereferencing it names a cell in memory.
+		s.setAssignable(n)
 		// See the comment in checkVariable about propagating this flag.
 		if st := s.getStructAccess(n.To); st != nil {
 			s.setStructAccess(n, st)
@@ -473,6 +614,15 @@ func (s *Analyzer) checkUnary(n *node.OpUnary) {
 			s.errorf(n, "%w: %q", ErrNegateNonBool, n.To)
 		}
 		s.setType(n, kt)
+	case node.OPUN_ADDONE, node.OPUN_SUBONE,
+		node.OPUN_ADDONESUFFIX, node.OPUN_SUBONESUFFIX:
+		// Incrementing and decrementing are assignments in disguise.
+		if !s.isAssignable(n.To) {
+			s.errorf(n, "%w: %s", ErrIncrementNonLValue, n.To)
+		} else if !kt.Matches(typeInt) {
+			s.errorf(n, "%w: %s %s", ErrIncrementNonInt, kt, n.To)
+		}
+		s.setType(n, typeInt.Copy())
 	default:
 		// The default case covers all integer operations.
 		if !kt.Matches(typeInt) {
@@ -490,6 +640,19 @@ func (s *Analyzer) checkEq(n *node.OpBinary) {
 	if kl == nil || kr == nil {
 		return
 	}
+	// Pointers may be compared with NULL and pointers of the same type.
+	isnull := func(k *types.Type) bool {
+		return k.Type == types.TYPE_NULL
+	}
+	isptr := func(k *types.Type) bool {
+		return k.PointerLevel > 0 && k.ArrayLevel == 0
+	}
+	if (isptr(kl) || isnull(kl)) && (isptr(kr) || isnull(kr)) {
+		if isptr(kl) && isptr(kr) && !kl.Matches(kr) {
+			s.errorf(n, "%w: %s vs. %s", ErrComparePointerTypes, kl, kr)
+		}
+		return
+	}
 	v := func(k *types.Type) bool {
 		return k.Matches(typeInt) || k.Matches(typeBool) || k.Matches(typeChar) ||
 			k.ArrayLevel > 0
@@ -516,6 +679,7 @@ func (s *Analyzer) checkCond(cond node.Node, name string) {
 	}
 	if !k.Matches(typeBool) {
 		s.errorf(cond, "%w for %s: got %s", ErrCondType, name, k)
+		return
 	}
 }
 
@@ -524,12 +688,21 @@ func (s *Analyzer) checkAllocArray(n *node.AllocArray) {
 	if err != nil {
 		return
 	}
+	if at.Matches(typeVoid) {
+		s.errorf(n, "%w: `alloc_array' elements", ErrAllocVoid)
+	}
 	at.IncArray()
 	s.setType(n, at)
 
 	nt := s.getType(n.N)
 	if !nt.Matches(typeInt) {
 		s.errorf(n.N, "%w: got %s", ErrAllocArrayBadExpr, nt)
+		return
+	}
+	// A negative size is a run-time error, but we may as well tell about it
+	// now if we know it.
+	if c, ok := node.EvalConst(n.N); ok && c.Kind == node.CONST_INT && c.Int < 0 {
+		s.errorf(n.N, "%w: %d", ErrAllocArrayNegative, c.Int)
 	}
 }
 
@@ -538,10 +711,31 @@ func (s *Analyzer) checkAlloc(n *node.Alloc) {
 	if err != nil {
 		return
 	}
+	if at.Matches(typeVoid) {
+		s.errorf(n, "%w", ErrAllocVoid)
+	}
 	at.IncPtr()
 	s.setType(n, at)
 }
 
+func (s *Analyzer) checkSizeOf(n *node.SizeOf) {
+	s.setType(n, typeInt.Copy())
+	st, err := s.KindToType(&n.Kind)
+	if err != nil {
+		return
+	}
+	if st.Matches(typeVoid) {
+		s.errorf(n, "%w", ErrSizeOfVoid)
+		return
+	}
+	size, ok := st.Size()
+	if !ok {
+		s.errorf(n, "%w: %s", ErrSizeOfUnknown, st)
+		return
+	}
+	s.res.Sizes[n.Id()] = size
+}
+
 func (s *Analyzer) checkBreak(n *node.Break) {
 	cl := s.currentLoop()
 	if cl == nil {
@@ -558,6 +752,64 @@ func (s *Analyzer) checkContinue(n *node.Continue) {
 	}
 }
 
+// checkError makes sure error() is given a string, which is the message
+// printed when the program aborts.
+func (s *Analyzer) checkError(n *node.Error) {
+	k := s.getType(n.Expr)
+	if k == nil {
+		return
+	}
+	if !k.Matches(typeStr) {
+		s.errorf(n.Expr, "%w: got %s", ErrErrorNotString, k)
+	}
+}
+
+// alwaysErrors tells if every path through the statement n calls error(). Such
+// statements never complete normally, so a function body like that does not
+// need a return statement. Loops are conservatively assumed to complete.
+func alwaysErrors(n node.Node) bool {
+	switch t := n.(type) {
+	case *node.Error:
+		return true
+	case *node.Block:
+		for _, stmt := range t.Value {
+			switch stmt.(type) {
+			case *node.Return, *node.Break, *node.Continue, *node.Goto:
+				return false
+			}
+			if alwaysErrors(stmt) {
+				return true
+			}
+		}
+	case *node.If:
+		return t.False != nil && alwaysErrors(t.True) && alwaysErrors(t.False)
+	case *node.DoWhile:
+		// The body is always evaluated at least once.
+		return alwaysErrors(t.Body)
+	}
+	return false
+}
+
+// checkLabel makes sure labels are unique within a function. Unlike variables,
+// labels are not scoped by blocks.
+func (s *Analyzer) checkLabel(n *node.Label) {
+	if _, ok := s.labels[n.Name]; ok {
+		s.errorf(n, "%w: %q", ErrLabelAlreadyDefined, n.Name)
+		return
+	}
+	s.labels[n.Name] = n
+}
+
+// checkGotos makes sure every goto of the function we just analyzed has a
+// target. As goto may jump forwards, this is done after seeing all labels.
+func (s *Analyzer) checkGotos() {
+	for _, g := range s.gotos {
+		if _, ok := s.labels[g.Target]; !ok {
+			s.errorf(g, "%w: %q", ErrGotoUndefinedLabel, g.Target)
+		}
+	}
+}
+
 func (s *Analyzer) checkReturn(n *node.Return) {
 	cf := s.curFunction()
 	if cf == nil {
@@ -634,10 +886,6 @@ func (s *Analyzer) checkStructFieldAccess(n *node.OpBinary) {
 
 func (s *Analyzer) checkBinary(n *node.OpBinary) {
 	switch n.Op {
-	case node.OPBIN_TERNARYCOND:
-		s.checkTernaryCond(n)
-	case node.OPBIN_TERNARYVALS:
-		s.MarkTernaryVal(n)
 	case node.OPBIN_ARRSUB:
 		s.checkArraySub(n)
 	case node.OPBIN_EQ, node.OPBIN_NE:
@@ -646,8 +894,9 @@ func (s *Analyzer) checkBinary(n *node.OpBinary) {
 		s.checkFunCall(n)
 	case node.OPBIN_LE, node.OPBIN_GE, node.OPBIN_LT, node.OPBIN_GT:
 		s.checkComp(n)
+	case node.OPBIN_AND, node.OPBIN_OR:
+		s.checkLogic(n)
 	case node.OPBIN_BAND, node.OPBIN_BOR, node.OPBIN_BXOR,
-		node.OPBIN_AND, node.OPBIN_OR,
 		node.OPBIN_SHIFTR, node.OPBIN_SHIFTL,
 		node.OPBIN_ADD, node.OPBIN_SUB, node.OPBIN_MUL, node.OPBIN_DIV,
 		node.OPBIN_MOD:
@@ -664,6 +913,7 @@ func (s *Analyzer) check(n node.Node) {
 	switch t := n.(type) {
 	case *node.Variable:
 		s.checkVariable(t)
+		s.markNonNull(t)
 	case *node.Bool:
 		s.checkAtom(t, types.TYPE_BOOL)
 	case *node.LibLit:
@@ -679,6 +929,8 @@ func (s *Analyzer) check(n node.Node) {
 	case *node.Struct:
 		if err := s.addStruct(t); err != nil {
 			s.errorf(n, "%w", err)
+		} else {
+			s.lintLargeStruct(t)
 		}
 	case *node.StructForwardDecl:
 		s.setStructFwd(t)
@@ -693,21 +945,36 @@ func (s *Analyzer) check(n node.Node) {
 	case *node.OpUnary:
 		a(t.To)
 		s.checkUnary(t)
+		if t.Op == node.OPUN_DEREF {
+			s.checkNullDeref(t, t.To)
+		}
 	case *node.OpBinary:
 		a(t.Left)
 		switch t.Op {
 		case node.OPBIN_STRUCTDEC, node.OPBIN_STRUCTPTRDEC:
 			s.checkStructFieldAccess(t)
+			if t.Op == node.OPBIN_STRUCTPTRDEC {
+				s.checkNullDeref(t, t.Left)
+			}
 		default:
 			a(t.Right)
 			s.checkBinary(t)
 		}
+	case *node.Ternary:
+		a(t.Cond)
+		s.withBranches(t.Cond, t.True, t.False)
+		s.checkTernary(t)
 	case *node.OpAssign:
 		a(t.What)
 		a(t.To)
 		s.checkAssign(t)
+		s.trackNull(t)
 	case *node.VarDecl:
 		s.checkVarDecl(t)
+	case *node.VarDeclList:
+		for _, decl := range t.Value {
+			a(decl)
+		}
 	case *node.Args:
 		for _, arg := range t.Value {
 			a(arg)
@@ -721,6 +988,11 @@ func (s *Analyzer) check(n node.Node) {
 			s.checkFunDecl(t)
 		})
 	case *node.FunDef:
+		if _, ok := s.fundefs[t.Name]; ok {
+			s.errorf(n, "%w: %q", ErrFuncRedefined, t.Name)
+		}
+		s.fundefs[t.Name] = t
+		s.funcname = t.Name
 		a(&t.Returns)
 		s.withScope(t, func() {
 			for _, param := range t.Params {
@@ -737,35 +1009,65 @@ func (s *Analyzer) check(n node.Node) {
 				if cf == nil {
 					s.errorf(n, "invalid function definition: %q", t.Name)
 				}
-				if !cf.Returns.Matches(typeVoid) && s.returns[cf] == 0 {
+				if !cf.Returns.Matches(typeVoid) && s.returns[cf] == 0 &&
+					!alwaysErrors(&t.Body) {
 					s.errorf(t, "%w", ErrReturnMissing)
 				}
 			})
 		})
+		s.funcname = ""
 	case *node.Block:
 		s.withScope(t, func() {
 			for _, param := range t.Value {
 				a(param)
 			}
 		})
+		s.lintBrokenSwap(t.Value)
+		s.lintComparisonStmts(t.Value...)
 	case *node.If:
 		a(t.Cond)
-		a(t.True)
-		a(t.False)
+		s.withBranches(t.Cond, t.True, t.False)
 		s.checkCond(t.Cond, "if")
+		s.lintConstantCond(t.Cond, "if")
+		s.lintComparisonStmts(t.True, t.False)
 	case *node.For:
-		s.withLoop(t, func() {
-			a(t.Init)
-			a(t.Cond)
-			a(t.OnEach)
-			a(t.Body)
-			s.checkCond(t.Cond, "for")
+		// The loop variable declared in the initializer is only visible
+		// within the loop.
+		s.withScope(t, func() {
+			s.withLoop(t, func() {
+				a(t.Init)
+				s.withNullLoop(t, func() {
+					a(t.Cond)
+					a(t.OnEach)
+					a(t.Body)
+				})
+				s.checkCond(t.Cond, "for")
+				s.lintConstantCond(t.Cond, "for")
+				s.lintLoopBound(t.Cond, t.OnEach, t.Body)
+				s.lintComparisonStmts(t.OnEach, t.Body)
+			})
 		})
 	case *node.While:
 		s.withLoop(t, func() {
-			a(t.Cond)
-			a(t.Body)
+			s.withNullLoop(t, func() {
+				a(t.Cond)
+				a(t.Body)
+			})
 			s.checkCond(t.Cond, "while")
+			s.lintConstantCond(t.Cond, "while")
+			s.lintLoopBound(t.Cond, nil, t.Body)
+			s.lintComparisonStmts(t.Body)
+		})
+	case *node.DoWhile:
+		s.withLoop(t, func() {
+			s.withNullLoop(t, func() {
+				a(t.Body)
+				a(t.Cond)
+			})
+			s.checkCond(t.Cond, "do-while")
+			s.lintConstantCond(t.Cond, "do-while")
+			s.lintLoopBound(t.Cond, nil, t.Body)
+			s.lintComparisonStmts(t.Body)
 		})
 	case *node.Return:
 		a(t.Expr)
@@ -775,7 +1077,7 @@ func (s *Analyzer) check(n node.Node) {
 		s.checkCond(t.Expr, "assert")
 	case *node.Error:
 		a(t.Expr)
-		panic("implement error check")
+		s.checkError(t)
 	case *node.Cast:
 		a(t.What)
 		s.checkCast(t)
@@ -784,21 +1086,20 @@ func (s *Analyzer) check(n node.Node) {
 		s.checkAllocArray(t)
 	case *node.Alloc:
 		s.checkAlloc(t)
+	case *node.SizeOf:
+		s.checkSizeOf(t)
 	case *node.Break:
 		s.checkBreak(t)
 	case *node.Continue:
 		s.checkContinue(t)
-	case nil, *node.Kind, *node.DirectiveUse:
+	case *node.Label:
+		s.checkLabel(t)
+		s.forgetNull()
+	case *node.Goto:
+		s.gotos = append(s.gotos, t)
+	case nil, *node.Kind, *node.DirectiveUse, *node.Empty, *node.ErrorNode:
 		// these are no-action
 	default:
 		panic(fmt.Sprintf("check: unhandled %T: %s", t, t))
 	}
 }
-
-func (s *Analyzer) checkTernaries() {
-	for _, tc := range s.ternaryvals {
-		if tc.seen != 2 {
-			s.errorf(tc.n, "%w", ErrTernaryMissingCond)
-		}
-	}
-}
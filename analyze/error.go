@@ -1,14 +1,20 @@
 package analyze
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/susji/c0/node"
+	"github.com/susji/c0/span"
 )
 
+// SyntaxError is an error or a warning found during analysis. Func is the name
+// of the function definition it was found in, if any.
 type SyntaxError struct {
 	Node    node.Node
 	Fn      string
+	Func    string
 	Wrapped error
 }
 
@@ -20,3 +26,69 @@ func (e *SyntaxError) Error() string {
 func (e *SyntaxError) Unwrap() error {
 	return e.Wrapped
 }
+
+// Span returns the source range of the node the error is about.
+func (e *SyntaxError) Span() span.Span {
+	return e.Node.Tok().Span()
+}
+
+type Severity int
+
+const (
+	SEVERITY_ERROR = iota
+	SEVERITY_WARNING
+	SEVERITY_INFO
+)
+
+var severitynames = [...]string{
+	"error",
+	"warning",
+	"info",
+}
+
+func (s Severity) String() string {
+	return severitynames[s]
+}
+
+// Diagnostic is anything analysis tells about the program. Only the ones with
+// SEVERITY_ERROR mean that the program is invalid, and those are also
+// returned by Analyze.
+type Diagnostic struct {
+	Severity Severity
+	Err      *SyntaxError
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s", d.Severity, d.Err)
+}
+
+// GroupByFunction renders errors so that the ones found inside a function
+// definition are listed under its name in the order the functions were met.
+// Errors outside of any function come first as they are.
+func GroupByFunction(errs []error) string {
+	outside := []error{}
+	funcs := []string{}
+	infunc := map[string][]error{}
+	for _, err := range errs {
+		var serr *SyntaxError
+		if !errors.As(err, &serr) || serr.Func == "" {
+			outside = append(outside, err)
+			continue
+		}
+		if _, ok := infunc[serr.Func]; !ok {
+			funcs = append(funcs, serr.Func)
+		}
+		infunc[serr.Func] = append(infunc[serr.Func], err)
+	}
+	b := &strings.Builder{}
+	for _, err := range outside {
+		fmt.Fprintln(b, err)
+	}
+	for _, f := range funcs {
+		fmt.Fprintf(b, "In function %s:\n", f)
+		for _, err := range infunc[f] {
+			fmt.Fprintf(b, "\t%s\n", err)
+		}
+	}
+	return b.String()
+}
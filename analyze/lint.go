@@ -0,0 +1,228 @@
+package analyze
+
+// The code in this file produces warnings, that is, diagnostics about code
+// which is valid C0 but probably not what the programmer meant.
+
+import (
+	"errors"
+
+	"github.com/susji/c0/node"
+)
+
+var (
+	WarnLoopBoundMutated  = errors.New("loop bound modified inside loop body")
+	WarnBrokenSwap        = errors.New("swap without a temporary variable")
+	WarnLargeStruct       = errors.New("struct is very large")
+	WarnUnusedStruct      = errors.New("struct is defined but never used")
+	WarnComparisonAsStmt  = errors.New("comparison result is discarded")
+	WarnCharIntCompare    = errors.New("ordering comparison between char and int")
+	WarnConstantCondition = errors.New("condition is constant")
+)
+
+func (p *Analyzer) warnf(n node.Node, format string, a ...interface{}) error {
+	err := p.diagnose(SEVERITY_WARNING, n, format, a...)
+	p.warns = append(p.warns, err)
+	return err
+}
+
+// Warnings returns the warnings found during analysis.
+func (s *Analyzer) Warnings() []error {
+	return s.warns
+}
+
+// loopIterator returns the name of the variable stepped by a for loop.
+func loopIterator(step node.Node) string {
+	switch t := step.(type) {
+	case *node.OpAssign:
+		if v, ok := t.To.(*node.Variable); ok {
+			return v.Value
+		}
+	case *node.OpUnary:
+		if v, ok := t.To.(*node.Variable); ok {
+			return v.Value
+		}
+	}
+	return ""
+}
+
+// steppedOnly tells if the body modifies the variable called name and only
+// ever increments or decrements it, like loop iterators usually are.
+func steppedOnly(name string, body node.Node) bool {
+	stepped := false
+	only := true
+	node.Walk(body, func(n node.Node, _ int) bool {
+		if got, ok := assignedVariable(n); !ok || got != name {
+			return true
+		}
+		stepped = true
+		switch t := n.(type) {
+		case *node.OpAssign:
+			if t.Op != node.OPASN_ADD && t.Op != node.OPASN_SUB {
+				only = false
+			}
+		}
+		return true
+	})
+	return stepped && only
+}
+
+// loopBound guesses which variable bounds the loop. We expect the condition
+// to be a comparison between the iterator and the bound in either order. For
+// loops tell us the iterator in their step. Otherwise the iterator is the
+// operand which the body only increments or decrements, and if both are, we
+// go with `iterator OP bound`.
+func loopBound(cond, step, body node.Node) string {
+	b, ok := cond.(*node.OpBinary)
+	if !ok {
+		return ""
+	}
+	switch b.Op {
+	case node.OPBIN_LT, node.OPBIN_LE, node.OPBIN_GT, node.OPBIN_GE, node.OPBIN_NE:
+	default:
+		return ""
+	}
+	l, _ := b.Left.(*node.Variable)
+	r, _ := b.Right.(*node.Variable)
+	var iter string
+	switch {
+	case step != nil:
+		iter = loopIterator(step)
+	case l != nil && steppedOnly(l.Value, body):
+		iter = l.Value
+	case r != nil && steppedOnly(r.Value, body):
+		iter = r.Value
+	}
+	switch {
+	case iter == "":
+		return ""
+	case r != nil && r.Value == iter:
+		r = l
+	case l == nil || l.Value != iter:
+		return ""
+	}
+	if r == nil {
+		return ""
+	}
+	return r.Value
+}
+
+// assignedVariable returns the name of the variable modified by n, if any.
+func assignedVariable(n node.Node) (string, bool) {
+	switch t := n.(type) {
+	case *node.OpAssign:
+		if v, ok := t.To.(*node.Variable); ok {
+			return v.Value, true
+		}
+	case *node.OpUnary:
+		switch t.Op {
+		case node.OPUN_ADDONE, node.OPUN_SUBONE,
+			node.OPUN_ADDONESUFFIX, node.OPUN_SUBONESUFFIX:
+			if v, ok := t.To.(*node.Variable); ok {
+				return v.Value, true
+			}
+		}
+	}
+	return "", false
+}
+
+func (s *Analyzer) lintLoopBound(cond, step, body node.Node) {
+	if body == nil {
+		return
+	}
+	bound := loopBound(cond, step, body)
+	if bound == "" {
+		return
+	}
+	node.Walk(body, func(n node.Node, _ int) bool {
+		if name, ok := assignedVariable(n); ok && name == bound {
+			s.warnf(n, "%w: %q", WarnLoopBoundMutated, bound)
+		}
+		return true
+	})
+}
+
+// plainCopy returns the names of the variables in "to = from".
+func plainCopy(n node.Node) (to, from string, ok bool) {
+	a, ok := n.(*node.OpAssign)
+	if !ok || a.Op != node.OPASN_PLAIN {
+		return "", "", false
+	}
+	vt, okt := a.To.(*node.Variable)
+	vf, okf := a.What.(*node.Variable)
+	if !okt || !okf || vt.Value == vf.Value {
+		return "", "", false
+	}
+	return vt.Value, vf.Value, true
+}
+
+// lintBrokenSwap looks for consecutive statements "a = b; b = a;", which
+// leave both variables with the value of b.
+func (s *Analyzer) lintBrokenSwap(stmts []node.Node) {
+	for i := 1; i < len(stmts); i++ {
+		t1, f1, ok1 := plainCopy(stmts[i-1])
+		t2, f2, ok2 := plainCopy(stmts[i])
+		if ok1 && ok2 && t1 == f2 && f1 == t2 {
+			s.warnf(stmts[i], "%w: %q and %q", WarnBrokenSwap, t1, f1)
+		}
+	}
+}
+
+// lintComparisonStmts warns about statements like "a == b;", which compute a
+// comparison only to throw it away. Usually "a = b;" was meant.
+func (s *Analyzer) lintComparisonStmts(stmts ...node.Node) {
+	for _, stmt := range stmts {
+		if b, ok := stmt.(*node.OpBinary); ok && b.Op == node.OPBIN_EQ {
+			s.warnf(stmt, "%w: did you mean to assign with '='?",
+				WarnComparisonAsStmt)
+		}
+	}
+}
+
+// lintConstantCond warns about the condition of a branch or a loop if it
+// folds to a boolean constant, as then it does not depend on anything.
+// It is not called for assertions, because "assert(false)" is a fine way to
+// mark code which should not be reached.
+func (s *Analyzer) lintConstantCond(cond node.Node, name string) {
+	if value, ok := node.EvalConstBool(cond); ok {
+		s.warnf(cond, "%w for %s: always %t", WarnConstantCondition, name, value)
+	}
+}
+
+// C0 characters are ASCII.
+const maxChar = 127
+
+// lintCharIntComp checks an ordering comparison of a char and the int n. A
+// constant within the range of characters, like in "c < 65", is fine, but
+// otherwise the int is probably not meant to be compared with a character.
+func (s *Analyzer) lintCharIntComp(b *node.OpBinary, n node.Node) {
+	if c, ok := node.EvalConst(n); ok && c.Kind == node.CONST_INT &&
+		c.Int >= 0 && c.Int <= maxChar {
+		return
+	}
+	s.warnf(b, "%w: %s", WarnCharIntCompare, n)
+}
+
+// lintLargeStruct warns about structs whose size exceeds the limit. This
+// happens mostly with long chains of structs contained by value.
+func (s *Analyzer) lintLargeStruct(n *node.Struct) {
+	st := s.getStruct(n.Name)
+	if st == nil || s.limits.LargeStruct <= 0 {
+		return
+	}
+	if size, _, ok := st.SizeAlign(); ok && size > s.limits.LargeStruct {
+		s.warnf(n, "%w: %q is %d bytes, limit is %d",
+			WarnLargeStruct, n.Name, size, s.limits.LargeStruct)
+	}
+}
+
+// lintUnusedStructs warns about the structs defined so far which no type has
+// referred to. Only forward-declared structs are not considered. It is run by
+// Analyze only, and each struct is only warned about once.
+func (s *Analyzer) lintUnusedStructs() {
+	for _, n := range s.structdefs {
+		if _, ok := s.structrefs[n.Name]; !ok {
+			s.warnf(n, "%w: %q", WarnUnusedStruct, n.Name)
+		}
+	}
+	s.structdefs = nil
+}
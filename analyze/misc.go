@@ -1,42 +1,93 @@
 package analyze
 
-func IsValidPrimitive(name string) bool {
-	validprimitives := map[string]bool{
-		"int":    true,
-		"bool":   true,
-		"char":   true,
-		"void":   true,
-		"string": true,
-		"struct": true,
+// Dialect contains the words the parser and the analyzer treat specially.
+// Primitives are the names which may begin a type, and reserved words may
+// not be used as identifiers. A dialect of C0 may register more of either
+// with Reserve and AddPrimitive.
+type Dialect struct {
+	primitives map[string]bool
+	reserveds  map[string]bool
+}
+
+// DefaultDialect returns a new Dialect with the words of plain C0.
+func DefaultDialect() *Dialect {
+	ret := &Dialect{
+		primitives: map[string]bool{},
+		reserveds:  map[string]bool{},
 	}
-	_, ok := validprimitives[name]
+	ret.AddPrimitive(defaultprimitives...)
+	ret.Reserve(defaultreserveds...)
+	return ret
+}
+
+var defaultprimitives = []string{
+	"int",
+	"bool",
+	"char",
+	"void",
+	"string",
+	"struct",
+}
+
+var defaultreserveds = []string{
+	"if",
+	"while",
+	"do",
+	"for",
+	"return",
+	"assert",
+	"error",
+	"typedef",
+	"struct",
+	"int",
+	"bool",
+	"void",
+	"string",
+	"char",
+	"NULL",
+	"true",
+	"false",
+	"alloc",
+	"alloc_array",
+	"sizeof",
+	"break",
+	"continue",
+	"goto",
+}
+
+// Reserve makes the words unusable as identifiers.
+func (d *Dialect) Reserve(words ...string) {
+	for _, w := range words {
+		d.reserveds[w] = true
+	}
+}
+
+// AddPrimitive registers names which begin a type like "int" does. They are
+// not reserved unless also given to Reserve.
+func (d *Dialect) AddPrimitive(names ...string) {
+	for _, name := range names {
+		d.primitives[name] = true
+	}
+}
+
+func (d *Dialect) IsValidPrimitive(name string) bool {
+	_, ok := d.primitives[name]
+	return ok
+}
+
+func (d *Dialect) IsReserved(id string) bool {
+	_, ok := d.reserveds[id]
 	return ok
 }
 
-var reserveds = map[string]bool{
-	"if":          true,
-	"while":       true,
-	"for":         true,
-	"return":      true,
-	"assert":      true,
-	"error":       true,
-	"typedef":     true,
-	"struct":      true,
-	"int":         true,
-	"bool":        true,
-	"void":        true,
-	"string":      true,
-	"char":        true,
-	"NULL":        true,
-	"true":        true,
-	"false":       true,
-	"alloc":       true,
-	"alloc_array": true,
-	"break":       true,
-	"continue":    true,
+var defaultdialect = DefaultDialect()
+
+// IsValidPrimitive tells if name is a primitive of the default dialect.
+func IsValidPrimitive(name string) bool {
+	return defaultdialect.IsValidPrimitive(name)
 }
 
+// IsReserved tells if id is reserved in the default dialect.
 func IsReserved(id string) bool {
-	_, ok := reserveds[id]
-	return ok
+	return defaultdialect.IsReserved(id)
 }
@@ -0,0 +1,179 @@
+package analyze
+
+// The code in this file tracks which variables are known to be NULL or
+// non-null. C0's `alloc' and `alloc_array' abort instead of failing, so a
+// variable assigned directly from either is non-null until it is reassigned.
+// Similarly, a variable assigned NULL stays NULL until reassigned, and
+// dereferencing it is an error.
+//
+// As the analysis is a single-pass DFS, we are conservative about control
+// flow: a fact survives a branch only if it holds at the end of every path
+// through it, and variables assigned anywhere inside a loop are forgotten
+// before it. A label may be reached by a goto from anywhere in the function,
+// so nothing is known after one. Within the branches of a condition comparing
+// a variable against NULL, we know what the comparison says about it.
+
+import (
+	"errors"
+
+	"github.com/susji/c0/node"
+)
+
+var ErrNullDeref = errors.New("dereferencing a NULL pointer")
+
+type nullness int
+
+const (
+	nullnessNonNull nullness = iota
+	nullnessNull
+)
+
+func (nn nullness) not() nullness {
+	if nn == nullnessNull {
+		return nullnessNonNull
+	}
+	return nullnessNull
+}
+
+// nullState maps variable names into what we know about their nullness.
+type nullState map[string]nullness
+
+func (ns nullState) copy() nullState {
+	ret := nullState{}
+	for k, v := range ns {
+		ret[k] = v
+	}
+	return ret
+}
+
+// intersect keeps only the facts which are the same in both states.
+func (ns nullState) intersect(other nullState) {
+	for k, v := range ns {
+		if ov, ok := other[k]; !ok || ov != v {
+			delete(ns, k)
+		}
+	}
+}
+
+func isAlloc(n node.Node) bool {
+	switch n.(type) {
+	case *node.Alloc, *node.AllocArray:
+		return true
+	}
+	return false
+}
+
+// trackNull updates the nullness information after an assignment.
+func (s *Analyzer) trackNull(n *node.OpAssign) {
+	var name string
+	switch t := n.To.(type) {
+	case *node.Variable:
+		name = t.Value
+		// The lvalue itself is not a use of the old value.
+		delete(s.res.NonNull, t.Id())
+	case *node.VarDecl:
+		name = t.Name
+	default:
+		return
+	}
+	_, isnull := n.What.(*node.Null)
+	switch {
+	case n.Op == node.OPASN_PLAIN && isAlloc(n.What):
+		s.nullness[name] = nullnessNonNull
+	case n.Op == node.OPASN_PLAIN && isnull:
+		s.nullness[name] = nullnessNull
+	default:
+		delete(s.nullness, name)
+	}
+}
+
+// markNonNull records a variable use if it is known to be non-null.
+func (s *Analyzer) markNonNull(n *node.Variable) {
+	if nn, ok := s.nullness[n.Value]; ok && nn == nullnessNonNull {
+		s.res.NonNull[n.Id()] = struct{}{}
+	}
+}
+
+// checkNullDeref reports dereferencing ptr if ptr is known to be NULL.
+func (s *Analyzer) checkNullDeref(n, ptr node.Node) {
+	v, ok := ptr.(*node.Variable)
+	if !ok {
+		return
+	}
+	if nn, ok := s.nullness[v.Value]; ok && nn == nullnessNull {
+		s.errorf(n, "%w: %q", ErrNullDeref, v.Value)
+	}
+}
+
+// nullTest recognizes conditions comparing a variable against NULL, such as
+// "p != NULL" or "NULL == p". It returns the name of the variable and its
+// nullness when the condition holds.
+func nullTest(cond node.Node) (string, nullness, bool) {
+	b, ok := cond.(*node.OpBinary)
+	if !ok {
+		return "", 0, false
+	}
+	var when nullness
+	switch b.Op {
+	case node.OPBIN_EQ:
+		when = nullnessNull
+	case node.OPBIN_NE:
+		when = nullnessNonNull
+	default:
+		return "", 0, false
+	}
+	v, ok := b.Left.(*node.Variable)
+	other := b.Right
+	if !ok {
+		v, ok = b.Right.(*node.Variable)
+		other = b.Left
+	}
+	if !ok {
+		return "", 0, false
+	}
+	if _, ok := other.(*node.Null); !ok {
+		return "", 0, false
+	}
+	return v.Value, when, true
+}
+
+// withBranches checks the true and false branches of cond so that only the
+// facts surviving both of them remain. A missing branch counts as an empty
+// one. If cond compares a variable against NULL, each branch starts with
+// what the comparison says about it.
+func (s *Analyzer) withBranches(cond, iftrue, iffalse node.Node) {
+	name, when, refine := nullTest(cond)
+	pre := s.nullness
+	post := pre.copy()
+	for i, b := range []node.Node{iftrue, iffalse} {
+		s.nullness = pre.copy()
+		if refine {
+			s.nullness[name] = when
+			if i == 1 {
+				s.nullness[name] = when.not()
+			}
+		}
+		s.check(b)
+		post.intersect(s.nullness)
+	}
+	s.nullness = post
+}
+
+// withNullLoop forgets everything assigned inside the loop before checking
+// it and then forgets whatever the loop body established.
+func (s *Analyzer) withNullLoop(loop node.Node, what func()) {
+	node.Walk(loop, func(n node.Node, _ int) bool {
+		if name, ok := assignedVariable(n); ok {
+			delete(s.nullness, name)
+		}
+		return true
+	})
+	pre := s.nullness.copy()
+	what()
+	s.nullness.intersect(pre)
+}
+
+// forgetNull forgets everything we know, as at labels.
+func (s *Analyzer) forgetNull() {
+	s.nullness = nullState{}
+}
@@ -11,12 +11,18 @@ type TypedefFuncs map[string]*types.Function
 type Structs map[string]*types.Struct
 type StructFwds map[string]*types.StructForward
 type NodeTypes map[node.NodeId]*types.Type
+type NonNull map[node.NodeId]struct{}
+type Sizes map[node.NodeId]int
+type LValues map[node.NodeId]struct{}
 
 // Results should contain everything that should be passed onwards from the
 // analysis stage. This means at least the following things:
 //
 //   1) How the AST nodes are typed
 //   2) What kind of user-defined data (typedefs, structs) we understood
+//   3) Which variable uses are known to be non-null
+//   4) What the sizes given by "sizeof" are
+//   5) Which expressions may be assigned to
 //
 type Results struct {
 	Functions    Functions
@@ -25,4 +31,57 @@ type Results struct {
 	Structs      Structs
 	StructFwds   StructFwds
 	NodeTypes    NodeTypes
+	NonNull      NonNull
+	Sizes        Sizes
+	LValues      LValues
+}
+
+// Canonical returns the type with all typedef layers resolved, see
+// Analyzer.Canonical.
+func (r *Results) Canonical(t *types.Type) *types.Type {
+	if t == nil {
+		return nil
+	}
+	ret := t.Copy()
+	for {
+		td, ok := ret.Extra.(*types.Typedef)
+		if !ok {
+			return ret
+		}
+		ret = &types.Type{
+			Type:         td.Type.Type,
+			PointerLevel: ret.PointerLevel + td.Type.PointerLevel,
+			ArrayLevel:   ret.ArrayLevel + td.Type.ArrayLevel,
+			Extra:        td.Type.Extra,
+		}
+	}
+}
+
+// TypeOf returns the canonical type of the value n evaluates to, or nil if
+// analysis did not give it one.
+func (r *Results) TypeOf(n node.Node) *types.Type {
+	return r.Canonical(r.NodeTypes[n.Id()])
+}
+
+// IsLValue tells if the expression n is a valid target for an assignment,
+// that is, it names a place in memory.
+func (r *Results) IsLValue(n node.Node) bool {
+	_, ok := r.LValues[n.Id()]
+	return ok
+}
+
+// IsNonNull tells if the given variable use is known to be non-null.
+func (r *Results) IsNonNull(n node.Node) bool {
+	_, ok := r.NonNull[n.Id()]
+	return ok
+}
+
+// FoldSizeOf returns the constant a "sizeof" evaluates to. If the size was
+// not known during analysis, the second return value is false.
+func (r *Results) FoldSizeOf(n *node.SizeOf) (*node.Numeric, bool) {
+	size, ok := r.Sizes[n.Id()]
+	if !ok {
+		return nil, false
+	}
+	return node.Store(n.Tok(), &node.Numeric{Value: int32(size), Base: 10}).(*node.Numeric), true
 }
@@ -7,7 +7,7 @@ import (
 	"github.com/susji/c0/types"
 )
 
-var errVarAlreadyDefined = errors.New("variable is already defined")
+var ErrVarAlreadyDefined = errors.New("variable is already defined")
 
 type scope struct {
 	parent *scope
@@ -27,7 +27,7 @@ func (s *scope) add(name string, kind *types.Type) error {
 	// As C0 does not permit any kind of variable shadowing, we have to do a
 	// recursive search before agreeing.
 	if s.get(name) != nil {
-		return errVarAlreadyDefined
+		return ErrVarAlreadyDefined
 	}
 	s.vars[name] = kind
 	return nil
@@ -43,3 +43,14 @@ func (s *scope) get(name string) *types.Type {
 	}
 	return nil
 }
+
+// global tells if name is a variable of the outermost scope, which contains
+// the global variables, when we are not in the outermost scope ourselves.
+func (s *scope) global(name string) bool {
+	root := s
+	for root.parent != nil {
+		root = root.parent
+	}
+	_, ok := root.vars[name]
+	return root != s && ok
+}
@@ -93,6 +93,14 @@ func (s *Analyzer) FunctionFromNodeFunDecl(n *node.FunDecl) (*types.Function, er
 	}, nil
 }
 
+// Canonical returns the type with all typedef layers resolved. A type keeping
+// its typedef identity carries the *types.Typedef as its Extra, and the
+// pointer and array levels accumulate while unwrapping. KindToType already
+// resolves typedefs, so for its types this is merely a copy.
+func (s *Analyzer) Canonical(t *types.Type) *types.Type {
+	return s.res.Canonical(t)
+}
+
 // KindToType transforms parsed variable declarations into Types.
 func (s *Analyzer) KindToType(k *node.Kind) (*types.Type, error) {
 	// We have to perform some impedance matching here. For regular types (int,
@@ -136,6 +144,9 @@ func (s *Analyzer) KindToType(k *node.Kind) (*types.Type, error) {
 		// a;"), whereas only-forward-declared structs are required to be
 		// pointers. The reason is simple: If we only have a
 		// forward-declaration, we do not know the struct's size.
+		if k.Name != s.defining {
+			s.structrefs[k.Name] = struct{}{}
+		}
 		if st := s.getStruct(k.Name); st != nil {
 			t = types.TYPE_STRUCT
 			extra = st
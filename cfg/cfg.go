@@ -27,13 +27,21 @@ const (
 	BLOCKID_EXIT  = 1
 )
 
-var blockid BlockId = BLOCKID_EXIT
-var branchid BranchId = 0
-
 // CFG represents the control-flow path for a single function
 type CFG struct {
 	first  BasicBlock
+	exit   *BasicBlock
 	fundef *node.FunDef
+	// blocks contains every block formed for the function, including the
+	// ones we cannot reach
+	blocks []*BasicBlock
+	// blockid and branchid are the latest IDs given out while forming, so
+	// each function numbers its blocks and branches starting from the same
+	// base.
+	blockid  BlockId
+	branchid BranchId
+	// labels contains the blocks starting at each label
+	labels map[string]*BasicBlock
 }
 
 // BasicBlock contains all permitted statements except branches.
@@ -41,6 +49,8 @@ type BasicBlock struct {
 	Id         BlockId
 	Stmts      Stmts
 	Successors []*Branch
+	// cfg is the graph this block belongs to
+	cfg *CFG
 }
 
 type Branch struct {
@@ -61,6 +71,10 @@ const (
 	BK_FORTRUE
 	BK_FORFALSE
 	BK_ALWAYS
+	BK_DOTRUE
+	BK_DOFALSE
+	BK_ASSERTTRUE
+	BK_ASSERTFALSE
 )
 
 var branchkindnames = [...]string{
@@ -73,6 +87,10 @@ var branchkindnames = [...]string{
 	"for-true",
 	"for-false",
 	"always",
+	"do-true",
+	"do-false",
+	"assert-true",
+	"assert-false",
 }
 
 func (bk BranchKind) String() string {
@@ -84,11 +102,14 @@ type Kind struct {
 	Node node.Node
 }
 
-func newblock() *BasicBlock {
-	blockid++
-	return &BasicBlock{
-		Id: blockid,
+func (c *CFG) newblock() *BasicBlock {
+	c.blockid++
+	bb := &BasicBlock{
+		Id:  c.blockid,
+		cfg: c,
 	}
+	c.blocks = append(c.blocks, bb)
+	return bb
 }
 
 func (c *CFG) First() *BasicBlock {
@@ -98,3 +119,63 @@ func (c *CFG) First() *BasicBlock {
 func (c *CFG) Definition() *node.FunDef {
 	return c.fundef
 }
+
+func (bb *BasicBlock) collect(mem memblock, ret *[]*BasicBlock) {
+	if mem.seen(bb) {
+		return
+	}
+	mem.add(bb)
+	*ret = append(*ret, bb)
+	for _, succ := range bb.Successors {
+		succ.To.collect(mem, ret)
+	}
+}
+
+// Blocks returns all the blocks of the CFG. The order is stable: the blocks
+// reachable from the entry block come first in depth-first preorder followed
+// by unreachable ones, if they have not been pruned.
+func (c *CFG) Blocks() []*BasicBlock {
+	ret := []*BasicBlock{}
+	mem := memblock{}
+	c.first.collect(mem, &ret)
+	for _, bb := range c.blocks {
+		bb.collect(mem, &ret)
+	}
+	return ret
+}
+
+// Branches returns all the branches of the CFG in the order of Blocks.
+func (c *CFG) Branches() []*Branch {
+	ret := []*Branch{}
+	mem := membranch{}
+	for _, bb := range c.Blocks() {
+		for _, succ := range bb.Successors {
+			if mem.seen(succ) {
+				continue
+			}
+			mem.add(succ)
+			ret = append(ret, succ)
+		}
+	}
+	return ret
+}
+
+// PruneUnreachable drops the blocks we cannot reach from the entry block.
+// They are created when statements follow an unconditional return, break or
+// continue. The branches leaving the dropped blocks are removed, so they will
+// not show up as anyone's predecessors either.
+func (c *CFG) PruneUnreachable() {
+	reachable := memblock{}
+	for _, bb := range c.ReversePostorder() {
+		reachable.add(bb)
+	}
+	kept := []*BasicBlock{}
+	for _, bb := range c.blocks {
+		if !reachable.seen(bb) {
+			bb.Successors = nil
+			continue
+		}
+		kept = append(kept, bb)
+	}
+	c.blocks = kept
+}
@@ -1,31 +1,25 @@
 package cfg_test
 
 import (
+	"fmt"
 	"io/ioutil"
+	"strings"
 	"testing"
 
 	"github.com/susji/c0/analyze"
 	"github.com/susji/c0/cfg"
-	"github.com/susji/c0/lex"
+	"github.com/susji/c0/driver"
 	"github.com/susji/c0/node"
-	"github.com/susji/c0/parse"
 	"github.com/susji/c0/testers/assert"
 	"github.com/susji/c0/testers/require"
 )
 
 func nodes(t *testing.T, code string) ([]node.Node, *analyze.Analyzer) {
-	toks, lexerrs := lex.Lex([]rune(code))
-	require.Equal(t, 0, len(lexerrs))
-	p := parse.New()
-	perr := p.Parse(toks)
-	require.Nil(t, perr)
-	nn := p.Nodes()
-	require.NotNil(t, nn)
-	a := analyze.New(p.Fn())
-	aerrs := a.Analyze(nn)
-	t.Log("analysis errors:", aerrs)
-	require.Equal(t, 0, len(aerrs))
-	return nn, a
+	res := driver.Run([]rune(code), driver.Options{})
+	t.Log("errors:", res.Errors)
+	require.Equal(t, 0, len(res.Errors))
+	require.NotNil(t, res.Nodes)
+	return res.Nodes, res.Analyzer
 }
 
 func render(c *cfg.CFG) {
@@ -69,6 +63,28 @@ func matcherret(i int32) cfg.NodeCb {
 	}
 }
 
+// blockwith finds the reachable block containing a statement matching cb.
+func blockwith(t *testing.T, c *cfg.CFG, cb cfg.NodeCb) *cfg.BasicBlock {
+	for _, bb := range c.ReversePostorder() {
+		for _, stmt := range bb.Stmts {
+			if cb(stmt) {
+				return bb
+			}
+		}
+	}
+	t.Fatal("no block found")
+	return nil
+}
+
+func contains(bbs []*cfg.BasicBlock, bb *cfg.BasicBlock) bool {
+	for _, cur := range bbs {
+		if cur == bb {
+			return true
+		}
+	}
+	return false
+}
+
 func TestIfElse(t *testing.T) {
 	n, a := nodes(t, `
 void f() {
@@ -89,6 +105,241 @@ void f() {
 	assert.True(t, c.Connect(nums[0], nums[2]))
 	assert.True(t, c.Connect(nums[0], nums[3]))
 	assert.False(t, c.Connect(nums[1], nums[2]))
+
+	paths := c.Paths(nums[0], nums[3], 10)
+	require.Equal(t, 2, len(paths))
+	for i, path := range paths {
+		require.Equal(t, 3, len(path))
+		assert.Equal(t, blockwith(t, c, nums[0]), path[0])
+		assert.Equal(t, blockwith(t, c, nums[i+1]), path[1])
+		assert.Equal(t, blockwith(t, c, nums[3]), path[2])
+	}
+	assert.Equal(t, 1, len(c.Paths(nums[0], nums[3], 1)))
+	assert.Equal(t, 0, len(c.Paths(nums[1], nums[2], 10)))
+	assert.Equal(t, 2, len(c.Paths(nil, nums[3], 0)))
+}
+
+func TestPathsLoop(t *testing.T) {
+	n, _ := nodes(t, `
+void f(int a) {
+	0;
+	while (a > 0) {
+		1;
+		if (a > 2)
+			2;
+		a = a - 1;
+	}
+	3;
+}`)
+	c, cerrs := cfg.Form(n[0].(*node.FunDef))
+	require.NotNil(t, c)
+	require.Equal(t, 0, len(cerrs))
+
+	nums := matchernums(4)
+	// Going around the loop does not give us more paths, so we have the one
+	// skipping the loop and the ones going through it with and without 2.
+	assert.Equal(t, 3, len(c.Paths(nums[0], nums[3], 0)))
+	// Looping back to the start block ends the path there.
+	assert.Equal(t, 2, len(c.Paths(nums[1], nums[1], 0)))
+	assert.Equal(t, 1, len(c.Paths(nums[2], nums[1], 0)))
+}
+
+func TestTopoOrder(t *testing.T) {
+	type entry struct {
+		code    string
+		acyclic bool
+	}
+	table := []entry{
+		{`
+void f() {
+	0;
+	if (true)
+		1;
+	else
+		2;
+	3;
+}`, true},
+		{`
+int f(int a) {
+	0;
+	if (a > 0) {
+		1;
+		return 1;
+	}
+	2;
+	return 0;
+}`, true},
+		{`
+void f() {
+	0;
+	for (int i = 0; i < 10; i++) {
+		1;
+	}
+	2;
+}`, false},
+		{`
+void f() {
+	0;
+	do {
+		1;
+	} while (false);
+	2;
+}`, false},
+	}
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			n, _ := nodes(t, cur.code)
+			c, cerrs := cfg.Form(n[0].(*node.FunDef))
+			require.NotNil(t, c)
+			require.Equal(t, 0, len(cerrs))
+
+			order, acyclic := c.TopoOrder()
+			assert.Equal(t, cur.acyclic, acyclic)
+			assert.Equal(t, c.ReversePostorder(), order)
+			require.True(t, len(order) > 2)
+			assert.Equal(t, c.First(), order[0])
+			assert.Equal(t, cfg.BlockId(cfg.BLOCKID_EXIT), order[len(order)-1].Id)
+			if !acyclic {
+				return
+			}
+			index := map[*cfg.BasicBlock]int{}
+			for i, bb := range order {
+				index[bb] = i
+			}
+			for _, br := range c.Branches() {
+				assert.True(t, index[br.From] < index[br.To])
+			}
+		})
+	}
+}
+
+func TestBlocksBranches(t *testing.T) {
+	n, _ := nodes(t, `
+void f() {
+	0;
+	if (true)
+		1;
+	else
+		2;
+	3;
+}`)
+	c, cerrs := cfg.Form(n[0].(*node.FunDef))
+	require.NotNil(t, c)
+	require.Equal(t, 0, len(cerrs))
+
+	// entry, 0, 1, 2, 3, exit
+	blocks := c.Blocks()
+	require.Equal(t, 6, len(blocks))
+	assert.Equal(t, c.First(), blocks[0])
+	assert.Equal(t, blocks, c.Blocks())
+	nums := matchernums(4)
+	for _, num := range nums {
+		found := 0
+		for _, bb := range blocks {
+			if len(bb.Stmts) == 1 && num(bb.Stmts[0]) {
+				found++
+			}
+		}
+		assert.Equal(t, 1, found)
+	}
+
+	branches := c.Branches()
+	require.Equal(t, 6, len(branches))
+	assert.Equal(t, branches, c.Branches())
+	kinds := map[cfg.BranchKind]int{}
+	for _, br := range branches {
+		kinds[br.Kind.Kind]++
+	}
+	assert.Equal(t, map[cfg.BranchKind]int{
+		cfg.BK_ALWAYS:  4,
+		cfg.BK_IFTRUE:  1,
+		cfg.BK_IFFALSE: 1,
+	}, kinds)
+}
+
+func TestIdsPerFunction(t *testing.T) {
+	code := `
+int a(int x) { while (x > 0) { x--; } return x; }
+int b(int x) { while (x > 0) { x--; } return x; }
+`
+	n, _ := nodes(t, code)
+	require.Equal(t, 2, len(n))
+	c1, _ := cfg.Form(n[0].(*node.FunDef))
+	c2, _ := cfg.Form(n[1].(*node.FunDef))
+	// Forming the same function again has to give the same IDs, too.
+	c3, _ := cfg.Form(n[0].(*node.FunDef))
+	ids := func(c *cfg.CFG) ([]cfg.BlockId, []cfg.BranchId) {
+		blocks := []cfg.BlockId{}
+		for _, bb := range c.Blocks() {
+			blocks = append(blocks, bb.Id)
+		}
+		branches := []cfg.BranchId{}
+		for _, br := range c.Branches() {
+			branches = append(branches, br.Id)
+		}
+		return blocks, branches
+	}
+	bb1, br1 := ids(c1)
+	bb2, br2 := ids(c2)
+	bb3, br3 := ids(c3)
+	assert.Equal(t, bb1, bb2)
+	assert.Equal(t, br1, br2)
+	assert.Equal(t, bb1, bb3)
+	assert.Equal(t, br1, br3)
+	assert.Equal(t, c1.Dot(), c3.Dot())
+}
+
+func TestFormConcurrent(t *testing.T) {
+	n, _ := nodes(t, "int a(int x) { if (x > 0) { x--; } return x; }")
+	fd := n[0].(*node.FunDef)
+	want, _ := cfg.Form(fd)
+	dots := make(chan string)
+	for i := 0; i < 8; i++ {
+		go func() {
+			c, _ := cfg.Form(fd)
+			dots <- c.Dot()
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		assert.Equal(t, want.Dot(), <-dots)
+	}
+}
+
+func TestDot(t *testing.T) {
+	code := `
+int a(int x) {
+	if (x < 0) {
+		return 0;
+	}
+	while (x > 10) {
+		x--;
+	}
+	return x;
+}`
+	n, _ := nodes(t, code)
+	c, _ := cfg.Form(n[0].(*node.FunDef))
+	dot := c.Dot()
+	t.Log(dot)
+	for _, want := range []string{
+		"digraph cfg {",
+		`label="entry"`,
+		`label="exit"`,
+		`if-true\lcond: (< x 0)\l`,
+		`if-no-else\lcond: (< x 0)\l`,
+		`while-true\lcond: (> x 10)\l`,
+		`while-false\lcond: (> x 10)\l`,
+		`always\l`,
+		`(return 0)`,
+		`[block #`,
+	} {
+		assert.True(t, strings.Contains(dot, want))
+	}
+	assert.True(t, strings.HasSuffix(dot, "}\n"))
+	// Each block is declared exactly once.
+	for _, bb := range c.Blocks() {
+		decl := fmt.Sprintf("    block_%d [label=", bb.Id)
+		assert.Equal(t, 1, strings.Count(dot, decl))
+	}
 }
 
 func TestIfEarlyReturn(t *testing.T) {
@@ -120,6 +371,235 @@ int a() {
 	assert.False(t, c.Connect(nums[1], retsecond))
 }
 
+func TestPruneUnreachable(t *testing.T) {
+	n, _ := nodes(t, `
+int a(bool c) {
+	0;
+	if (c) {
+		1;
+		return 10;
+	} else {
+		2;
+		return 20;
+	}
+	3;
+	return 30;
+}`)
+	c, cerrs := cfg.Form(n[0].(*node.FunDef))
+	require.NotNil(t, c)
+	require.Equal(t, 0, len(cerrs))
+	nums := matchernums(4)
+	orphan := func() bool {
+		for _, bb := range c.Blocks() {
+			for _, stmt := range bb.Stmts {
+				if nums[3](stmt) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	require.True(t, orphan())
+	assert.True(t, strings.Contains(c.Dot(), "return 30"))
+	before := len(c.Blocks())
+
+	c.PruneUnreachable()
+	assert.False(t, orphan())
+	assert.Equal(t, before-1, len(c.Blocks()))
+	assert.False(t, strings.Contains(c.Dot(), "return 30"))
+	assert.False(t, c.Connect(nil, nums[3]))
+	assert.True(t, c.Connect(nums[0], nums[1]))
+	assert.True(t, c.Connect(nums[0], nums[2]))
+	for _, bb := range c.Blocks() {
+		assert.Equal(t, len(bb.Successors) > 0, bb.Id != cfg.BLOCKID_EXIT)
+	}
+	// Pruning reachable structure is a no-op.
+	c.PruneUnreachable()
+	assert.Equal(t, before-1, len(c.Blocks()))
+}
+
+func TestErrorExits(t *testing.T) {
+	n, _ := nodes(t, `
+int a(bool c) {
+	0;
+	if (c) {
+		1;
+		error("boom");
+		2;
+	}
+	return 3;
+}`)
+	c, cerrs := cfg.Form(n[0].(*node.FunDef))
+	require.NotNil(t, c)
+	require.Equal(t, 0, len(cerrs))
+	nums := matchernums(3)
+	bb := blockwith(t, c, nums[1])
+	require.Equal(t, 1, len(bb.Successors))
+	assert.Equal(t, cfg.BlockId(cfg.BLOCKID_EXIT), bb.Successors[0].To.Id)
+	_, ok := bb.Stmts[len(bb.Stmts)-1].(*node.Error)
+	assert.True(t, ok)
+	assert.True(t, c.Connect(nums[0], nums[1]))
+	assert.False(t, c.Connect(nums[1], matcherret(3)))
+	// Whatever follows error() is unreachable.
+	assert.False(t, c.Connect(nil, nums[2]))
+}
+
+func TestErrorInLoop(t *testing.T) {
+	n, _ := nodes(t, `
+void a(bool c) {
+	0;
+	while (c) {
+		1;
+		error("boom");
+		2;
+	}
+	3;
+}`)
+	c, cerrs := cfg.Form(n[0].(*node.FunDef))
+	require.NotNil(t, c)
+	require.Equal(t, 0, len(cerrs))
+	nums := matchernums(4)
+	assert.True(t, c.Connect(nums[0], nums[1]))
+	assert.True(t, c.Connect(nums[0], nums[3]))
+	// The body never gets back to the condition, so the loop is left only
+	// when the condition is false to begin with.
+	assert.False(t, c.Connect(nums[1], nums[3]))
+	assert.False(t, c.Connect(nums[1], nums[1]))
+	assert.False(t, c.Connect(nil, nums[2]))
+
+	before := len(c.Blocks())
+	c.PruneUnreachable()
+	assert.True(t, len(c.Blocks()) < before)
+	for _, bb := range c.Blocks() {
+		for _, stmt := range bb.Stmts {
+			assert.False(t, nums[2](stmt))
+		}
+	}
+}
+
+func TestAssertBranches(t *testing.T) {
+	n, _ := nodes(t, `
+int a(int x) {
+	0;
+	assert(x > 0);
+	1;
+	return x;
+}`)
+	c, cerrs := cfg.Form(n[0].(*node.FunDef))
+	require.NotNil(t, c)
+	require.Equal(t, 0, len(cerrs))
+	nums := matchernums(2)
+	bb := blockwith(t, c, nums[0])
+	_, ok := bb.Stmts[len(bb.Stmts)-1].(*node.Assert)
+	require.True(t, ok)
+	require.Equal(t, 2, len(bb.Successors))
+	holds, fails := bb.Successors[0], bb.Successors[1]
+	assert.Equal(t, cfg.BranchKind(cfg.BK_ASSERTTRUE), holds.Kind.Kind)
+	assert.Equal(t, cfg.BranchKind(cfg.BK_ASSERTFALSE), fails.Kind.Kind)
+	assert.Equal(t, blockwith(t, c, nums[1]), holds.To)
+	assert.Equal(t, cfg.BlockId(cfg.BLOCKID_EXIT), fails.To.Id)
+	// Everything after the assert may assume it held.
+	assert.Equal(t, bb, c.Dominators()[holds.To])
+	assert.True(t, strings.Contains(c.Dot(), "assert-false"))
+}
+
+func TestAssertFold(t *testing.T) {
+	type entry struct {
+		code string
+		// reached tells if the statement after the assert is reachable
+		reached bool
+	}
+	table := []entry{
+		{"void a() { 0; assert(true); 1; }", true},
+		{"void a() { 0; assert(false); 1; }", false},
+		{"void a() { 0; assert(1 < 2); 1; }", true},
+	}
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			n, _ := nodes(t, cur.code)
+			c, cerrs := cfg.Form(n[0].(*node.FunDef))
+			require.Equal(t, 0, len(cerrs))
+			c.FoldConstants()
+			bb := blockwith(t, c, matchernum(0))
+			require.Equal(t, 1, len(bb.Successors))
+			assert.Equal(t, cur.reached, c.Connect(nil, matchernum(1)))
+		})
+	}
+}
+
+func matchercall(name string) cfg.NodeCb {
+	return func(n node.Node) bool {
+		if t, ok := n.(*node.OpBinary); ok && t.Op == node.OPBIN_FUNCALL {
+			return t.Left.(*node.Variable).Value == name
+		}
+		return false
+	}
+}
+
+func TestFoldConstants(t *testing.T) {
+	type entry struct {
+		code        string
+		dead, alive []string
+	}
+	table := []entry{
+		{
+			"void f() { if (false) { dead(); } live(); }",
+			[]string{"dead"},
+			[]string{"live"},
+		},
+		{
+			"void f() { if (1 < 2) { live(); } else { dead(); } live2(); }",
+			[]string{"dead"},
+			[]string{"live", "live2"},
+		},
+		{
+			"void f() { while (!true) { dead(); } live(); }",
+			[]string{"dead"},
+			[]string{"live"},
+		},
+		{
+			"void f() { while (true) { live(); } dead(); }",
+			[]string{"dead"},
+			[]string{"live"},
+		},
+		{
+			"void f(bool x) { if (x) { live(); } else { live2(); } }",
+			nil,
+			[]string{"live", "live2"},
+		},
+		{
+			"void f(int x) { if (x / 0 == 1) { live(); } live2(); }",
+			nil,
+			[]string{"live", "live2"},
+		},
+	}
+	decls := "void dead(); void live(); void live2();"
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			n, _ := nodes(t, decls+cur.code)
+			c, _ := cfg.Form(n[len(n)-1].(*node.FunDef))
+			c.FoldConstants()
+			for _, name := range cur.dead {
+				assert.False(t, c.Connect(nil, matchercall(name)))
+			}
+			for _, name := range cur.alive {
+				assert.True(t, c.Connect(nil, matchercall(name)))
+			}
+			for _, bb := range c.Blocks() {
+				assert.True(t, len(bb.Successors) <= 2)
+			}
+		})
+	}
+}
+
+func TestFoldConstantsKeepsBoth(t *testing.T) {
+	n, _ := nodes(t, "void a(); void b(); void f(bool x) { if (x) { a(); } else { b(); } }")
+	c, _ := cfg.Form(n[2].(*node.FunDef))
+	before := len(c.Branches())
+	c.FoldConstants()
+	assert.Equal(t, before, len(c.Branches()))
+}
+
 func TestIfHarder(t *testing.T) {
 	n, a := nodes(t, `
 int a() {
@@ -205,9 +685,186 @@ int a() {
 	assert.True(t, c.Connect(nums[0], nums[3]))
 	assert.True(t, c.Connect(nums[0], ret))
 	assert.False(t, c.Connect(nums[3], nums[1]))
+
+	b := func(cb cfg.NodeCb) *cfg.BasicBlock { return blockwith(t, c, cb) }
+	idom := c.Dominators()
+	assert.Equal(t, c.First(), idom[c.First()])
+	assert.Equal(t, b(nums[0]), idom[b(nums[1])])
+	assert.Equal(t, b(nums[1]), idom[b(nums[2])])
+	assert.Equal(t, b(nums[1]), idom[b(nums[3])])
+	assert.Equal(t, b(nums[0]), idom[b(ret)])
+	df := c.DominanceFrontier()
+	assert.True(t, contains(df[b(nums[2])], b(nums[3])))
+	// The loop header's frontier contains itself because of the back edge.
+	assert.True(t, contains(df[b(nums[1])], b(nums[1])))
+	assert.True(t, contains(df[b(nums[1])], b(ret)))
+	assert.Equal(t, 0, len(df[b(nums[0])]))
+	//render(c)
+}
+
+func TestDoWhileSimple(t *testing.T) {
+	n, a := nodes(t, `
+int a() {
+	int i;
+	0;
+	do {
+		1;
+		if (i > 5) {
+			2;
+		}
+		3;
+		i++;
+	} while (i < 10);
+	return 10;
+}`)
+	c, cerrs := cfg.Form(n[0].(*node.FunDef))
+	_ = a
+	require.NotNil(t, c)
+	require.Equal(t, 0, len(cerrs))
+
+	nums := matchernums(4)
+	ret := matcherret(10)
+	assert.True(t, c.Connect(nil, ret))
+	assert.True(t, c.Connect(nums[0], nums[1]))
+	assert.True(t, c.Connect(nums[0], nums[2]))
+	assert.True(t, c.Connect(nums[0], nums[3]))
+	assert.True(t, c.Connect(nums[0], ret))
+
+	b := func(cb cfg.NodeCb) *cfg.BasicBlock { return blockwith(t, c, cb) }
+	// The body is always entered without testing the condition.
+	require.Equal(t, 1, len(b(nums[0]).Successors))
+	assert.Equal(t, cfg.BranchKind(cfg.BK_ALWAYS), b(nums[0]).Successors[0].Kind.Kind)
+	assert.Equal(t, b(nums[1]), b(nums[0]).Successors[0].To)
+	kinds := map[cfg.BranchKind]int{}
+	for _, br := range c.Branches() {
+		kinds[br.Kind.Kind]++
+	}
+	assert.Equal(t, 1, kinds[cfg.BK_DOTRUE])
+	assert.Equal(t, 1, kinds[cfg.BK_DOFALSE])
+
+	idom := c.Dominators()
+	assert.Equal(t, b(nums[0]), idom[b(nums[1])])
+	assert.Equal(t, b(nums[1]), idom[b(nums[3])])
+	// Unlike with "while", the return is only reached through the body.
+	assert.True(t, idom[b(ret)] != b(nums[0]))
 	//render(c)
 }
 
+func TestGoto(t *testing.T) {
+	n, _ := nodes(t, `
+int a(int i) {
+	0;
+	if (i > 5)
+		goto skip;
+	1;
+	goto skip;
+	2;
+skip:
+	3;
+	return 10;
+}`)
+	c, cerrs := cfg.Form(n[0].(*node.FunDef))
+	require.NotNil(t, c)
+	require.Equal(t, 0, len(cerrs))
+
+	nums := matchernums(4)
+	ret := matcherret(10)
+	assert.True(t, c.Connect(nums[0], nums[1]))
+	assert.True(t, c.Connect(nums[0], nums[3]))
+	assert.True(t, c.Connect(nums[1], nums[3]))
+	assert.True(t, c.Connect(nums[3], ret))
+	// The statement following the goto cannot be reached.
+	assert.False(t, c.Connect(nil, nums[2]))
+
+	b := func(cb cfg.NodeCb) *cfg.BasicBlock { return blockwith(t, c, cb) }
+	preds := c.Predecessors()
+	assert.Equal(t, 2, len(preds[b(nums[3])]))
+	//render(c)
+}
+
+func TestForInfinite(t *testing.T) {
+	n, _ := nodes(t, `
+int a() {
+	int i = 0;
+	0;
+	for (;;) {
+		1;
+		;
+		if (i > 5)
+			break;
+		i++;
+	}
+	2;
+	return 10;
+}`)
+	c, cerrs := cfg.Form(n[0].(*node.FunDef))
+	require.NotNil(t, c)
+	require.Equal(t, 0, len(cerrs))
+
+	nums := matchernums(3)
+	ret := matcherret(10)
+	assert.True(t, c.Connect(nums[0], nums[1]))
+	assert.True(t, c.Connect(nums[1], nums[2]))
+	assert.True(t, c.Connect(nums[2], ret))
+
+	b := func(cb cfg.NodeCb) *cfg.BasicBlock { return blockwith(t, c, cb) }
+	// The loop is always entered and only left through "break".
+	require.Equal(t, 1, len(b(nums[0]).Successors))
+	assert.Equal(t, cfg.BranchKind(cfg.BK_ALWAYS), b(nums[0]).Successors[0].Kind.Kind)
+	assert.Equal(t, b(nums[1]), b(nums[0]).Successors[0].To)
+	for _, br := range c.Branches() {
+		assert.True(t, br.Kind.Kind != cfg.BK_FORTRUE && br.Kind.Kind != cfg.BK_FORFALSE)
+	}
+	// Empty statements are dropped.
+	for _, bb := range c.Blocks() {
+		for _, stmt := range bb.Stmts {
+			_, ok := stmt.(*node.Empty)
+			assert.False(t, ok)
+		}
+	}
+	preds := c.Predecessors()[b(nums[2])]
+	require.Equal(t, 1, len(preds))
+	_, ok := preds[0].Kind.Node.(*node.For)
+	assert.True(t, ok)
+	assert.Equal(t, cfg.BranchKind(cfg.BK_ALWAYS), preds[0].Kind.Kind)
+}
+
+func TestForEmptyClauses(t *testing.T) {
+	n, _ := nodes(t, `
+int a() {
+	0;
+	for (int i = 0; ; i++) {
+		1;
+		if (i > 5)
+			break;
+	}
+	for (int j = 0; j < 5;) {
+		2;
+		j++;
+	}
+	3;
+	return 10;
+}`)
+	c, cerrs := cfg.Form(n[0].(*node.FunDef))
+	require.NotNil(t, c)
+	require.Equal(t, 0, len(cerrs))
+
+	nums := matchernums(4)
+	assert.True(t, c.Connect(nums[0], nums[1]))
+	assert.True(t, c.Connect(nums[1], nums[2]))
+	assert.True(t, c.Connect(nums[2], nums[3]))
+	assert.True(t, c.Connect(nums[3], matcherret(10)))
+
+	kinds := map[cfg.BranchKind]int{}
+	for _, br := range c.Branches() {
+		kinds[br.Kind.Kind]++
+	}
+	// Only the second loop tests a condition: once when entering it and once
+	// after each iteration.
+	assert.Equal(t, 2, kinds[cfg.BK_FORTRUE])
+	assert.Equal(t, 2, kinds[cfg.BK_FORFALSE])
+}
+
 func TestForSimple(t *testing.T) {
 	n, a := nodes(t, `
 int a() {
@@ -259,7 +916,6 @@ int a() {
 			i--;
 		}
 		6;
-		j;
 	}
 	7;
 	return 10;
@@ -276,6 +932,22 @@ int a() {
 	assert.True(t, c.Connect(nums[6], nums[7]))
 	assert.False(t, c.Connect(nums[1], nums[4]))
 	assert.False(t, c.Connect(nums[3], nums[6]))
+
+	b := func(cb cfg.NodeCb) *cfg.BasicBlock { return blockwith(t, c, cb) }
+	idom := c.Dominators()
+	for _, i := range []int{1, 4, 7} {
+		assert.Equal(t, b(nums[0]), idom[b(nums[i])])
+	}
+	assert.Equal(t, b(nums[1]), idom[b(nums[2])])
+	assert.Equal(t, b(nums[1]), idom[b(nums[3])])
+	assert.Equal(t, b(nums[4]), idom[b(nums[5])])
+	assert.Equal(t, b(nums[4]), idom[b(nums[6])])
+	df := c.DominanceFrontier()
+	assert.True(t, contains(df[b(nums[1])], b(nums[7])))
+	assert.True(t, contains(df[b(nums[3])], b(nums[7])))
+	assert.True(t, contains(df[b(nums[4])], b(nums[7])))
+	assert.True(t, contains(df[b(nums[6])], b(nums[7])))
+	assert.False(t, contains(df[b(nums[1])], b(nums[4])))
 	//render(c)
 }
 
@@ -103,3 +103,83 @@ func (c *CFG) Connect(start, end NodeCb) bool {
 	}
 	return connect(start, end, &c.first, membranch{})
 }
+
+// pathfinder enumerates the simple paths from a block to the blocks
+// containing the end node. A block is never repeated within a path, which
+// keeps loops from producing infinitely many paths.
+type pathfinder struct {
+	end    NodeCb
+	limit  int
+	path   []*BasicBlock
+	onpath memblock
+	found  [][]*BasicBlock
+}
+
+func (pf *pathfinder) full() bool {
+	return pf.limit > 0 && len(pf.found) >= pf.limit
+}
+
+func (pf *pathfinder) record(last *BasicBlock) {
+	path := make([]*BasicBlock, 0, len(pf.path)+1)
+	path = append(path, pf.path...)
+	path = append(path, last)
+	pf.found = append(pf.found, path)
+}
+
+func (pf *pathfinder) walk(b *BasicBlock) {
+	pf.path = append(pf.path, b)
+	pf.onpath.add(b)
+	for _, succ := range b.Successors {
+		if pf.full() {
+			break
+		}
+		switch {
+		case nodeinblock(pf.end, 0, succ.To) > -1:
+			// The path ends at the first block with the end node. This may
+			// also be the block we started from if we looped back to it.
+			pf.record(succ.To)
+		case !pf.onpath.seen(succ.To):
+			pf.walk(succ.To)
+		}
+	}
+	delete(pf.onpath, b.Id)
+	pf.path = pf.path[:len(pf.path)-1]
+}
+
+// Paths returns up to limit distinct sequences of blocks leading from a block
+// with the start node to a block with the end node. Like with Connect, a nil
+// start means function start. Each path ends at the first block containing the
+// end node and visits every block at most once, so going around loops does not
+// produce more paths. A limit less than one means no limit at all.
+func (c *CFG) Paths(start, end NodeCb, limit int) [][]*BasicBlock {
+	if end == nil {
+		panic("no end cb")
+	}
+	pf := &pathfinder{end: end, limit: limit, onpath: memblock{}}
+	starts := []*BasicBlock{&c.first}
+	if start != nil {
+		starts = nil
+		for _, b := range c.Blocks() {
+			if nodeinblock(start, 0, b) > -1 {
+				starts = append(starts, b)
+			}
+		}
+	}
+	for _, b := range starts {
+		if pf.full() {
+			break
+		}
+		var iend int
+		if start == nil {
+			iend = nodeinblock(end, 0, b)
+		} else {
+			_, iend = nodesinblock(start, end, b)
+		}
+		if iend > -1 {
+			pf.record(b)
+			continue
+		}
+		pf.walk(b)
+	}
+	return pf.found
+}
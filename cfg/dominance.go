@@ -0,0 +1,122 @@
+package cfg
+
+// The contents of this file compute dominance information of a CFG. We use
+// the iterative algorithm described by Cooper, Harvey & Kennedy in "A Simple,
+// Fast Dominance Algorithm":
+//
+//    https://www.cs.rice.edu/~keith/EMBED/dom.pdf
+//
+// Only blocks reachable from the function entry are considered. Loops create
+// cycles in the graph, which is why traversal is memoized.
+
+func postorder(bb *BasicBlock, mem memblock, po *[]*BasicBlock) {
+	mem.add(bb)
+	// Successors are visited backwards so that the first one, that is, the
+	// true branch, comes first in reverse postorder.
+	for i := len(bb.Successors) - 1; i >= 0; i-- {
+		if succ := bb.Successors[i]; !mem.seen(succ.To) {
+			postorder(succ.To, mem, po)
+		}
+	}
+	*po = append(*po, bb)
+}
+
+// ReversePostorder returns the blocks reachable from the entry so that each
+// block comes before its successors, ignoring loop back edges.
+func (c *CFG) ReversePostorder() []*BasicBlock {
+	po := []*BasicBlock{}
+	postorder(c.First(), memblock{}, &po)
+	ret := make([]*BasicBlock, len(po))
+	for i, bb := range po {
+		ret[len(po)-1-i] = bb
+	}
+	return ret
+}
+
+// Predecessors returns the incoming branches of each reachable block.
+func (c *CFG) Predecessors() map[*BasicBlock][]*Branch {
+	ret := map[*BasicBlock][]*Branch{}
+	for _, bb := range c.ReversePostorder() {
+		for _, succ := range bb.Successors {
+			ret[succ.To] = append(ret[succ.To], succ)
+		}
+	}
+	return ret
+}
+
+// Dominators returns the immediate dominator of each reachable block. The
+// entry block is its own immediate dominator.
+func (c *CFG) Dominators() map[*BasicBlock]*BasicBlock {
+	order := c.ReversePostorder()
+	preds := c.Predecessors()
+	index := map[*BasicBlock]int{}
+	for i, bb := range order {
+		index[bb] = i
+	}
+	idom := map[*BasicBlock]*BasicBlock{}
+	intersect := func(b1, b2 *BasicBlock) *BasicBlock {
+		for b1 != b2 {
+			for index[b1] > index[b2] {
+				b1 = idom[b1]
+			}
+			for index[b2] > index[b1] {
+				b2 = idom[b2]
+			}
+		}
+		return b1
+	}
+
+	idom[order[0]] = order[0]
+	for changed := true; changed; {
+		changed = false
+		for _, bb := range order[1:] {
+			var newidom *BasicBlock
+			for _, pred := range preds[bb] {
+				if _, ok := idom[pred.From]; !ok {
+					continue
+				}
+				if newidom == nil {
+					newidom = pred.From
+				} else {
+					newidom = intersect(pred.From, newidom)
+				}
+			}
+			if idom[bb] != newidom {
+				idom[bb] = newidom
+				changed = true
+			}
+		}
+	}
+	return idom
+}
+
+// DominanceFrontier returns the dominance frontier of each reachable block,
+// that is, the blocks where its dominance ends. Blocks without a frontier are
+// not present.
+func (c *CFG) DominanceFrontier() map[*BasicBlock][]*BasicBlock {
+	idom := c.Dominators()
+	preds := c.Predecessors()
+	entry := c.First()
+	ret := map[*BasicBlock][]*BasicBlock{}
+	seen := map[*BasicBlock]memblock{}
+	for _, bb := range c.ReversePostorder() {
+		if len(preds[bb]) < 2 {
+			continue
+		}
+		for _, pred := range preds[bb] {
+			for runner := pred.From; runner != idom[bb]; runner = idom[runner] {
+				if seen[runner] == nil {
+					seen[runner] = memblock{}
+				}
+				if !seen[runner].seen(bb) {
+					seen[runner].add(bb)
+					ret[runner] = append(ret[runner], bb)
+				}
+				if runner == entry {
+					break
+				}
+			}
+		}
+	}
+	return ret
+}
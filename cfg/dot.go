@@ -17,6 +17,9 @@ func (bb *BasicBlock) Dot(b *strings.Builder, memblock memblock, membranch membr
 	if memblock.seen(bb) {
 		return
 	}
+	// Mark the block before following its successors, so a block reached
+	// again via a loop is not declared twice.
+	memblock.add(bb)
 	bs := &strings.Builder{}
 	switch bb.Id {
 	case BLOCKID_ENTRY:
@@ -34,7 +37,26 @@ func (bb *BasicBlock) Dot(b *strings.Builder, memblock memblock, membranch membr
 	for _, succ := range bb.Successors {
 		succ.Dot(b, memblock, membranch)
 	}
-	memblock.add(bb)
+}
+
+// cond returns the condition driving a branch or nil if there is none.
+func (k Kind) cond() node.Node {
+	switch k.Kind {
+	case BK_IFTRUE, BK_IFFALSE, BK_IFNOELSE:
+		return k.Node.(*node.If).Cond
+	case BK_WHILETRUE, BK_WHILEFALSE:
+		return k.Node.(*node.While).Cond
+	case BK_FORTRUE, BK_FORFALSE:
+		return k.Node.(*node.For).Cond
+	case BK_DOTRUE, BK_DOFALSE:
+		return k.Node.(*node.DoWhile).Cond
+	case BK_ASSERTTRUE, BK_ASSERTFALSE:
+		return k.Node.(*node.Assert).Expr
+	case BK_ALWAYS:
+		return nil
+	default:
+		panic("unknown branching kind: " + k.Kind.String())
+	}
 }
 
 func (b *Branch) Dot(db *strings.Builder, memblock memblock, membranch membranch) {
@@ -45,16 +67,8 @@ func (b *Branch) Dot(db *strings.Builder, memblock memblock, membranch membranch
 	}
 	b.To.Dot(db, memblock, membranch)
 	label := b.Kind.Kind.String() + "\n"
-	switch b.Kind.Kind {
-	case BK_ALWAYS:
-	case BK_IFTRUE, BK_IFFALSE, BK_IFNOELSE:
-		label += "cond: " + b.Kind.Node.(*node.If).Cond.String()
-	case BK_WHILETRUE, BK_WHILEFALSE:
-		label += "cond: " + b.Kind.Node.(*node.While).Cond.String()
-	case BK_FORTRUE, BK_FORFALSE:
-		label += "cond: " + b.Kind.Node.(*node.For).Cond.String()
-	default:
-		panic("unknown branching kind: " + b.Kind.Kind.String())
+	if cond := b.Kind.cond(); cond != nil {
+		label += "cond: " + cond.String() + "\n"
 	}
 	db.WriteString(
 		fmt.Sprintf("    %s -> %s [label=%s];\n",
@@ -86,7 +100,12 @@ digraph cfg {
     labelloc = "t";
 `)
 	b.WriteString(fmt.Sprintf("    label = %s;\n", multiline(c.renderFunDef())))
-	c.first.Dot(b, memblock{}, membranch{})
+	mb := memblock{}
+	c.first.Dot(b, mb, membranch{})
+	// Unreachable blocks are rendered as their own islands.
+	for _, bb := range c.blocks {
+		bb.Dot(b, mb, membranch{})
+	}
 	b.WriteString("}\n")
 	return b.String()
 }
@@ -0,0 +1,41 @@
+package cfg
+
+import (
+	"github.com/susji/c0/node"
+)
+
+// whenTrue tells if a conditional branch is taken when its condition holds.
+func (bk BranchKind) whenTrue() bool {
+	switch bk {
+	case BK_IFTRUE, BK_WHILETRUE, BK_FORTRUE, BK_DOTRUE, BK_ASSERTTRUE:
+		return true
+	}
+	return false
+}
+
+// FoldConstants removes the conditional branches which can never be taken
+// because their condition is a boolean constant, like in "if (false)". Only
+// conditions consisting of literals are considered, see node.EvalConst. The
+// blocks we can no longer reach may be dropped with PruneUnreachable.
+func (c *CFG) FoldConstants() {
+	for _, bb := range c.Blocks() {
+		if len(bb.Successors) != 2 {
+			continue
+		}
+		cond := bb.Successors[0].Kind.cond()
+		if cond == nil {
+			continue
+		}
+		v, ok := node.EvalConstBool(cond)
+		if !ok {
+			continue
+		}
+		kept := []*Branch{}
+		for _, succ := range bb.Successors {
+			if succ.Kind.Kind.whenTrue() == v {
+				kept = append(kept, succ)
+			}
+		}
+		bb.Successors = kept
+	}
+}
@@ -4,8 +4,8 @@ package cfg
 // simple recursion, that is, we assume our branching depth will be low.
 //
 // As may be seen below, we form basic blocks by appending statement nodes
-// until we hit a branching node (if, for, while). At that point, each
-// branching node is used to create further edges.
+// until we hit a branching node (if, for, while, do-while, assert). At that
+// point, each branching node is used to create further edges.
 //
 // When recursing, we pass around "branch parent", which tell what is the
 // "parent basic block" and how to reach it. See the example below, where this
@@ -52,45 +52,44 @@ type branchLoop struct {
 	onBreak, onContinue func(*BasicBlock)
 }
 
-var blockEntry = BasicBlock{
-	Id:         BLOCKID_ENTRY,
-	Stmts:      Stmts{},
-	Successors: []*Branch{},
-}
-
-var blockExit = &BasicBlock{
-	Id:         BLOCKID_EXIT,
-	Stmts:      Stmts{},
-	Successors: []*Branch{},
-}
-
 func (bb *BasicBlock) newstmt(n node.Node) {
+	// Declarations with multiple declarators are flattened, so the later
+	// stages will see each declaration as its own statement.
+	if dl, ok := n.(*node.VarDeclList); ok {
+		bb.Stmts = append(bb.Stmts, dl.Value...)
+		return
+	}
 	bb.Stmts = append(bb.Stmts, n)
 }
 
 func (bb *BasicBlock) newsucc(rp *branchParent) {
 	if rp.to == nil {
-		rp.to = blockExit
+		rp.to = bb.cfg.exit
 	}
-	branchid++
+	bb.cfg.branchid++
 	bb.Successors = append(bb.Successors, &Branch{
-		Id:   branchid,
+		Id:   bb.cfg.branchid,
 		Kind: Kind{Node: rp.node, Kind: rp.how},
 		From: bb,
 		To:   rp.to,
 	})
 }
 
+// newloop forms a loop with the given body. If once is set, the body is
+// entered unconditionally and the condition is only tested after it, as with
+// "do-while". If kf is BK_INVALID, the loop has no condition at all and may
+// only be left with "break".
 func (this *BasicBlock) newloop(n node.Node, body []node.Node,
-	kt, kf BranchKind, rp *branchParent, left []node.Node, step node.Node) {
-	afterloop := newblock()
+	kt, kf BranchKind, rp *branchParent, left []node.Node, step node.Node,
+	once bool) {
+	afterloop := this.cfg.newblock()
 	form(afterloop, rp, nil, left)
 	// lb is the loop body itself.
-	lb := newblock()
+	lb := this.cfg.newblock()
 	// sb marks the end of loop body, which is always between the loop body and
 	// the next iteration or breakoff. This is the place where the for loop's
 	// step statement belongs.
-	sb := newblock()
+	sb := this.cfg.newblock()
 	ss := []node.Node{}
 	if step != nil {
 		ss = append(ss, step)
@@ -111,13 +110,21 @@ func (this *BasicBlock) newloop(n node.Node, body []node.Node,
 	// body, which is always evaluated on each iteration.
 	form(lb, &branchParent{sb, n, BK_ALWAYS}, lp, body)
 	// Conditional false-edge after the step body.
-	sb.newsucc(&branchParent{afterloop, n, kf})
+	if kf != BK_INVALID {
+		sb.newsucc(&branchParent{afterloop, n, kf})
+	}
+	if once {
+		this.newsucc(&branchParent{lb, n, BK_ALWAYS})
+		return
+	}
 	// Conditional true-edge to the loop body from the present block. This edge
 	// means "enter the loop".
 	this.newsucc(&branchParent{lb, n, kt})
 	// Conditional false-edge from the present block over the loop. This edge
 	// means "the loop is done".
-	this.newsucc(&branchParent{afterloop, n, kf})
+	if kf != BK_INVALID {
+		this.newsucc(&branchParent{afterloop, n, kf})
+	}
 }
 
 func extractbody(n node.Node) []node.Node {
@@ -132,27 +139,36 @@ func extractbody(n node.Node) []node.Node {
 }
 
 func (this *BasicBlock) newwhile(n *node.While, rp *branchParent, left []node.Node) {
-	this.newloop(n, extractbody(n.Body), BK_WHILETRUE, BK_WHILEFALSE, rp, left, nil)
+	this.newloop(n, extractbody(n.Body), BK_WHILETRUE, BK_WHILEFALSE, rp, left, nil, false)
+}
+
+func (this *BasicBlock) newdowhile(n *node.DoWhile, rp *branchParent, left []node.Node) {
+	this.newloop(n, extractbody(n.Body), BK_DOTRUE, BK_DOFALSE, rp, left, nil, true)
 }
 
 func (this *BasicBlock) newfor(n *node.For, rp *branchParent, left []node.Node) {
-	this.newloop(n, extractbody(n.Body), BK_FORTRUE, BK_FORFALSE, rp, left, n.OnEach)
+	if n.Cond == nil {
+		// "for (;;)" is always true.
+		this.newloop(n, extractbody(n.Body), BK_ALWAYS, BK_INVALID, rp, left, n.OnEach, false)
+		return
+	}
+	this.newloop(n, extractbody(n.Body), BK_FORTRUE, BK_FORFALSE, rp, left, n.OnEach, false)
 }
 
 func (this *BasicBlock) newif(n *node.If, rp *branchParent, lp *branchLoop, left []node.Node) {
 	// Continue evaluating the next basic block after this `if' branch. This
 	// block then has to be found with edges after our True and False blocks.
-	afterif := newblock()
+	afterif := this.cfg.newblock()
 	form(afterif, &branchParent{rp.to, n, BK_ALWAYS}, lp, left)
 
 	// Recurse into the true-block.
-	t := newblock()
+	t := this.cfg.newblock()
 	form(t, &branchParent{afterif, n, BK_ALWAYS}, lp, extractbody(n.True))
 	this.newsucc(&branchParent{t, n, BK_IFTRUE})
 
 	// Recurse into the false-block.
 	if n.False != nil {
-		f := newblock()
+		f := this.cfg.newblock()
 		form(f, &branchParent{afterif, n, BK_ALWAYS}, lp, extractbody(n.False))
 		this.newsucc(&branchParent{f, n, BK_IFFALSE})
 	} else {
@@ -162,6 +178,35 @@ func (this *BasicBlock) newif(n *node.If, rp *branchParent, lp *branchLoop, left
 	}
 }
 
+// labelblock returns the block starting at the given label. As goto may jump
+// forwards, the block is created by whichever we see first.
+func (c *CFG) labelblock(name string) *BasicBlock {
+	if lb, ok := c.labels[name]; ok {
+		return lb
+	}
+	lb := c.newblock()
+	c.labels[name] = lb
+	return lb
+}
+
+// formunreachable continues forming the statements following an unconditional
+// jump. Normally we may just ignore them, but if they contain a label, the
+// label's block has to be formed for the goto jumping there.
+func (bb *BasicBlock) formunreachable(rp *branchParent, lp *branchLoop, left []node.Node) {
+	haslabel := false
+	for _, n := range left {
+		node.Walk(n, func(n node.Node, _ int) bool {
+			if _, ok := n.(*node.Label); ok {
+				haslabel = true
+			}
+			return !haslabel
+		})
+	}
+	if haslabel {
+		form(bb.cfg.newblock(), rp, lp, left)
+	}
+}
+
 func form(b *BasicBlock, rp *branchParent, lp *branchLoop, left []node.Node) {
 	for i, n := range left {
 		switch t := n.(type) {
@@ -170,15 +215,33 @@ func form(b *BasicBlock, rp *branchParent, lp *branchLoop, left []node.Node) {
 			return
 		case *node.For:
 			// XXX Form new basic block for initializer?
-			b.newstmt(t.Init)
+			if t.Init != nil {
+				b.newstmt(t.Init)
+			}
 			b.newfor(t, rp, left[i+1:])
 			return
 		case *node.While:
 			b.newwhile(t, rp, left[i+1:])
 			return
-		case *node.Return:
+		case *node.DoWhile:
+			b.newdowhile(t, rp, left[i+1:])
+			return
+		case *node.Return, *node.Error:
+			// error() never returns either, so both leave for the
+			// function's exit.
+			b.newstmt(n)
+			b.newsucc(&branchParent{b.cfg.exit, n, BK_ALWAYS})
+			b.formunreachable(rp, lp, left[i+1:])
+			return
+		case *node.Assert:
+			// A failing assert aborts, so we continue in a new block only
+			// if the condition holds. This way the condition is known to
+			// hold in the blocks dominated by the new one.
 			b.newstmt(n)
-			b.newsucc(&branchParent{blockExit, n, BK_ALWAYS})
+			rest := b.cfg.newblock()
+			form(rest, rp, lp, left[i+1:])
+			b.newsucc(&branchParent{rest, n, BK_ASSERTTRUE})
+			b.newsucc(&branchParent{b.cfg.exit, n, BK_ASSERTFALSE})
 			return
 		case *node.Break:
 			if lp == nil {
@@ -186,6 +249,7 @@ func form(b *BasicBlock, rp *branchParent, lp *branchLoop, left []node.Node) {
 			}
 			lp.onBreak(b)
 			b.newstmt(n)
+			b.formunreachable(rp, lp, left[i+1:])
 			return
 		case *node.Continue:
 			if lp == nil {
@@ -193,7 +257,22 @@ func form(b *BasicBlock, rp *branchParent, lp *branchLoop, left []node.Node) {
 			}
 			lp.onContinue(b)
 			b.newstmt(n)
+			b.formunreachable(rp, lp, left[i+1:])
+			return
+		case *node.Label:
+			// A label always starts a new block as we may jump to it.
+			lb := b.cfg.labelblock(t.Name)
+			b.newsucc(&branchParent{lb, n, BK_ALWAYS})
+			lb.newstmt(n)
+			form(lb, rp, lp, left[i+1:])
+			return
+		case *node.Goto:
+			b.newstmt(n)
+			b.newsucc(&branchParent{b.cfg.labelblock(t.Target), n, BK_ALWAYS})
+			b.formunreachable(rp, lp, left[i+1:])
 			return
+		case *node.Empty:
+			// nothing to do
 		default:
 			b.newstmt(n)
 		}
@@ -201,14 +280,22 @@ func form(b *BasicBlock, rp *branchParent, lp *branchLoop, left []node.Node) {
 	b.newsucc(rp)
 }
 
+// Form builds the CFG of a single function definition. All state needed while
+// forming lives in the returned CFG, so Form may be called concurrently for
+// different functions. Block and branch IDs start from the same base for each
+// function.
 func Form(fd *node.FunDef) (*CFG, []error) {
 	c := &CFG{
-		first:  blockEntry,
-		fundef: fd,
+		fundef:  fd,
+		blockid: BLOCKID_EXIT,
+		labels:  map[string]*BasicBlock{},
 	}
-	second := newblock()
+	c.first = BasicBlock{Id: BLOCKID_ENTRY, Stmts: Stmts{}, cfg: c}
+	c.exit = &BasicBlock{Id: BLOCKID_EXIT, Stmts: Stmts{}, cfg: c}
+	second := c.newblock()
 	c.first.newsucc(&branchParent{second, nil, BK_ALWAYS})
-	// The initial parent basic block is the universal `blockExit'.
-	form(second, &branchParent{blockExit, nil, BK_ALWAYS}, nil, fd.Body.Value)
+	// The initial parent basic block is the function's exit block.
+	form(second, &branchParent{c.exit, nil, BK_ALWAYS}, nil, fd.Body.Value)
+	c.blocks = append(c.blocks, c.exit)
 	return c, nil
 }
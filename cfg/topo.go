@@ -0,0 +1,43 @@
+package cfg
+
+func (bb *BasicBlock) topo(done, active memblock, mem membranch, po *[]*BasicBlock) bool {
+	done.add(bb)
+	active.add(bb)
+	acyclic := true
+	// Like with postorder, successors are visited backwards to keep the true
+	// branch first.
+	for i := len(bb.Successors) - 1; i >= 0; i-- {
+		succ := bb.Successors[i]
+		if mem.seen(succ) {
+			continue
+		}
+		mem.add(succ)
+		switch {
+		case active.seen(succ.To):
+			// We are still visiting the target, so this is a back edge.
+			acyclic = false
+		case !done.seen(succ.To):
+			if !succ.To.topo(done, active, mem, po) {
+				acyclic = false
+			}
+		}
+	}
+	delete(active, bb.Id)
+	*po = append(*po, bb)
+	return acyclic
+}
+
+// TopoOrder returns the blocks reachable from the entry in reverse postorder,
+// which is a topological order if the graph has no cycles. The second return
+// value tells whether that is the case. Loops create back edges, so for them
+// it is expected to be false, and the order then holds for every edge except
+// the back edges.
+func (c *CFG) TopoOrder() ([]*BasicBlock, bool) {
+	po := []*BasicBlock{}
+	acyclic := c.first.topo(memblock{}, memblock{}, membranch{}, &po)
+	ret := make([]*BasicBlock, len(po))
+	for i, bb := range po {
+		ret[len(po)-1-i] = bb
+	}
+	return ret, acyclic
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/susji/c0/lex"
 	"github.com/susji/c0/node"
 	"github.com/susji/c0/parse"
+	"github.com/susji/c0/token"
 )
 
 func fatal(f string, va ...interface{}) {
@@ -41,8 +42,30 @@ func dumper(n node.Node, depth int) bool {
 	return true
 }
 
-func tap(dumptoks bool, src []rune, p *parse.Parser, dumpcfg bool) {
-	toks, errs := lex.Lex(src)
+// session keeps the parser and analyzer state between REPL lines so that
+// typedefs, structs, and functions declared earlier may be used later on.
+type session struct {
+	p *parse.Parser
+	a *analyze.Analyzer
+}
+
+func newSession(p *parse.Parser) *session {
+	return &session{p: p, a: analyze.New(p.Fn())}
+}
+
+// eval parses and analyzes more tokens within the session. It returns the new
+// nodes along with the parsing and analysis errors.
+func (s *session) eval(toks *token.Tokens) ([]node.Node, []error, []error) {
+	var perrs []error
+	if err := s.p.ParseMore(toks); err != nil {
+		perrs = s.p.Errors()
+	}
+	nodes := s.p.Nodes()
+	return nodes, perrs, s.a.AnalyzeMore(nodes)
+}
+
+func tap(dumptoks bool, src []rune, s *session, dumpcfg bool) {
+	toks, errs := lex.LexFile(s.p.Fn(), src)
 	if errs != nil {
 		perr("lexing: %s\n", errs)
 		return
@@ -51,25 +74,20 @@ func tap(dumptoks bool, src []rune, p *parse.Parser, dumpcfg bool) {
 		fmt.Println(toks)
 	}
 	for toks.Len() > 0 {
-		err := p.Parse(toks)
-		if err != nil {
-			for _, e := range p.Errors() {
-				perr("parse: %s", e)
-			}
+		nodes, perrs, aerrs := s.eval(toks)
+		for _, e := range perrs {
+			perr("parse: %s", e)
 		}
-		nodes := p.Nodes()
 		note("%d nodes", len(nodes))
 		for ni, n := range nodes {
 			fmt.Printf("{%d}\n", ni)
 			node.Walk(n, dumper)
 		}
 		note("syntax errors")
-		a := analyze.New(p.Fn())
-		aerrs := a.Analyze(p.Nodes())
 		for _, aerr := range aerrs {
 			perr("analyze: %s", aerr)
 		}
-		for _, n := range p.Nodes() {
+		for _, n := range nodes {
 			switch t := n.(type) {
 			case *node.FunDef:
 				note("CFG for function %q", t.FunDecl.Name)
@@ -93,8 +111,23 @@ func tap(dumptoks bool, src []rune, p *parse.Parser, dumpcfg bool) {
 	}
 }
 
-func doloop(dumptoks bool) {
+// libdirs collects the library directories given with -I.
+type libdirs []string
+
+func (l *libdirs) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *libdirs) Set(dir string) error {
+	*l = append(*l, dir)
+	return nil
+}
+
+func doloop(dumptoks bool, libpaths []string) {
 	r := bufio.NewReader(os.Stdin)
+	p := parse.New()
+	p.SetLibPaths(libpaths)
+	s := newSession(p)
 	i := 0
 	for {
 		fmt.Printf("[%d] >> ", i)
@@ -103,7 +136,7 @@ func doloop(dumptoks bool) {
 			fmt.Fprintf(os.Stderr, "Bailing...\n")
 			os.Exit(0)
 		}
-		tap(dumptoks, []rune(strings.TrimSpace(line)), parse.New(), false)
+		tap(dumptoks, []rune(strings.TrimSpace(line)), s, false)
 		i++
 	}
 }
@@ -112,6 +145,8 @@ func main() {
 	dumptoks := flag.Bool("dumptoks", false, "dump lexed tokens")
 	dofile := flag.String("file", "", "parse and dump a .c0 file")
 	dumpcfg := flag.Bool("dumpcfg", false, "dump CFG as dot (stderr)")
+	incs := libdirs{}
+	flag.Var(&incs, "I", "directory searched for #use <...>, may be repeated")
 	flag.Parse()
 
 	if *dofile != "" {
@@ -119,11 +154,12 @@ func main() {
 		if err != nil {
 			fatal("cannot open %s: %s\n", *dofile, err)
 		}
-		tap(*dumptoks, bytes.Runes(src), parse.NewFile(*dofile), *dumpcfg)
+		p := parse.NewFileWithLibPath(*dofile, incs)
+		tap(*dumptoks, bytes.Runes(src), newSession(p), *dumpcfg)
 	} else {
 		if *dumpcfg {
 			fatal("cannot dump dot with repl")
 		}
-		doloop(*dumptoks)
+		doloop(*dumptoks, incs)
 	}
 }
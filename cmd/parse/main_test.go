@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/susji/c0/lex"
+	"github.com/susji/c0/node"
+	"github.com/susji/c0/parse"
+	"github.com/susji/c0/testers/assert"
+	"github.com/susji/c0/testers/require"
+	"github.com/susji/c0/types"
+)
+
+func TestSessionKeepsState(t *testing.T) {
+	s := newSession(parse.New())
+	evalline := func(line string) []node.Node {
+		toks, lexerrs := lex.Lex([]rune(line))
+		require.Equal(t, 0, len(lexerrs))
+		nodes, perrs, aerrs := s.eval(toks)
+		t.Log(perrs, aerrs)
+		require.Equal(t, 0, len(perrs))
+		require.Equal(t, 0, len(aerrs))
+		return nodes
+	}
+
+	evalline("typedef int* ip;")
+	nodes := evalline("int f(ip p) { return *p; }")
+	require.Equal(t, 1, len(nodes))
+	// Only the nodes of the latest line are returned.
+	_, ok := nodes[0].(*node.FunDef)
+	require.True(t, ok)
+
+	f := s.a.Results().Functions["f"]
+	require.NotNil(t, f)
+	require.Equal(t, 1, len(f.ParamTypes))
+	assert.True(t, f.ParamTypes[0].Matches(types.NewType(types.TYPE_INT, 1, 0)))
+
+	// The function declared above is also usable.
+	evalline("int g() { ip x = alloc(int); return f(x); }")
+}
+
+func TestSessionErrors(t *testing.T) {
+	s := newSession(parse.New())
+	toks, _ := lex.Lex([]rune("int f() { return true; }"))
+	_, perrs, aerrs := s.eval(toks)
+	assert.Equal(t, 0, len(perrs))
+	assert.Equal(t, 1, len(aerrs))
+
+	// Earlier errors are not reported again.
+	toks, _ = lex.Lex([]rune("int g() { return 0; }"))
+	_, perrs, aerrs = s.eval(toks)
+	assert.Equal(t, 0, len(perrs))
+	assert.Equal(t, 0, len(aerrs))
+}
@@ -0,0 +1,117 @@
+// Package driver runs the front-end stages of the compiler, that is, lexing,
+// parsing, and analysis, one after another for a single source file.
+package driver
+
+import (
+	"time"
+
+	"github.com/susji/c0/analyze"
+	"github.com/susji/c0/lex"
+	"github.com/susji/c0/node"
+	"github.com/susji/c0/parse"
+	"github.com/susji/c0/program"
+)
+
+// Timings contains the wall-clock durations of each front-end stage. Total
+// covers all of them.
+type Timings struct {
+	Lex, Parse, Analyze, Total time.Duration
+}
+
+// Options controls how the front-end stages are run.
+type Options struct {
+	// Fn is the name of the source file used in error messages
+	Fn string
+	// Timings enables measuring the duration of each stage
+	Timings bool
+	// Dialect replaces the reserved words and primitives of plain C0
+	Dialect *analyze.Dialect
+}
+
+// Result contains everything produced by the front-end stages. Errors holds
+// the errors of the first stage that failed, after which no further stages
+// were run.
+type Result struct {
+	Nodes    []node.Node
+	Analyzer *analyze.Analyzer
+	Errors   []error
+	// Timings is nil unless requested with Options
+	Timings *Timings
+}
+
+// Program sorts the nodes into a program.Program. It is nil if we did not get
+// as far as analysis.
+func (r *Result) Program() *program.Program {
+	if r.Analyzer == nil {
+		return nil
+	}
+	return program.New(r.Nodes, r.Analyzer.Results())
+}
+
+// stopwatch returns a function which tells how long it has been since the
+// previous call.
+func stopwatch() func() time.Duration {
+	prev := time.Now()
+	return func() time.Duration {
+		now := time.Now()
+		d := now.Sub(prev)
+		prev = now
+		return d
+	}
+}
+
+// Run lexes, parses, and analyzes src.
+func Run(src []rune, opts Options) *Result {
+	res := &Result{}
+	t := &Timings{}
+	lap := stopwatch()
+	defer func() {
+		t.Total = t.Lex + t.Parse + t.Analyze
+		if opts.Timings {
+			res.Timings = t
+		}
+	}()
+
+	p := parse.New()
+	if opts.Fn != "" {
+		p = parse.NewFile(opts.Fn)
+	}
+	if opts.Dialect != nil {
+		p.SetDialect(opts.Dialect)
+	}
+	toks, lexerrs := lex.LexFile(p.Fn(), src)
+	t.Lex = lap()
+	if len(lexerrs) > 0 {
+		res.Errors = lexerrs
+		return res
+	}
+
+	err := p.Parse(toks)
+	t.Parse = lap()
+	res.Nodes = p.Nodes()
+	if err != nil {
+		res.Errors = p.Errors()
+		return res
+	}
+
+	res.Analyzer = analyze.New(p.Fn())
+	if opts.Dialect != nil {
+		res.Analyzer.SetDialect(opts.Dialect)
+	}
+	res.Errors = res.Analyzer.Analyze(res.Nodes)
+	t.Analyze = lap()
+	return res
+}
+
+// Check lexes, parses, and analyzes src, which comes from the file fn, and
+// returns the results of the analysis along with the errors of all stages.
+// Like with Run, the stages after a failing one are not run, as they would
+// mostly report the same mistakes again. The results are nil if we did not
+// get as far as analysis.
+func Check(fn string, src []rune) (*analyze.Results, []error) {
+	res := Run(src, Options{Fn: fn})
+	if res.Analyzer == nil {
+		return nil, res.Errors
+	}
+	return res.Analyzer.Results(), res.Errors
+}
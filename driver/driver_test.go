@@ -0,0 +1,118 @@
+package driver_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/susji/c0/analyze"
+	"github.com/susji/c0/driver"
+	"github.com/susji/c0/testers/assert"
+	"github.com/susji/c0/testers/require"
+)
+
+// moderate generates a source file with a hundred functions.
+func moderate() string {
+	b := &strings.Builder{}
+	for i := 0; i < 100; i++ {
+		b.WriteString(fmt.Sprintf(`
+int f%d(int n) {
+	int sum = 0;
+	for (int i = 0; i < n; i++) {
+		if (i %% 2 == 0) {
+			sum += i;
+		} else {
+			sum -= 1;
+		}
+	}
+	return sum;
+}
+`, i))
+	}
+	return b.String()
+}
+
+func TestTimings(t *testing.T) {
+	res := driver.Run([]rune(moderate()), driver.Options{Timings: true})
+	require.Equal(t, 0, len(res.Errors))
+	require.NotNil(t, res.Timings)
+	tt := res.Timings
+	t.Log(tt)
+	assert.True(t, tt.Lex >= 0)
+	assert.True(t, tt.Parse >= 0)
+	assert.True(t, tt.Analyze >= 0)
+	assert.True(t, tt.Total > 0)
+	assert.True(t, tt.Lex <= tt.Total)
+	assert.True(t, tt.Parse <= tt.Total)
+	assert.True(t, tt.Analyze <= tt.Total)
+	assert.Equal(t, 100, len(res.Nodes))
+}
+
+func TestTimingsDisabled(t *testing.T) {
+	code := moderate()
+	with := driver.Run([]rune(code), driver.Options{Timings: true})
+	without := driver.Run([]rune(code), driver.Options{})
+	assert.Nil(t, without.Timings)
+	require.Equal(t, len(with.Nodes), len(without.Nodes))
+	for i := range with.Nodes {
+		assert.Equal(t, with.Nodes[i].String(), without.Nodes[i].String())
+	}
+	assert.Equal(t, len(with.Errors), len(without.Errors))
+}
+
+func TestErrors(t *testing.T) {
+	res := driver.Run([]rune("int f() { return \"x\"; }"), driver.Options{Fn: "x.c0"})
+	require.Equal(t, 1, len(res.Errors))
+	assert.True(t, strings.HasPrefix(res.Errors[0].Error(), "x.c0:"))
+
+	res = driver.Run([]rune("int f( {"), driver.Options{})
+	assert.True(t, len(res.Errors) > 0)
+	assert.Nil(t, res.Analyzer)
+}
+
+func TestCheck(t *testing.T) {
+	type entry struct {
+		code     string
+		analyzed bool
+		errs     int
+	}
+	table := []entry{
+		{"int f() { return 1; }", true, 0},
+		{"int f() { return \"x\"; }", true, 1},
+		{"int f( {", false, -1},
+		{"int f() { return '; }", false, -1},
+	}
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			res, errs := driver.Check("x.c0", []rune(cur.code))
+			t.Log(errs)
+			if cur.errs < 0 {
+				assert.True(t, len(errs) > 0)
+			} else {
+				assert.Equal(t, cur.errs, len(errs))
+			}
+			for _, err := range errs {
+				assert.True(t, strings.HasPrefix(err.Error(), "x.c0:"))
+			}
+			if !cur.analyzed {
+				assert.Nil(t, res)
+				return
+			}
+			require.NotNil(t, res)
+			assert.NotNil(t, res.Functions["f"])
+		})
+	}
+}
+
+func TestDialect(t *testing.T) {
+	code := []rune("int f() { int const = 1; return const; }")
+	res := driver.Run(code, driver.Options{})
+	assert.Equal(t, 0, len(res.Errors))
+
+	d := analyze.DefaultDialect()
+	d.Reserve("const")
+	res = driver.Run(code, driver.Options{Dialect: d})
+	t.Log(res.Errors)
+	assert.True(t, len(res.Errors) > 0)
+	assert.Nil(t, res.Analyzer)
+}
@@ -9,12 +9,38 @@
 //
 package ir
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 const (
 	TYPE_INT32 = iota
+	TYPE_BOOL
+	TYPE_CHAR
+	// TYPE_PTR is a reference to something we do not have a more precise
+	// type for, like a string, a struct, or an array.
+	TYPE_PTR
 )
 
+const (
+	ICMP_EQ = iota
+	ICMP_NE
+	ICMP_LT
+	ICMP_GT
+	ICMP_LE
+	ICMP_GE
+)
+
+var icmpnames = [...]string{
+	"eq",
+	"ne",
+	"lt",
+	"gt",
+	"le",
+	"ge",
+}
+
 type Type struct {
 	Kind, PointerLevel, Elements int
 }
@@ -24,6 +50,12 @@ func (n *Type) String() string {
 	switch n.Kind {
 	case TYPE_INT32:
 		kind = "i32"
+	case TYPE_BOOL:
+		kind = "i1"
+	case TYPE_CHAR:
+		kind = "i8"
+	case TYPE_PTR:
+		kind = "ptr"
 	default:
 		panic("unrecognized Type")
 	}
@@ -39,6 +71,22 @@ func (n *Type) String() string {
 	return fmt.Sprintf("[%s%s%s]", e, ptr[:ptri], kind)
 }
 
+// Align returns the alignment in bytes of a value of the type.
+func (n *Type) Align() uint {
+	if n.PointerLevel > 0 {
+		return 8
+	}
+	switch n.Kind {
+	case TYPE_INT32:
+		return 4
+	case TYPE_BOOL, TYPE_CHAR:
+		return 1
+	case TYPE_PTR:
+		return 8
+	}
+	panic("unrecognized Type")
+}
+
 type Instruction interface {
 	String() string
 	Instruction()
@@ -53,11 +101,6 @@ type Variable struct {
 	Count int
 }
 
-type Function struct {
-	Name   string
-	Params []string
-}
-
 type Load struct {
 	Type     *Type
 	To, From *Variable
@@ -74,18 +117,45 @@ type Add struct {
 	Left, Right Value
 }
 
+type Sub struct {
+	Type        *Type
+	To          *Variable
+	Left, Right Value
+}
+
 type Mul struct {
 	Type        *Type
 	To          *Variable
 	Left, Right Value
 }
 
+type Div struct {
+	Type        *Type
+	To          *Variable
+	Left, Right Value
+}
+
+type Mod struct {
+	Type        *Type
+	To          *Variable
+	Left, Right Value
+}
+
 type Xor struct {
 	Type        *Type
 	To          *Variable
 	Left, Right Value
 }
 
+// ICmp compares two signed integers and results in 1 if the predicate holds,
+// otherwise in 0.
+type ICmp struct {
+	Type        *Type
+	Pred        int
+	To          *Variable
+	Left, Right Value
+}
+
 type Mov struct {
 	Type *Type
 	To   *Variable
@@ -107,16 +177,48 @@ type Label struct {
 	Name string
 }
 
+// FunCall calls the named function with the given arguments and places the
+// returned value into To.
 type FunCall struct {
+	Type   *Type
+	To     *Variable
+	Callee string
+	Args   []Value
 }
 
 type Jump struct {
+	To string
 }
 
 type JumpZero struct {
+	Cond Value
+	To   string
 }
 
 type JumpNonZero struct {
+	Cond Value
+	To   string
+}
+
+// PhiEdge is a single incoming value of a Phi. A nil Value means that the
+// variable is undefined when arriving from the labeled predecessor.
+type PhiEdge struct {
+	Value Value
+	From  string
+}
+
+// Phi selects its value based on which predecessor block we arrived from.
+// Consecutive phis at the start of a block are evaluated simultaneously.
+type Phi struct {
+	Type  *Type
+	To    *Variable
+	Edges []PhiEdge
+}
+
+// Unreachable marks code which could not be generated. Executing it is a
+// fault.
+type Unreachable struct {
+	Reason string
 }
 
 type Numeric32i struct {
@@ -146,19 +248,39 @@ func (i Add) String() string {
 	return fmt.Sprintf("%s = ADD<%s> %s, %s", i.To, i.Type, i.Left, i.Right)
 }
 
+func (i Sub) String() string {
+	return fmt.Sprintf("%s = SUB<%s> %s, %s", i.To, i.Type, i.Left, i.Right)
+}
+
 func (i Mul) String() string {
 	return fmt.Sprintf("%s = MUL<%s> %s, %s", i.To, i.Type, i.Left, i.Right)
 }
 
+func (i Div) String() string {
+	return fmt.Sprintf("%s = DIV<%s> %s, %s", i.To, i.Type, i.Left, i.Right)
+}
+
+func (i Mod) String() string {
+	return fmt.Sprintf("%s = MOD<%s> %s, %s", i.To, i.Type, i.Left, i.Right)
+}
+
 func (i Xor) String() string {
 	return fmt.Sprintf("%s = XOR<%s> %s, %s", i.To, i.Type, i.Left, i.Right)
 }
 
+func (i ICmp) String() string {
+	return fmt.Sprintf("%s = ICMP<%s> %s %s, %s",
+		i.To, i.Type, icmpnames[i.Pred], i.Left, i.Right)
+}
+
 func (i Mov) String() string {
 	return fmt.Sprintf("MOV<%s> %s, %s", i.Type, i.What, i.To)
 }
 
 func (i Return) String() string {
+	if i.With == nil {
+		return fmt.Sprintf("RET<%s>", i.Type)
+	}
 	return fmt.Sprintf("RET<%s> %s", i.Type, i.With)
 }
 
@@ -166,19 +288,66 @@ func (i Alloca) String() string {
 	return fmt.Sprintf("%s = ALLOCA %s, align %d", i.To, i.Type, i.Align)
 }
 
+func (i FunCall) String() string {
+	args := make([]string, len(i.Args))
+	for j, arg := range i.Args {
+		args[j] = fmt.Sprintf("%s", arg)
+	}
+	return fmt.Sprintf("%s = CALL<%s> %s(%s)",
+		i.To, i.Type, i.Callee, strings.Join(args, ", "))
+}
+
+func (i Unreachable) String() string {
+	return fmt.Sprintf("UNREACHABLE ; %s", i.Reason)
+}
+
 func (i Label) String() string {
 	return fmt.Sprintf("%s:", i.Name)
 }
 
-func (i Load) Instruction()   {}
-func (i Store) Instruction()  {}
-func (i Add) Instruction()    {}
-func (i Mul) Instruction()    {}
-func (i Return) Instruction() {}
-func (i Alloca) Instruction() {}
-func (i Xor) Instruction()    {}
-func (i Mov) Instruction()    {}
-func (i Label) Instruction()  {}
+func (i Jump) String() string {
+	return fmt.Sprintf("JMP %%%s", i.To)
+}
+
+func (i JumpZero) String() string {
+	return fmt.Sprintf("JZ %s, %%%s", i.Cond, i.To)
+}
+
+func (i JumpNonZero) String() string {
+	return fmt.Sprintf("JNZ %s, %%%s", i.Cond, i.To)
+}
+
+func (i Phi) String() string {
+	edges := make([]string, len(i.Edges))
+	for j, edge := range i.Edges {
+		var val interface{} = "undef"
+		if edge.Value != nil {
+			val = edge.Value
+		}
+		edges[j] = fmt.Sprintf("[%s, %%%s]", val, edge.From)
+	}
+	return fmt.Sprintf("%s = PHI<%s> %s", i.To, i.Type, strings.Join(edges, ", "))
+}
+
+func (i Load) Instruction()        {}
+func (i Store) Instruction()       {}
+func (i Add) Instruction()         {}
+func (i Sub) Instruction()         {}
+func (i Mul) Instruction()         {}
+func (i Div) Instruction()         {}
+func (i Mod) Instruction()         {}
+func (i Return) Instruction()      {}
+func (i Alloca) Instruction()      {}
+func (i Xor) Instruction()         {}
+func (i ICmp) Instruction()        {}
+func (i Mov) Instruction()         {}
+func (i Label) Instruction()       {}
+func (i FunCall) Instruction()     {}
+func (i Unreachable) Instruction() {}
+func (i Jump) Instruction()        {}
+func (i JumpZero) Instruction()    {}
+func (i JumpNonZero) Instruction() {}
+func (i Phi) Instruction()         {}
 
 func (v *Variable) IsValue()   {}
 func (i *Numeric32i) IsValue() {}
@@ -0,0 +1,90 @@
+package ir
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Module contains the functions of a whole program.
+type Module struct {
+	Functions []*Function
+}
+
+// Function contains the instructions of a single function grouped into basic
+// blocks. Params are the registers in which the function expects to find its
+// arguments, and ParamTypes are their types.
+type Function struct {
+	Name       string
+	Returns    *Type
+	Params     []*Variable
+	ParamTypes []*Type
+	Blocks     []*Block
+}
+
+// Block is a labeled sequence of instructions, which ends with a terminator
+// unless control falls through to the next block.
+type Block struct {
+	Label        string
+	Instructions []Instruction
+}
+
+// NewFunction groups instructions into blocks at each Label. Instructions
+// before the first Label end up in a block without one.
+func NewFunction(name string, returns *Type, params []*Variable, paramtypes []*Type, instrs []Instruction) *Function {
+	ret := &Function{
+		Name:       name,
+		Returns:    returns,
+		Params:     params,
+		ParamTypes: paramtypes,
+	}
+	var cur *Block
+	for _, instr := range instrs {
+		if l, ok := instr.(Label); ok {
+			cur = &Block{Label: l.Name}
+			ret.Blocks = append(ret.Blocks, cur)
+			continue
+		}
+		if cur == nil {
+			cur = &Block{}
+			ret.Blocks = append(ret.Blocks, cur)
+		}
+		cur.Instructions = append(cur.Instructions, instr)
+	}
+	return ret
+}
+
+// Add appends f to the functions of the module.
+func (m *Module) Add(f *Function) {
+	m.Functions = append(m.Functions, f)
+}
+
+// String renders the function like LLVM IR does: a signature followed by
+// the labeled blocks with their instructions indented.
+func (f *Function) String() string {
+	b := &strings.Builder{}
+	params := make([]string, len(f.Params))
+	for i, param := range f.Params {
+		params[i] = fmt.Sprintf("%s %s", f.ParamTypes[i], param)
+	}
+	b.WriteString(fmt.Sprintf("define %s @%s(%s) {\n",
+		f.Returns, f.Name, strings.Join(params, ", ")))
+	for _, block := range f.Blocks {
+		if block.Label != "" {
+			b.WriteString(Label{Name: block.Label}.String() + "\n")
+		}
+		for _, instr := range block.Instructions {
+			b.WriteString("  " + instr.String() + "\n")
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// String renders the functions of the module separated by empty lines.
+func (m *Module) String() string {
+	funcs := make([]string, len(m.Functions))
+	for i, f := range m.Functions {
+		funcs[i] = f.String()
+	}
+	return strings.Join(funcs, "\n")
+}
@@ -0,0 +1,18 @@
+package lex
+
+import "fmt"
+
+// LexError is an error met when lexing the file Fn. The wrapped error already
+// tells the position.
+type LexError struct {
+	Wrapped error
+	Fn      string
+}
+
+func (e *LexError) Error() string {
+	return fmt.Sprintf("%s:%s", e.Fn, e.Wrapped)
+}
+
+func (e *LexError) Unwrap() error {
+	return e.Wrapped
+}
@@ -1,6 +1,7 @@
 package lex
 
 import (
+	"errors"
 	"fmt"
 
 	pr "github.com/susji/c0/primitives"
@@ -46,10 +47,10 @@ var escapebuilder = func(wantstring bool) pr.Parser {
 		{`\f`, '\f'},
 		{`\a`, '\a'},
 		{`\\`, '\\'},
+		// Needed only in strings but harmless in character literals.
+		{`\"`, '"'},
 	}
-	if wantstring {
-		escpairs = append(escpairs, escpair{`\"`, '"'})
-	} else {
+	if !wantstring {
 		escpairs = append(escpairs, escpair{`\'`, '\''})
 		escpairs = append(escpairs, escpair{`\0`, 0})
 	}
@@ -67,18 +68,30 @@ var escapebuilder = func(wantstring bool) pr.Parser {
 }
 var pstrlitq1 = pr.Chomp('"')
 var pstrlitq2 = pr.Chomp('"').Fatal("missing closing '\"'")
-var pstrlitch = pr.ExceptRunes("\"\\")
+
+// String literals may not span lines, unless the linefeed is escaped with a
+// backslash. Such a continuation is dropped from the literal's value.
+var pstrlitch = pr.ExceptRunes("\"\\\n")
+var pstrlitcont = pr.String("\\\n").
+	Map(func(from pr.ResultValue) pr.ResultValue {
+		return from[:len(from)-2]
+	})
 var StrLit = pr.Discard(pstrlitq1).
-	And(pstrlitch.Or(escapebuilder(true)).ZeroOrMore()).
+	And(pstrlitch.Or(pstrlitcont).Or(escapebuilder(true)).ZeroOrMore()).
 	And(pr.Discard(pstrlitq2))
 
-// Character (rune) literal
+// Character (rune) literal. We accept more than one character between the
+// quotes so the parser can tell what is wrong with the literal instead of
+// us complaining about the missing closing quote.
 var pchrlitq1 = pr.Chomp('\'')
 var pchrlitq2 = pr.Chomp('\'').Fatal(`missing closing "'"`)
-var pchrlitch = pr.ExceptRunes("'\\")
-var pchrlitesc = escapebuilder(false).Fatal("invalid character literal")
+var pchrlitch = pr.ExceptRunes("'\\\n")
+var pchrlitbad = pr.Rune('\\').Pipe(func(*pr.State) {
+	panic(errors.New("invalid character literal"))
+})
+var pchrlitesc = escapebuilder(false).Or(pchrlitbad)
 var ChrLit = pr.Discard(pchrlitq1).
-	And(pchrlitch.Or(pchrlitesc)).
+	And(pchrlitch.Or(pchrlitesc).OneOrMore().Fatal("invalid character literal")).
 	And(pr.Discard(pchrlitq2))
 
 // Library literal
@@ -121,19 +134,38 @@ var DirectiveUseStr = usestart.
 	And(dirend)
 
 // Numeric values
+//
+// C has suffixes like "10L" and "5U", but C0 does not. Without numsuffix
+// they would lex as a number and an identifier, which the parser would then
+// complain about less clearly.
+var ErrNumSuffix = errors.New("numeric literal with invalid suffix")
+var numsuffix = Identifier.Pipe(func(curstate *pr.State) {
+	panic(fmt.Errorf("%w: %q", ErrNumSuffix, curstate.String()))
+}).Or(pr.Epsilon())
 var pdig1 = pr.RuneRange('1', '9')
-var DecNum = pdig1.And(pdig.ZeroOrMore())
+var DecNum = pdig1.And(pdig.ZeroOrMore()).And(numsuffix)
 var HexNum = pr.Rune('0').
 	And(pr.Runes("xX").
 		And(pdig.
 			Or(pr.RuneRange('a', 'f')).
 			Or(pr.RuneRange('A', 'F')).
 			OneOrMore().Fatal("invalid hexnum")).
-		Or(pr.Epsilon()))
+		Or(pr.Epsilon())).
+	And(numsuffix)
 
 // Special identifiers
 var SpecialIds = pr.Strings("true", "false", "NULL")
 
+// LexFile is like Lex but the errors are LexErrors telling they were met in
+// the file fn.
+func LexFile(fn string, what []rune) (*token.Tokens, []error) {
+	toks, errs := Lex(what)
+	for i, err := range errs {
+		errs[i] = &LexError{Wrapped: err, Fn: fn}
+	}
+	return toks, errs
+}
+
 func Lex(what []rune) (*token.Tokens, []error) {
 	toks := &token.Tokens{}
 	state := pr.NewState(what)
@@ -1,7 +1,9 @@
 package lex_test
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/susji/c0/lex"
@@ -20,6 +22,8 @@ func TestStrLit(t *testing.T) {
 	table := []entry{
 		{`"string literal"`, `string literal`, ""},
 		{`"\nmore\nlines\t\n" rest`, "\nmore\nlines\t\n", " rest"},
+		{"\"line1\\\nline2\"", "line1line2", ""},
+		{"\"one\\\n two\\\nthree\" rest", "one twothree", " rest"},
 	}
 
 	for _, cur := range table {
@@ -33,6 +37,20 @@ func TestStrLit(t *testing.T) {
 	}
 }
 
+func TestStrLitUnterminated(t *testing.T) {
+	table := []string{
+		"\"no closing quote",
+		"\"line1\nline2\"",
+	}
+	for _, cur := range table {
+		t.Run(cur, func(t *testing.T) {
+			res := lex.StrLit.Do(pr.NewState([]rune(cur)))
+			require.NotNil(t, res)
+			require.NotNil(t, res.Error())
+		})
+	}
+}
+
 func TestIdentifier(t *testing.T) {
 	one := "this_is_identifier1"
 	two := " and it follows-with-something more!"
@@ -91,6 +109,15 @@ func TestChrLitEmpty(t *testing.T) {
 	require.True(t, len(errs) > 0)
 }
 
+func TestLexFile(t *testing.T) {
+	_, errs := lex.LexFile("x.c0", []rune("\n  ''"))
+	require.True(t, len(errs) > 0)
+	var lerr *lex.LexError
+	require.True(t, errors.As(errs[0], &lerr))
+	assert.Equal(t, "x.c0", lerr.Fn)
+	assert.True(t, strings.HasPrefix(errs[0].Error(), "x.c0:2:3: "))
+}
+
 func TestChrLit(t *testing.T) {
 	type entry struct {
 		give string
@@ -100,6 +127,9 @@ func TestChrLit(t *testing.T) {
 		{`'a'`, 'a'},
 		{`'\n'`, '\n'},
 		{`'\0'`, 0},
+		{`'"'`, '"'},
+		{`'\"'`, '"'},
+		{`'\''`, '\''},
 	}
 	for _, cur := range table {
 		t.Run(cur.give, func(t *testing.T) {
@@ -112,6 +142,36 @@ func TestChrLit(t *testing.T) {
 	}
 }
 
+func TestChrLitBad(t *testing.T) {
+	type entry struct {
+		give string
+		want string
+	}
+	// Extra characters are left for the parser to complain about.
+	table := []entry{
+		{`'ab'`, "ab"},
+		{`'a\n'`, "a\n"},
+		{`'\\\''`, "\\'"},
+		{`'\q'`, ""},
+		{`'a\q'`, ""},
+		{`'a`, ""},
+		{"'a\n'", ""},
+	}
+	for _, cur := range table {
+		t.Run(cur.give, func(t *testing.T) {
+			res := lex.ChrLit.Do(pr.NewState([]rune(cur.give)))
+			require.NotNil(t, res)
+			if cur.want == "" {
+				t.Log(res.Error())
+				assert.NotNil(t, res.Error())
+				return
+			}
+			require.Nil(t, res.Error())
+			assert.Equal(t, cur.want, res.State().String())
+		})
+	}
+}
+
 func TestLibLit(t *testing.T) {
 	type entry struct {
 		give, want string
@@ -376,3 +436,42 @@ func TestLexNotLibLit(t *testing.T) {
 	}
 
 }
+
+func TestNumSuffix(t *testing.T) {
+	table := []string{"10L", "5U", "0xFFu", "0L", "x = 1ul;", "3.0f"}
+	for _, cur := range table {
+		t.Run(cur, func(t *testing.T) {
+			_, errs := lex.Lex([]rune(cur))
+			t.Log(errs)
+			require.True(t, len(errs) > 0)
+			assert.True(t, errors.Is(errs[0], lex.ErrNumSuffix))
+		})
+	}
+
+	type tok struct {
+		kind  token.Kind
+		value string
+	}
+	okays := []struct {
+		give string
+		want []tok
+	}{
+		{"10 L", []tok{{token.DecNum, "10"}, {token.Id, "L"}}},
+		{"0xFF u", []tok{{token.HexNum, "0xFF"}, {token.Id, "u"}}},
+		{"0xFFe", []tok{{token.HexNum, "0xFFe"}}},
+		{"a10L", []tok{{token.Id, "a10L"}}},
+	}
+	for _, cur := range okays {
+		t.Run(cur.give, func(t *testing.T) {
+			toks, errs := lex.Lex([]rune(cur.give))
+			t.Log(errs)
+			require.Equal(t, 0, len(errs))
+			require.Equal(t, len(cur.want), toks.Len())
+			for _, want := range cur.want {
+				got := toks.Pop()
+				assert.Equal(t, want.kind, got.Kind())
+				assert.Equal(t, want.value, got.Value())
+			}
+		})
+	}
+}
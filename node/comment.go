@@ -0,0 +1,31 @@
+package node
+
+// Comments written right before a node are kept aside of it like its Token.
+// They are stored as written, including the comment markers.
+var comments = map[NodeId][]string{}
+
+// AttachComment attaches a comment to the Store'd Node with the given id.
+func AttachComment(id NodeId, comment string) {
+	if id == NODEID_INVALID {
+		return
+	}
+	comments[id] = append(comments[id], comment)
+}
+
+// Comments returns the comments attached to the Node with the given id.
+func Comments(id NodeId) []string {
+	return comments[id]
+}
+
+// TransferComments moves the comments of the Node old to the Node new, after
+// the ones it already has. Transformations replacing a node with another
+// should call this to keep the comments from getting lost.
+func TransferComments(old, new NodeId) {
+	if old == new || new == NODEID_INVALID {
+		return
+	}
+	for _, comment := range comments[old] {
+		AttachComment(new, comment)
+	}
+	delete(comments, old)
+}
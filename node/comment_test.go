@@ -0,0 +1,69 @@
+package node_test
+
+import (
+	"testing"
+
+	"github.com/susji/c0/node"
+	"github.com/susji/c0/testers/assert"
+	"github.com/susji/c0/testers/require"
+)
+
+func TestComments(t *testing.T) {
+	nodes := parsed(t, `
+// counts things
+/* and returns them */
+int count(int[] what) {
+	// not attached to anything
+	return 1;
+}
+int other();
+`)
+	require.Equal(t, 2, len(nodes))
+	assert.Equal(t, []string{"// counts things", "/* and returns them */"},
+		node.Comments(nodes[0].Id()))
+	assert.Equal(t, 0, len(node.Comments(nodes[1].Id())))
+	assert.Equal(t, `// counts things
+/* and returns them */
+int count(int[] what);
+int other();
+`, node.GenerateHeader(nodes))
+
+	// Replace the definition with a declaration of another name like a
+	// transformation would.
+	def := nodes[0].(*node.FunDef)
+	decl := node.Store(def.Tok(), &node.FunDecl{
+		Name:    "counter",
+		Returns: def.Returns,
+		Params:  def.Params,
+	})
+	node.TransferComments(def.Id(), decl.Id())
+	assert.Equal(t, 0, len(node.Comments(def.Id())))
+	assert.Equal(t, `int other();
+// counts things
+/* and returns them */
+int counter(int[] what);
+int count(int[] what);
+`, node.GenerateHeader([]node.Node{nodes[1], decl, def}))
+}
+
+func TestCommentsDecls(t *testing.T) {
+	nodes := parsed(t, `/* a point */
+struct point {
+	int x; // not attached either
+	int y;
+};
+// a pointer to one
+typedef struct point* pp; // and it is handy
+/* first */ /* second */
+int f(pp p); /* about f
+   over two lines */
+
+// dangling at the end`)
+	require.Equal(t, 3, len(nodes))
+	assert.Equal(t, []string{"/* a point */"}, node.Comments(nodes[0].Id()))
+	assert.Equal(t, []string{"// a pointer to one", "// and it is handy"},
+		node.Comments(nodes[1].Id()))
+	assert.Equal(t, []string{"/* first */", "/* second */",
+		"/* about f\n   over two lines */"},
+		node.Comments(nodes[2].Id()))
+}
@@ -0,0 +1,164 @@
+package node
+
+import "math"
+
+type ConstKind int
+
+const (
+	CONST_INT = iota
+	CONST_BOOL
+)
+
+// Const is the value of a constant expression. Depending on Kind, either Int
+// or Bool holds the value.
+type Const struct {
+	Kind ConstKind
+	Int  int32
+	Bool bool
+}
+
+func constInt(v int32) (Const, bool) {
+	return Const{Kind: CONST_INT, Int: v}, true
+}
+
+func constBool(v bool) (Const, bool) {
+	return Const{Kind: CONST_BOOL, Bool: v}, true
+}
+
+// EvalConst evaluates an expression consisting only of integer and boolean
+// literals and the operators on them. The second return value is false if n
+// is not such an expression or if evaluating it would fail at run-time, as
+// with division by zero. Integer arithmetic wraps around like in C0.
+func EvalConst(n Node) (Const, bool) {
+	switch t := n.(type) {
+	case *Numeric:
+		return constInt(t.Value)
+	case *Bool:
+		return constBool(t.Value)
+	case *OpUnary:
+		return evalUnary(t)
+	case *OpBinary:
+		return evalBinary(t)
+	case *Ternary:
+		return evalTernary(t)
+	}
+	return Const{}, false
+}
+
+// EvalConstBool evaluates n with EvalConst and returns its value if it is a
+// boolean constant.
+func EvalConstBool(n Node) (value, ok bool) {
+	c, ok := EvalConst(n)
+	if !ok || c.Kind != CONST_BOOL {
+		return false, false
+	}
+	return c.Bool, true
+}
+
+func evalUnary(n *OpUnary) (Const, bool) {
+	c, ok := EvalConst(n.To)
+	if !ok {
+		return Const{}, false
+	}
+	switch {
+	case n.Op == OPUN_LOGNOT && c.Kind == CONST_BOOL:
+		return constBool(!c.Bool)
+	case n.Op == OPUN_NEG && c.Kind == CONST_INT:
+		return constInt(-c.Int)
+	case n.Op == OPUN_BITNOT && c.Kind == CONST_INT:
+		return constInt(^c.Int)
+	}
+	return Const{}, false
+}
+
+func evalBinary(n *OpBinary) (Const, bool) {
+	l, ok := EvalConst(n.Left)
+	if !ok {
+		return Const{}, false
+	}
+	r, ok := EvalConst(n.Right)
+	if !ok || l.Kind != r.Kind {
+		return Const{}, false
+	}
+	if l.Kind == CONST_BOOL {
+		switch n.Op {
+		case OPBIN_AND:
+			return constBool(l.Bool && r.Bool)
+		case OPBIN_OR:
+			return constBool(l.Bool || r.Bool)
+		case OPBIN_EQ:
+			return constBool(l.Bool == r.Bool)
+		case OPBIN_NE:
+			return constBool(l.Bool != r.Bool)
+		}
+		return Const{}, false
+	}
+	a, b := l.Int, r.Int
+	switch n.Op {
+	case OPBIN_ADD:
+		return constInt(a + b)
+	case OPBIN_SUB:
+		return constInt(a - b)
+	case OPBIN_MUL:
+		return constInt(a * b)
+	case OPBIN_DIV, OPBIN_MOD:
+		// These are run-time errors in C0.
+		if b == 0 || (a == math.MinInt32 && b == -1) {
+			return Const{}, false
+		}
+		if n.Op == OPBIN_DIV {
+			return constInt(a / b)
+		}
+		return constInt(a % b)
+	case OPBIN_SHIFTL, OPBIN_SHIFTR:
+		// So are shifts outside of [0, 32).
+		if b < 0 || b > 31 {
+			return Const{}, false
+		}
+		if n.Op == OPBIN_SHIFTL {
+			return constInt(a << uint(b))
+		}
+		return constInt(a >> uint(b))
+	case OPBIN_BAND:
+		return constInt(a & b)
+	case OPBIN_BOR:
+		return constInt(a | b)
+	case OPBIN_BXOR:
+		return constInt(a ^ b)
+	case OPBIN_LT:
+		return constBool(a < b)
+	case OPBIN_LE:
+		return constBool(a <= b)
+	case OPBIN_GT:
+		return constBool(a > b)
+	case OPBIN_GE:
+		return constBool(a >= b)
+	case OPBIN_EQ:
+		return constBool(a == b)
+	case OPBIN_NE:
+		return constBool(a != b)
+	}
+	return Const{}, false
+}
+
+// evalTernary requires both values to be constant even though only one of
+// them is chosen. This keeps us from folding away expressions which would not
+// type-check.
+func evalTernary(n *Ternary) (Const, bool) {
+	cond, ok := EvalConstBool(n.Cond)
+	if !ok {
+		return Const{}, false
+	}
+	t, ok := EvalConst(n.True)
+	if !ok {
+		return Const{}, false
+	}
+	f, ok := EvalConst(n.False)
+	if !ok || t.Kind != f.Kind {
+		return Const{}, false
+	}
+	if cond {
+		return t, true
+	}
+	return f, true
+}
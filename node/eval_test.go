@@ -0,0 +1,65 @@
+package node_test
+
+import (
+	"testing"
+
+	"github.com/susji/c0/lex"
+	"github.com/susji/c0/node"
+	"github.com/susji/c0/parse"
+	"github.com/susji/c0/testers/assert"
+	"github.com/susji/c0/testers/require"
+)
+
+func TestEvalConst(t *testing.T) {
+	type entry struct {
+		code string
+		want node.Const
+		ok   bool
+	}
+	i := func(v int32) node.Const { return node.Const{Kind: node.CONST_INT, Int: v} }
+	b := func(v bool) node.Const { return node.Const{Kind: node.CONST_BOOL, Bool: v} }
+	table := []entry{
+		{"1 + 2 * 3", i(7), true},
+		{"(1 + 2) * 3", i(9), true},
+		{"-7 / 2", i(-3), true},
+		{"-7 % 2", i(-1), true},
+		{"2147483647 + 1", i(-2147483648), true},
+		{"1 << 4 | 1", i(17), true},
+		{"~0 ^ 1", i(-2), true},
+		{"true", b(true), true},
+		{"!true || false", b(false), true},
+		{"1 < 2 && 3 >= 3", b(true), true},
+		{"true == (1 != 1)", b(false), true},
+		{"true ? 1 : 2", i(1), true},
+		{"1 > 2 ? 1 : 2", i(2), true},
+		{"1 / 0", node.Const{}, false},
+		{"1 % (2 - 2)", node.Const{}, false},
+		{"1 << 32", node.Const{}, false},
+		{"1 >> -1", node.Const{}, false},
+		{"x + 1", node.Const{}, false},
+		{"true && x", node.Const{}, false},
+		{"f()", node.Const{}, false},
+		{"'a' == 'a'", node.Const{}, false},
+		{"true ? 1 : x", node.Const{}, false},
+		{"1 == true", node.Const{}, false},
+	}
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			toks, lexerrs := lex.Lex([]rune(cur.code))
+			require.Equal(t, 0, len(lexerrs))
+			n, err := parse.New().Expr(toks)
+			require.Nil(t, err)
+			got, ok := node.EvalConst(n)
+			assert.Equal(t, cur.ok, ok)
+			assert.Equal(t, cur.want, got)
+		})
+	}
+}
+
+func TestEvalConstBool(t *testing.T) {
+	v, ok := node.EvalConstBool(&node.Bool{Value: true})
+	assert.True(t, ok)
+	assert.True(t, v)
+	_, ok = node.EvalConstBool(&node.Numeric{Value: 1})
+	assert.False(t, ok)
+}
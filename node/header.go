@@ -0,0 +1,80 @@
+package node
+
+import (
+	"fmt"
+	"strings"
+)
+
+var kindsources = [...]string{
+	"int",
+	"bool",
+	"string",
+	"struct",
+	"void",
+	"char",
+}
+
+// source returns the kind like it would be written in C0, eg. "struct s*[]".
+func (k *Kind) source() string {
+	var base string
+	switch k.Kind {
+	case KIND_TYPEDEF:
+		base = k.Name
+	case KIND_STRUCT:
+		base = "struct " + k.Name
+	default:
+		base = kindsources[k.Kind]
+	}
+	return base + strings.Repeat("*", k.PointerLevel) +
+		strings.Repeat("[]", k.ArrayLevel)
+}
+
+func paramsSource(params VarDecls) string {
+	ps := []string{}
+	for _, p := range params {
+		ps = append(ps, fmt.Sprintf("%s %s", p.Kind.source(), p.Name))
+	}
+	return strings.Join(ps, ", ")
+}
+
+// GenerateHeader produces C0 source containing only the declarations of the
+// given nodes, which is suitable for a header included with "#use". Function
+// definitions are turned into declarations. Typedefs and structs are kept as
+// they are, and everything else is dropped. As the nodes of an included file
+// have already been spliced in by the parser, the "#use" directives are
+// dropped too. The comments attached to the kept nodes are kept as well.
+func GenerateHeader(nodes []Node) string {
+	ret := &strings.Builder{}
+	for _, n := range nodes {
+		b := &strings.Builder{}
+		switch t := n.(type) {
+		case *Typedef:
+			fmt.Fprintf(b, "typedef %s %s;\n", t.Kind.source(), t.Name)
+		case *TypedefFunc:
+			fmt.Fprintf(b, "typedef %s %s(%s);\n",
+				t.Returns.source(), t.Name, paramsSource(t.Params))
+		case *StructForwardDecl:
+			fmt.Fprintf(b, "struct %s;\n", t.Value)
+		case *Struct:
+			fmt.Fprintf(b, "struct %s {\n", t.Name)
+			for _, m := range t.Members {
+				fmt.Fprintf(b, "\t%s %s;\n", m.Kind.source(), m.Name)
+			}
+			b.WriteString("};\n")
+		case *FunDecl:
+			fmt.Fprintf(b, "%s %s(%s);\n",
+				t.Returns.source(), t.Name, paramsSource(t.Params))
+		case *FunDef:
+			fmt.Fprintf(b, "%s %s(%s);\n",
+				t.Returns.source(), t.Name, paramsSource(t.Params))
+		}
+		if b.Len() == 0 {
+			continue
+		}
+		for _, comment := range Comments(n.Id()) {
+			fmt.Fprintln(ret, comment)
+		}
+		ret.WriteString(b.String())
+	}
+	return ret.String()
+}
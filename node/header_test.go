@@ -0,0 +1,66 @@
+package node_test
+
+import (
+	"testing"
+
+	"github.com/susji/c0/analyze"
+	"github.com/susji/c0/lex"
+	"github.com/susji/c0/node"
+	"github.com/susji/c0/parse"
+	"github.com/susji/c0/testers/assert"
+	"github.com/susji/c0/testers/require"
+)
+
+func TestGenerateHeader(t *testing.T) {
+	orig := parsed(t, `
+struct node;
+struct list {
+	struct node* first;
+	int[] counts;
+};
+typedef struct list* lp;
+typedef bool pred(int a);
+int length(lp l) {
+	int n = 0;
+	return n;
+}
+void append(lp l, string*[] what, char c) {
+	return;
+}
+`)
+	header := node.GenerateHeader(orig)
+	t.Log(header)
+	assert.Equal(t, `struct node;
+struct list {
+	struct node* first;
+	int[] counts;
+};
+typedef struct list* lp;
+typedef bool pred(int a);
+int length(lp l);
+void append(lp l, string*[] what, char c);
+`, header)
+
+	toks, lexerrs := lex.Lex([]rune(header))
+	require.Equal(t, 0, len(lexerrs))
+	p := parse.New()
+	require.Nil(t, p.Parse(toks))
+	got := p.Nodes()
+	require.Equal(t, len(orig), len(got))
+	for i, n := range got {
+		switch o := orig[i].(type) {
+		case *node.FunDef:
+			assert.Equal(t, o.FunDecl.String(), n.String())
+		default:
+			assert.Equal(t, o.String(), n.String())
+		}
+	}
+
+	a := analyze.New(p.Fn())
+	require.Equal(t, 0, len(a.Analyze(got)))
+	res := a.Results()
+	assert.NotNil(t, res.Functions["length"])
+	assert.NotNil(t, res.Functions["append"])
+	assert.NotNil(t, res.Structs["list"])
+	assert.NotNil(t, res.Typedefs["lp"])
+}
@@ -0,0 +1,569 @@
+package node
+
+// The contents of this file are responsible for encoding a forest of syntax
+// trees as JSON and back. Each Node is encoded as an object, which contains a
+// type discriminator ("node"), the Token it originated from ("tok"), if any,
+// and its Node-specific fields. Enumerations are encoded with their
+// stringified names instead of plain integers so the format is not affected
+// by reordering of the constants.
+//
+// When decoding, each Node with a Token is again Store'd. This means that the
+// Node identifiers will not survive the round trip, but everything else will.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/susji/c0/span"
+	"github.com/susji/c0/token"
+)
+
+type jsonObject map[string]interface{}
+type jsonFields map[string]json.RawMessage
+
+type jsonToken struct {
+	Kind  string    `json:"kind"`
+	Value string    `json:"value"`
+	Span  span.Span `json:"span"`
+}
+
+func nameindex(names []string, name string) (int, error) {
+	for i, cur := range names {
+		if cur == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unrecognized name: %q", name)
+}
+
+func errstrings(errs []error) []string {
+	ret := []string{}
+	for _, err := range errs {
+		ret = append(ret, err.Error())
+	}
+	return ret
+}
+
+func encodeTok(tok *token.Token) *jsonToken {
+	if tok == nil {
+		return nil
+	}
+	return &jsonToken{
+		Kind:  tok.Kind().String(),
+		Value: tok.Value(),
+		Span:  tok.Span(),
+	}
+}
+
+func encodeVarDecls(vds VarDecls) []interface{} {
+	ret := []interface{}{}
+	for i := range vds {
+		ret = append(ret, encode(&vds[i]))
+	}
+	return ret
+}
+
+func encodeNodes(nodes []Node) []interface{} {
+	ret := []interface{}{}
+	for _, n := range nodes {
+		ret = append(ret, encode(n))
+	}
+	return ret
+}
+
+func encode(n Node) interface{} {
+	if n == nil {
+		return nil
+	}
+	o := jsonObject{}
+	var name string
+	switch t := n.(type) {
+	case *Variable:
+		name = "Variable"
+		o["value"] = t.Value
+	case *Numeric:
+		name = "Numeric"
+		o["value"] = t.Value
+		o["base"] = t.Base
+	case *StructForwardDecl:
+		name = "StructForwardDecl"
+		o["value"] = t.Value
+	case *Struct:
+		name = "Struct"
+		o["name"] = t.Name
+		o["members"] = encodeVarDecls(t.Members)
+	case *StrLit:
+		name = "StrLit"
+		o["value"] = t.Value
+	case *ChrLit:
+		name = "ChrLit"
+		o["value"] = t.Value
+	case *LibLit:
+		name = "LibLit"
+		o["value"] = t.Value
+	case *Bool:
+		name = "Bool"
+		o["value"] = t.Value
+	case *Null:
+		name = "Null"
+	case *Args:
+		name = "Args"
+		o["value"] = encodeNodes(t.Value)
+	case *OpUnary:
+		name = "OpUnary"
+		o["op"] = opunnames[t.Op]
+		o["to"] = encode(t.To)
+	case *OpBinary:
+		name = "OpBinary"
+		o["op"] = opbinnames[t.Op]
+		o["left"] = encode(t.Left)
+		o["right"] = encode(t.Right)
+	case *Ternary:
+		name = "Ternary"
+		o["cond"] = encode(t.Cond)
+		o["true"] = encode(t.True)
+		o["false"] = encode(t.False)
+	case *OpAssign:
+		name = "OpAssign"
+		o["op"] = opasnnames[t.Op]
+		o["to"] = encode(t.To)
+		o["what"] = encode(t.What)
+	case *Block:
+		name = "Block"
+		o["value"] = encodeNodes(t.Value)
+	case *VarDeclList:
+		name = "VarDeclList"
+		o["value"] = encodeNodes(t.Value)
+	case *If:
+		name = "If"
+		o["cond"] = encode(t.Cond)
+		o["true"] = encode(t.True)
+		o["false"] = encode(t.False)
+	case *For:
+		name = "For"
+		o["init"] = encode(t.Init)
+		o["cond"] = encode(t.Cond)
+		o["oneach"] = encode(t.OnEach)
+		o["body"] = encode(t.Body)
+	case *While:
+		name = "While"
+		o["cond"] = encode(t.Cond)
+		o["body"] = encode(t.Body)
+	case *DoWhile:
+		name = "DoWhile"
+		o["body"] = encode(t.Body)
+		o["cond"] = encode(t.Cond)
+	case *Return:
+		name = "Return"
+		o["expr"] = encode(t.Expr)
+	case *Assert:
+		name = "Assert"
+		o["expr"] = encode(t.Expr)
+	case *Error:
+		name = "Error"
+		o["expr"] = encode(t.Expr)
+	case *Alloc:
+		name = "Alloc"
+		o["kind"] = encode(&t.Kind)
+	case *AllocArray:
+		name = "AllocArray"
+		o["kind"] = encode(&t.Kind)
+		o["n"] = encode(t.N)
+	case *SizeOf:
+		name = "SizeOf"
+		o["kind"] = encode(&t.Kind)
+	case *Typedef:
+		name = "Typedef"
+		o["name"] = t.Name
+		o["kind"] = encode(&t.Kind)
+	case *TypedefFunc:
+		name = "TypedefFunc"
+		o["name"] = t.Name
+		o["returns"] = encode(&t.Returns)
+		o["params"] = encodeVarDecls(t.Params)
+	case *Break:
+		name = "Break"
+	case *Continue:
+		name = "Continue"
+	case *Empty:
+		name = "Empty"
+	case *Label:
+		name = "Label"
+		o["name"] = t.Name
+	case *Goto:
+		name = "Goto"
+		o["target"] = t.Target
+	case *Cast:
+		name = "Cast"
+		o["to"] = encode(&t.To)
+		o["what"] = encode(t.What)
+	case *VarDecl:
+		name = "VarDecl"
+		o["kind"] = encode(&t.Kind)
+		o["name"] = t.Name
+	case *FunDecl:
+		name = "FunDecl"
+		o["name"] = t.Name
+		o["returns"] = encode(&t.Returns)
+		o["params"] = encodeVarDecls(t.Params)
+	case *FunDef:
+		name = "FunDef"
+		o["decl"] = encode(&t.FunDecl)
+		o["body"] = encode(&t.Body)
+	case *Kind:
+		name = "Kind"
+		o["kind"] = kindnames[t.Kind]
+		o["pointerlevel"] = t.PointerLevel
+		o["arraylevel"] = t.ArrayLevel
+		o["name"] = t.Name
+	case *DirectiveUse:
+		name = "DirectiveUse"
+		o["success"] = t.Success
+		o["how"] = encode(t.How)
+		o["nodes"] = encodeNodes(t.Nodes)
+		o["lexerrors"] = errstrings(t.LexErrors)
+		o["parseerrors"] = errstrings(t.ParseErrors)
+		tds := []string{}
+		for td := range t.Typedefs {
+			tds = append(tds, td)
+		}
+		sort.Strings(tds)
+		o["typedefs"] = tds
+	case *ErrorNode:
+		name = "ErrorNode"
+		o["err"] = t.Err.Error()
+	default:
+		panic(fmt.Sprintf("encode: unhandled %T: %s", t, t))
+	}
+	o["node"] = name
+	if tok := encodeTok(n.Tok()); tok != nil {
+		o["tok"] = tok
+	}
+	return o
+}
+
+// ToJSON encodes the given syntax trees as a JSON array.
+func ToJSON(nodes []Node) ([]byte, error) {
+	return json.Marshal(encodeNodes(nodes))
+}
+
+type decoder struct {
+	f   jsonFields
+	err error
+}
+
+func (d *decoder) field(key string, to interface{}) {
+	if d.err != nil {
+		return
+	}
+	raw, ok := d.f[key]
+	if !ok {
+		d.err = fmt.Errorf("missing field %q", key)
+		return
+	}
+	if err := json.Unmarshal(raw, to); err != nil {
+		d.err = fmt.Errorf("field %q: %w", key, err)
+	}
+}
+
+func (d *decoder) str(key string) string {
+	var ret string
+	d.field(key, &ret)
+	return ret
+}
+
+func (d *decoder) int(key string) int {
+	var ret int
+	d.field(key, &ret)
+	return ret
+}
+
+func (d *decoder) bool(key string) bool {
+	var ret bool
+	d.field(key, &ret)
+	return ret
+}
+
+func (d *decoder) strs(key string) []string {
+	var ret []string
+	d.field(key, &ret)
+	return ret
+}
+
+func (d *decoder) errors(key string) []error {
+	var ret []error
+	for _, cur := range d.strs(key) {
+		ret = append(ret, errors.New(cur))
+	}
+	return ret
+}
+
+func (d *decoder) enum(key string, names []string) int {
+	if d.err != nil {
+		return 0
+	}
+	i, err := nameindex(names, d.str(key))
+	if err != nil && d.err == nil {
+		d.err = fmt.Errorf("field %q: %w", key, err)
+	}
+	return i
+}
+
+func (d *decoder) node(key string) Node {
+	if d.err != nil {
+		return nil
+	}
+	raw, ok := d.f[key]
+	if !ok {
+		d.err = fmt.Errorf("missing field %q", key)
+		return nil
+	}
+	n, err := decode(raw)
+	if err != nil {
+		d.err = fmt.Errorf("field %q: %w", key, err)
+	}
+	return n
+}
+
+func (d *decoder) nodes(key string) []Node {
+	var raws []json.RawMessage
+	d.field(key, &raws)
+	ret := []Node{}
+	for _, raw := range raws {
+		if d.err != nil {
+			return nil
+		}
+		n, err := decode(raw)
+		if err != nil {
+			d.err = fmt.Errorf("field %q: %w", key, err)
+			return nil
+		}
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+func (d *decoder) kind(key string) Kind {
+	if k, ok := d.node(key).(*Kind); ok {
+		return *k
+	}
+	if d.err == nil {
+		d.err = fmt.Errorf("field %q: expecting Kind", key)
+	}
+	return Kind{}
+}
+
+func (d *decoder) vardecls(key string) VarDecls {
+	ret := VarDecls{}
+	for _, n := range d.nodes(key) {
+		vd, ok := n.(*VarDecl)
+		if !ok {
+			if d.err == nil {
+				d.err = fmt.Errorf("field %q: expecting VarDecl", key)
+			}
+			return nil
+		}
+		ret = append(ret, *vd)
+	}
+	return ret
+}
+
+func decodeTok(raw json.RawMessage) (*token.Token, error) {
+	jt := &jsonToken{}
+	if err := json.Unmarshal(raw, jt); err != nil {
+		return nil, err
+	}
+	kind, err := token.KindFromString(jt.Kind)
+	if err != nil {
+		return nil, err
+	}
+	tok := token.New(kind, jt.Span, jt.Value)
+	return &tok, nil
+}
+
+func decode(raw json.RawMessage) (Node, error) {
+	if string(raw) == "null" {
+		return nil, nil
+	}
+	d := &decoder{f: jsonFields{}}
+	if err := json.Unmarshal(raw, &d.f); err != nil {
+		return nil, err
+	}
+	var ret Node
+	switch name := d.str("node"); name {
+	case "Variable":
+		ret = &Variable{Value: d.str("value")}
+	case "Numeric":
+		ret = &Numeric{Value: int32(d.int("value")), Base: d.int("base")}
+	case "StructForwardDecl":
+		ret = &StructForwardDecl{Value: d.str("value")}
+	case "Struct":
+		ret = &Struct{Name: d.str("name"), Members: d.vardecls("members")}
+	case "StrLit":
+		ret = &StrLit{Value: d.str("value")}
+	case "ChrLit":
+		ret = &ChrLit{Value: rune(d.int("value"))}
+	case "LibLit":
+		ret = &LibLit{Value: d.str("value")}
+	case "Bool":
+		ret = &Bool{Value: d.bool("value")}
+	case "Null":
+		ret = &Null{}
+	case "Args":
+		ret = &Args{Value: d.nodes("value")}
+	case "OpUnary":
+		ret = &OpUnary{
+			Op: KindOpUn(d.enum("op", opunnames[:])),
+			To: d.node("to"),
+		}
+	case "OpBinary":
+		ret = &OpBinary{
+			Op:    KindOpBin(d.enum("op", opbinnames[:])),
+			Left:  d.node("left"),
+			Right: d.node("right"),
+		}
+	case "Ternary":
+		ret = &Ternary{
+			Cond:  d.node("cond"),
+			True:  d.node("true"),
+			False: d.node("false"),
+		}
+	case "OpAssign":
+		ret = &OpAssign{
+			Op:   KindOpAsn(d.enum("op", opasnnames[:])),
+			To:   d.node("to"),
+			What: d.node("what"),
+		}
+	case "Block":
+		ret = &Block{Value: d.nodes("value")}
+	case "VarDeclList":
+		ret = &VarDeclList{Value: d.nodes("value")}
+	case "If":
+		ret = &If{
+			Cond:  d.node("cond"),
+			True:  d.node("true"),
+			False: d.node("false"),
+		}
+	case "For":
+		ret = &For{
+			Init:   d.node("init"),
+			Cond:   d.node("cond"),
+			OnEach: d.node("oneach"),
+			Body:   d.node("body"),
+		}
+	case "While":
+		ret = &While{Cond: d.node("cond"), Body: d.node("body")}
+	case "DoWhile":
+		ret = &DoWhile{Body: d.node("body"), Cond: d.node("cond")}
+	case "Return":
+		ret = &Return{Expr: d.node("expr")}
+	case "Assert":
+		ret = &Assert{Expr: d.node("expr")}
+	case "Error":
+		ret = &Error{Expr: d.node("expr")}
+	case "Alloc":
+		ret = &Alloc{Kind: d.kind("kind")}
+	case "AllocArray":
+		ret = &AllocArray{Kind: d.kind("kind"), N: d.node("n")}
+	case "SizeOf":
+		ret = &SizeOf{Kind: d.kind("kind")}
+	case "Typedef":
+		ret = &Typedef{Name: d.str("name"), Kind: d.kind("kind")}
+	case "TypedefFunc":
+		ret = &TypedefFunc{
+			Name:    d.str("name"),
+			Returns: d.kind("returns"),
+			Params:  d.vardecls("params"),
+		}
+	case "Break":
+		ret = &Break{}
+	case "Continue":
+		ret = &Continue{}
+	case "Empty":
+		ret = &Empty{}
+	case "Label":
+		ret = &Label{Name: d.str("name")}
+	case "Goto":
+		ret = &Goto{Target: d.str("target")}
+	case "Cast":
+		ret = &Cast{To: d.kind("to"), What: d.node("what")}
+	case "VarDecl":
+		ret = &VarDecl{Kind: d.kind("kind"), Name: d.str("name")}
+	case "FunDecl":
+		ret = &FunDecl{
+			Name:    d.str("name"),
+			Returns: d.kind("returns"),
+			Params:  d.vardecls("params"),
+		}
+	case "FunDef":
+		fd, ok := d.node("decl").(*FunDecl)
+		if !ok && d.err == nil {
+			d.err = errors.New(`field "decl": expecting FunDecl`)
+		}
+		body, ok := d.node("body").(*Block)
+		if !ok && d.err == nil {
+			d.err = errors.New(`field "body": expecting Block`)
+		}
+		if d.err == nil {
+			ret = &FunDef{FunDecl: *fd, Body: *body}
+		}
+	case "Kind":
+		kind := KindEnum(d.enum("kind", kindnames[:]))
+		pointerlevel := d.int("pointerlevel")
+		arraylevel := d.int("arraylevel")
+		name := d.str("name")
+		if d.err == nil {
+			k := NewKind(kind, pointerlevel, arraylevel, name)
+			ret = &k
+		}
+	case "DirectiveUse":
+		tds := map[string]struct{}{}
+		for _, td := range d.strs("typedefs") {
+			tds[td] = struct{}{}
+		}
+		ret = &DirectiveUse{
+			Success:     d.bool("success"),
+			How:         d.node("how"),
+			Nodes:       d.nodes("nodes"),
+			LexErrors:   d.errors("lexerrors"),
+			ParseErrors: d.errors("parseerrors"),
+			Typedefs:    tds,
+		}
+	case "ErrorNode":
+		ret = &ErrorNode{Err: errors.New(d.str("err"))}
+	default:
+		if d.err == nil {
+			d.err = fmt.Errorf("unrecognized node: %q", name)
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if rawtok, ok := d.f["tok"]; ok {
+		tok, err := decodeTok(rawtok)
+		if err != nil {
+			return nil, fmt.Errorf("field \"tok\": %w", err)
+		}
+		ret = Store(tok, ret)
+	}
+	return ret, nil
+}
+
+// FromJSON decodes syntax trees previously encoded with ToJSON.
+func FromJSON(data []byte) ([]Node, error) {
+	var raws []json.RawMessage
+	if err := json.Unmarshal(data, &raws); err != nil {
+		return nil, err
+	}
+	ret := []Node{}
+	for _, raw := range raws {
+		n, err := decode(raw)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, n)
+	}
+	return ret, nil
+}
@@ -0,0 +1,130 @@
+package node_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/susji/c0/lex"
+	"github.com/susji/c0/node"
+	"github.com/susji/c0/parse"
+	"github.com/susji/c0/testers/assert"
+	"github.com/susji/c0/testers/require"
+)
+
+func parsed(t *testing.T, code string) []node.Node {
+	toks, lexerrs := lex.Lex([]rune(code))
+	require.Equal(t, 0, len(lexerrs))
+	p := parse.New()
+	require.Nil(t, p.Parse(toks))
+	return p.Nodes()
+}
+
+func flatten(nodes []node.Node) []node.Node {
+	ret := []node.Node{}
+	for _, n := range nodes {
+		node.Walk(n, func(n node.Node, _ int) bool {
+			ret = append(ret, n)
+			return true
+		})
+	}
+	return ret
+}
+
+func TestJSONRoundtrip(t *testing.T) {
+	orig := parsed(t, `
+struct point {
+	int x;
+	int y;
+};
+typedef struct point* pp;
+typedef int cmp(int a, int b);
+int f(pp p, int[] a) {
+	int ret = 0;
+	for (int i = 0; i < p->x; i++) {
+		ret += a[i] * -p->y;
+		if (!true && ret != -1)
+			continue;
+		else
+			break;
+	}
+	while (ret >= 0) {
+		ret--;
+	}
+	for (;;) {
+		;
+		break;
+	}
+	do {
+		ret++;
+	} while (ret < 0);
+	assert(ret == -1);
+	char c = '\n';
+	int d1, d2 = 2;
+	string s = "hello";
+	int *z = alloc(int);
+	int[] zs = alloc_array(int, 0x10);
+	bool b = true ? false : z == NULL;
+	goto done;
+done:
+	return (int)ret;
+}
+`)
+	data, err := node.ToJSON(orig)
+	require.Nil(t, err)
+	t.Log(string(data))
+	// Enumerations should be stored with their names.
+	assert.True(t, strings.Contains(string(data), `"op":"+="`))
+	assert.True(t, strings.Contains(string(data), `"kind":"Struct"`))
+
+	got, err := node.FromJSON(data)
+	require.Nil(t, err)
+	require.Equal(t, len(orig), len(got))
+	for i := range orig {
+		assert.Equal(t, orig[i].String(), got[i].String())
+	}
+
+	origs, gots := flatten(orig), flatten(got)
+	require.Equal(t, len(origs), len(gots))
+	for i := range origs {
+		if origs[i] == nil {
+			assert.Nil(t, gots[i])
+			continue
+		}
+		assert.Equal(t, origs[i].String(), gots[i].String())
+		ot, gt := origs[i].Tok(), gots[i].Tok()
+		if ot == nil {
+			assert.Nil(t, gt)
+			continue
+		}
+		require.NotNil(t, gt)
+		assert.Equal(t, ot.Span(), gt.Span())
+		assert.Equal(t, ot.Kind(), gt.Kind())
+		assert.Equal(t, ot.Value(), gt.Value())
+	}
+}
+
+func TestJSONErrorNode(t *testing.T) {
+	orig := []node.Node{&node.ErrorNode{Err: errors.New("broken")}}
+	data, err := node.ToJSON(orig)
+	require.Nil(t, err)
+	got, err := node.FromJSON(data)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(got))
+	assert.Equal(t, orig[0].String(), got[0].String())
+}
+
+func TestJSONInvalid(t *testing.T) {
+	table := []string{
+		`{}`,
+		`[{"node": "Nonexistent"}]`,
+		`[{"node": "OpBinary", "op": "nope", "left": null, "right": null}]`,
+		`[{"node": "Variable"}]`,
+	}
+	for _, cur := range table {
+		t.Run(cur, func(t *testing.T) {
+			_, err := node.FromJSON([]byte(cur))
+			assert.NotNil(t, err)
+		})
+	}
+}
@@ -22,8 +22,8 @@ type Node interface {
 	Tok() *token.Token
 }
 
-// Loop is a pseudo-interface used to tag valid loop constructs, namely "while"
-// and "for".
+// Loop is a pseudo-interface used to tag valid loop constructs, namely "while",
+// "do-while", and "for".
 type Loop interface {
 	Loop()
 }
@@ -91,6 +91,13 @@ type OpBinary struct {
 	Left, Right Node
 }
 
+// Ternary is the conditional expression "Cond ? True : False".
+type Ternary struct {
+	*Common
+	Cond        Node
+	True, False Node
+}
+
 type OpAssign struct {
 	*Common
 	Op       KindOpAsn
@@ -102,6 +109,14 @@ type Block struct {
 	Value []Node
 }
 
+// VarDeclList is a declaration with multiple declarators sharing the same
+// type, such as "int a = 1, b;". Each value is an OpAssign to a VarDecl with
+// a possibly nil initializer. Unlike Block, it does not open a new scope.
+type VarDeclList struct {
+	*Common
+	Value []Node
+}
+
 type If struct {
 	*Common
 	Cond        Node
@@ -118,6 +133,12 @@ type While struct {
 	Cond, Body Node
 }
 
+// DoWhile is a loop whose body is evaluated once before its condition.
+type DoWhile struct {
+	*Common
+	Body, Cond Node
+}
+
 type Return struct {
 	*Common
 	Expr Node
@@ -144,6 +165,12 @@ type AllocArray struct {
 	N    Node
 }
 
+// SizeOf is "sizeof(<tp>)", which evaluates to the size of a type in bytes.
+type SizeOf struct {
+	*Common
+	Kind Kind
+}
+
 type Typedef struct {
 	*Common
 	Name string
@@ -165,6 +192,22 @@ type Continue struct {
 	*Common
 }
 
+// Empty is the empty statement ";", which does nothing.
+type Empty struct {
+	*Common
+}
+
+// Label marks the place a Goto with the same name jumps to.
+type Label struct {
+	*Common
+	Name string
+}
+
+type Goto struct {
+	*Common
+	Target string
+}
+
 type Cast struct {
 	*Common
 	To   Kind
@@ -209,8 +252,6 @@ const (
 	OPBIN_FUNCALL
 	OPBIN_STRUCTDEC
 	OPBIN_STRUCTPTRDEC
-	OPBIN_TERNARYCOND
-	OPBIN_TERNARYVALS
 	OPBIN_SHIFTR
 	OPBIN_SHIFTL
 	OPBIN_LE
@@ -236,8 +277,6 @@ var opbinnames = [...]string{
 	"CALL",
 	".",
 	"->",
-	"?",
-	":",
 	">>",
 	"<<",
 	"<=",
@@ -400,6 +439,14 @@ type DirectiveUse struct {
 	Typedefs               map[string]struct{}
 }
 
+// ErrorNode takes the place of a global declaration or definition which
+// could not be parsed. This way the nodes around it are kept in order for
+// tools which can make use of a partially parsed file.
+type ErrorNode struct {
+	*Common
+	Err error
+}
+
 func (n *Numeric) String() string {
 	return fmt.Sprintf("%d", n.Value)
 }
@@ -422,6 +469,10 @@ func (n *DirectiveUse) String() string {
 		n.Success, n.How, n.Typedefs, n.Nodes, n.LexErrors, n.ParseErrors)
 }
 
+func (n *ErrorNode) String() string {
+	return fmt.Sprintf("(error-node %q)", n.Err)
+}
+
 func (n *VarDecl) String() string {
 	return fmt.Sprintf("(vardecl %q %s)", n.Name, &n.Kind)
 }
@@ -456,6 +507,16 @@ func (n *Block) String() string {
 	return b.String()
 }
 
+func (n *VarDeclList) String() string {
+	b := &strings.Builder{}
+	b.WriteString("(vardecls")
+	for _, decl := range n.Value {
+		b.WriteString(fmt.Sprintf(" %s", decl))
+	}
+	b.WriteString(")")
+	return b.String()
+}
+
 func (n *If) String() string {
 	b := &strings.Builder{}
 	b.WriteString(fmt.Sprintf("(if %s", n.Cond))
@@ -469,12 +530,28 @@ func (n *If) String() string {
 	return b.String()
 }
 
+func (n *Ternary) String() string {
+	return fmt.Sprintf("(? %s %s %s)", n.Cond, n.True, n.False)
+}
+
 func (n *While) String() string {
 	return fmt.Sprintf("(while %s %s)", n.Cond, n.Body)
 }
 
+func (n *DoWhile) String() string {
+	return fmt.Sprintf("(do-while %s %s)", n.Body, n.Cond)
+}
+
 func (n *For) String() string {
-	return fmt.Sprintf("(for %s %s %s %s)", n.Init, n.Cond, n.OnEach, n.Body)
+	// Each of the clauses may be empty.
+	clause := func(c Node) string {
+		if c == nil {
+			return "'empty"
+		}
+		return c.String()
+	}
+	return fmt.Sprintf("(for %s %s %s %s)",
+		clause(n.Init), clause(n.Cond), clause(n.OnEach), n.Body)
 }
 
 func (n *Bool) String() string {
@@ -543,6 +620,10 @@ func (n *Alloc) String() string {
 	return fmt.Sprintf("(alloc %s)", &n.Kind)
 }
 
+func (n *SizeOf) String() string {
+	return fmt.Sprintf("(sizeof %s)", &n.Kind)
+}
+
 func (n *AllocArray) String() string {
 	return fmt.Sprintf("(alloc-array %s %s)", &n.Kind, n.N)
 }
@@ -555,6 +636,18 @@ func (n *Continue) String() string {
 	return "(continue)"
 }
 
+func (n *Empty) String() string {
+	return "(empty)"
+}
+
+func (n *Label) String() string {
+	return fmt.Sprintf("(label %q)", n.Name)
+}
+
+func (n *Goto) String() string {
+	return fmt.Sprintf("(goto %q)", n.Target)
+}
+
 func (n *Typedef) String() string {
 	return fmt.Sprintf("(typedef %q %s)", n.Name, &n.Kind)
 }
@@ -588,10 +681,17 @@ func (p VarDecls) String() string {
 }
 
 func (c *Common) Id() NodeId {
+	if c == nil {
+		return NODEID_INVALID
+	}
 	return c.id
 }
 
 func (c *Common) Tok() *token.Token {
+	// Nodes which were never Store'd have no tokens.
+	if c == nil {
+		return nil
+	}
 	return Tok(c.id)
 }
 
@@ -601,10 +701,8 @@ func (c *Common) Tok() *token.Token {
 // path.
 type NodeCallback func(Node, int) bool
 
-func walk(node Node, cb NodeCallback, depth int) {
-	if !cb(node, depth) {
-		return
-	}
+// children lists the immediate sub-nodes of node in their traversal order.
+func children(node Node) []Node {
 	sub := []Node{}
 	a := func(n Node) {
 		sub = append(sub, n)
@@ -615,6 +713,10 @@ func walk(node Node, cb NodeCallback, depth int) {
 	case *OpBinary:
 		a(t.Left)
 		a(t.Right)
+	case *Ternary:
+		a(t.Cond)
+		a(t.True)
+		a(t.False)
 	case *OpAssign:
 		a(t.To)
 		a(t.What)
@@ -626,19 +728,23 @@ func walk(node Node, cb NodeCallback, depth int) {
 		}
 	case *FunDecl:
 		a(&t.Returns)
-		for _, param := range t.Params {
-			a(&param)
+		for i := range t.Params {
+			a(&t.Params[i])
 		}
 	case *FunDef:
 		a(&t.Returns)
-		for _, param := range t.Params {
-			a(&param)
+		for i := range t.Params {
+			a(&t.Params[i])
 		}
 		a(&t.Body)
 	case *Block:
 		for _, param := range t.Value {
 			a(param)
 		}
+	case *VarDeclList:
+		for _, decl := range t.Value {
+			a(decl)
+		}
 	case *If:
 		a(t.True)
 		a(t.False)
@@ -650,6 +756,9 @@ func walk(node Node, cb NodeCallback, depth int) {
 	case *While:
 		a(t.Cond)
 		a(t.Body)
+	case *DoWhile:
+		a(t.Body)
+		a(t.Cond)
 	case *Return:
 		a(t.Expr)
 	case *Assert:
@@ -658,15 +767,40 @@ func walk(node Node, cb NodeCallback, depth int) {
 		a(t.Expr)
 	default:
 	}
-	for _, n := range sub {
+	return sub
+}
+
+func walk(node Node, cb NodeCallback, depth int) {
+	if !cb(node, depth) {
+		return
+	}
+	for _, n := range children(node) {
 		walk(n, cb, depth+1)
 	}
 }
 
+func walkpost(node Node, cb NodeCallback, depth int) bool {
+	for _, n := range children(node) {
+		if !walkpost(n, cb, depth+1) {
+			return false
+		}
+	}
+	return cb(node, depth)
+}
+
 // Walk performs a pre-order traversal of a syntax tree defined by node.
 func Walk(node Node, cb NodeCallback) {
 	walk(node, cb, 0)
 }
 
-func (l *While) Loop() {}
-func (l *For) Loop()   {}
+// WalkPost performs a post-order traversal of a syntax tree defined by node,
+// that is, all children are visited before their parent. As the children have
+// already been visited when cb sees a Node, returning false stops the whole
+// traversal instead of pruning a single path.
+func WalkPost(node Node, cb NodeCallback) {
+	walkpost(node, cb, 0)
+}
+
+func (l *While) Loop()   {}
+func (l *DoWhile) Loop() {}
+func (l *For) Loop()     {}
@@ -0,0 +1,61 @@
+package node_test
+
+import (
+	"testing"
+
+	"github.com/susji/c0/node"
+	"github.com/susji/c0/testers/assert"
+)
+
+func TestWalkOrder(t *testing.T) {
+	// (+ 1 (* 2 3))
+	tree := &node.OpBinary{
+		Op:   node.OPBIN_ADD,
+		Left: &node.Numeric{Value: 1},
+		Right: &node.OpBinary{
+			Op:    node.OPBIN_MUL,
+			Left:  &node.Numeric{Value: 2},
+			Right: &node.Numeric{Value: 3},
+		},
+	}
+	type visit struct {
+		what  string
+		depth int
+	}
+	collect := func(walker func(node.Node, node.NodeCallback)) []visit {
+		got := []visit{}
+		walker(tree, func(n node.Node, depth int) bool {
+			got = append(got, visit{n.String(), depth})
+			return true
+		})
+		return got
+	}
+	assert.Equal(t, []visit{
+		{"(+ 1 (* 2 3))", 0},
+		{"1", 1},
+		{"(* 2 3)", 1},
+		{"2", 2},
+		{"3", 2},
+	}, collect(node.Walk))
+	assert.Equal(t, []visit{
+		{"1", 1},
+		{"2", 2},
+		{"3", 2},
+		{"(* 2 3)", 1},
+		{"(+ 1 (* 2 3))", 0},
+	}, collect(node.WalkPost))
+}
+
+func TestWalkPostStop(t *testing.T) {
+	tree := &node.Block{Value: []node.Node{
+		&node.Numeric{Value: 1},
+		&node.Numeric{Value: 2},
+		&node.Numeric{Value: 3},
+	}}
+	seen := 0
+	node.WalkPost(tree, func(n node.Node, depth int) bool {
+		seen++
+		return seen < 2
+	})
+	assert.Equal(t, 2, seen)
+}
@@ -4,7 +4,6 @@ import (
 	"errors"
 	"fmt"
 
-	"github.com/susji/c0/analyze"
 	"github.com/susji/c0/node"
 	"github.com/susji/c0/token"
 )
@@ -28,7 +27,7 @@ func (p *Parser) VarDecl(toks *token.Tokens) (*node.VarDecl, error) {
 			"not a var declaration, expecting identifier, got %v",
 			next)
 	}
-	if analyze.IsReserved(next.Value()) {
+	if p.dialect.IsReserved(next.Value()) {
 		return nil, p.errorf(next,
 			"reserved identifier %q for variable declaration", next.Value())
 	}
@@ -72,7 +71,7 @@ func (p *Parser) TopVarDecl(toks *token.Tokens) (node.Node, error) {
 			return sd, nil
 		}
 	}
-	if analyze.IsReserved(next.Value()) {
+	if p.dialect.IsReserved(next.Value()) {
 		return nil, p.errorf(next,
 			"reserved identifier %q for variable declaration", next.Value())
 	}
@@ -161,14 +160,13 @@ func (p *Parser) StructDef(toks *token.Tokens, name string) (node.Node, error) {
 		if mid != nil && mid.Kind() != token.Id {
 			return nil, p.errorf(cur, "expecting struct member name, got %s", mid)
 		}
-		if analyze.IsReserved(mid.Value()) {
+		if p.dialect.IsReserved(mid.Value()) {
 			return nil,
 				p.errorf(mid, "struct member %q is a reserved identifier", mid.Value())
 		}
 		toks.Pop()
-		if err := toks.Accept(token.Semicolon); err != nil {
-			return nil,
-				p.errorf(cur, "struct definition member missing ';'")
+		if err := p.semicolon(toks, "struct definition member missing ';'"); err != nil {
+			return nil, err
 		}
 		ms = append(ms, node.VarDecl{Kind: mk, Name: mid.Value()})
 		cur = toks.Peek()
@@ -181,8 +179,8 @@ func (p *Parser) StructDef(toks *token.Tokens, name string) (node.Node, error) {
 	if len(ms) == 0 {
 		return nil, p.errorf(first, "struct without any members")
 	}
-	if err := toks.Accept(token.Semicolon); err != nil {
-		return nil, p.errorf(first, "struct definition missing ';'")
+	if err := p.semicolon(toks, "struct definition missing ';'"); err != nil {
+		return nil, err
 	}
 	return node.Store(first, &node.Struct{
 		Name:    name,
@@ -227,7 +225,7 @@ func (p *Parser) TypedefDef(toks *token.Tokens) (node.Node, error) {
 		return nil, p.errorf(first, "expecting typedef identifier, got %s", aidtok)
 	}
 	aid := aidtok.Value()
-	if analyze.IsReserved(aid) {
+	if p.dialect.IsReserved(aid) {
 		return nil, p.errorf(aidtok, "typedef identifier %q is reserved", aid)
 	}
 	toks.Pop()
@@ -244,8 +242,8 @@ func (p *Parser) TypedefDef(toks *token.Tokens) (node.Node, error) {
 			Params:  pp,
 		}
 	}
-	if err := toks.Accept(token.Semicolon); err != nil {
-		return nil, p.errorf(aidtok, "typedef missing ';'")
+	if err := p.semicolon(toks, "typedef missing ';'"); err != nil {
+		return nil, err
 	}
 	if err := p.AddTypedef(aidtok, aid); err != nil {
 		return nil, p.errorf(aidtok, "invalid typedef: %w", err)
@@ -300,7 +298,7 @@ func (p *Parser) GlobalDeclDef(toks *token.Tokens) (node.Node, error) {
 					if fd, err := p.FuncDeclDef(toks, t); err == nil {
 						ret = fd
 					} else {
-						p.errorf(first,
+						return nil, p.errorf(first,
 							"invalid function definition/declaration: %w",
 							err)
 					}
@@ -3,23 +3,56 @@ package parse
 import (
 	"bytes"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/susji/c0/lex"
 	"github.com/susji/c0/node"
 	"github.com/susji/c0/token"
 )
 
+// usePath resolves the file a #use refers to. Like with C preprocessors, string
+// literals are relative to the directory of the including file and library
+// literals are sought from the library paths.
+func (p *Parser) usePath(what *token.Token) (string, error) {
+	path := what.Value()
+	if filepath.IsAbs(path) {
+		return path, nil
+	}
+	switch what.Kind() {
+	case token.UseStrLit:
+		if p.fn != stdin {
+			return filepath.Join(filepath.Dir(p.fn), path), nil
+		}
+	case token.UseLibLit:
+		for _, dir := range p.libpaths {
+			cand := filepath.Join(dir, path)
+			if _, err := os.Stat(cand); err == nil {
+				return cand, nil
+			}
+		}
+		if len(p.libpaths) == 0 {
+			return "", p.errorf(what, "%w: %s, no library paths given",
+				ErrNoLib, path)
+		}
+		return "", p.errorf(what, "%w: %s, searched %s",
+			ErrNoLib, path, strings.Join(p.libpaths, ", "))
+	}
+	return path, nil
+}
+
 // DirectiveUse handles and parses file includes. Noteworthily, the returned
-// error merely indicates if parsing of the directive was correct. The returned
-// struct will then contain potential lexing and parsing errors. Upper on the
-// chain, someone needs to decide how to handle the nodes and typedefs receveid
-// via this node -- see handleUse in parse.go.
+// error merely indicates if parsing of the directive was correct and that the
+// file can be read and is not already being parsed further up the chain of
+// #use. The returned struct will then contain potential lexing and parsing
+// errors. Upper on the chain, someone needs to decide how to handle the nodes
+// and typedefs receveid via this node -- see handleUse in parse.go.
 func (p *Parser) DirectiveUse(toks *token.Tokens) (*node.DirectiveUse, error) {
 	what := toks.Peek()
 	if what == nil {
 		panic("should not happen")
 	}
-	var ret *node.DirectiveUse
 	var val node.Node
 	switch what.Kind() {
 	case token.UseStrLit:
@@ -34,20 +67,39 @@ func (p *Parser) DirectiveUse(toks *token.Tokens) (*node.DirectiveUse, error) {
 	}
 	toks.Pop()
 
-	var lexerrs []error
-	var parerr error
-	var ntoks *token.Tokens
+	// Files using each other would have us recursing forever, so we keep
+	// track of which ones we are in the middle of parsing.
+	using := p.using
+	if len(using) == 0 {
+		if path, err := filepath.Abs(p.fn); err == nil {
+			using = []string{path}
+		}
+	}
+	fn, err := p.usePath(what)
+	if err != nil {
+		return nil, err
+	}
+	path, abserr := filepath.Abs(fn)
+	if abserr == nil {
+		for _, cur := range using {
+			if cur == path {
+				return nil, p.errorf(what, "%w: %s", ErrCycle, what.Value())
+			}
+		}
+	}
 
-	pn := NewFile(what.Value())
-	nsrc, readerr := ioutil.ReadFile(what.Value())
-	if readerr != nil {
-		goto end
-	}
-	ntoks, lexerrs = lex.Lex(bytes.Runes(nsrc))
-	parerr = pn.Parse(ntoks)
-end:
-	ret = node.Store(what, &node.DirectiveUse{
-		Success:     readerr == nil && len(lexerrs) == 0 && parerr == nil,
+	nsrc, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, p.errorf(what, "cannot read #use %s: %w", what.Value(), err)
+	}
+	pn := NewFile(fn)
+	pn.using = append(append([]string{}, using...), path)
+	pn.libpaths = p.libpaths
+	pn.dialect = p.dialect
+	ntoks, lexerrs := lex.LexFile(fn, bytes.Runes(nsrc))
+	parerr := pn.Parse(ntoks)
+	ret := node.Store(what, &node.DirectiveUse{
+		Success:     len(lexerrs) == 0 && parerr == nil,
 		How:         val,
 		Nodes:       pn.Nodes(),
 		LexErrors:   lexerrs,
@@ -13,6 +13,10 @@ type ParseError struct {
 }
 
 func (e *ParseError) Error() string {
+	// Running out of tokens leaves us without a position.
+	if e.Tok == nil {
+		return fmt.Sprintf("%s: %s", e.Fn, e.Wrapped)
+	}
 	lineno, col := e.Tok.Lineno(), e.Tok.Col()
 	return fmt.Sprintf("%s:%d:%d: %s", e.Fn, lineno, col, e.Wrapped)
 }
@@ -5,22 +5,23 @@ import (
 	"fmt"
 	"strconv"
 
-	"github.com/susji/c0/analyze"
 	"github.com/susji/c0/node"
 	"github.com/susji/c0/token"
 )
 
-var ErrAtomTypedef = errors.New("atom is typedef")
+var (
+	ErrAtomTypedef    = errors.New("atom is typedef")
+	ErrIntRange       = errors.New("integer literal out of 32-bit range")
+	ErrBadCharLiteral = errors.New("character literal must be a single character")
+)
 
 func precedenceb(tok *token.Token) int {
 	// We do not give a precedence value for assignment operators as they are
 	// apparently not meant to be interpreted as binary operators within
-	// expressions -- see "<simple>" vs. "<exp>". This decision has the
-	// downside that our grammar will not permit chained assignments, eg.
-	// "a = b = c = 10".
+	// expressions -- see "<simple>" vs. "<exp>". Chained assignments, eg.
+	// "a = b = c = 10", are handled when parsing "<simple>" instead.
 	switch tok.Kind() {
-	// assignment operators would go here
-	case token.Quest, token.Colon:
+	case token.Quest:
 		return 0
 	case token.DPipe:
 		return 1
@@ -51,11 +52,14 @@ func precedenceb(tok *token.Token) int {
 	}
 }
 
+// precunary is the precedence of prefix operators including casts.
+const precunary = 10
+
 func precedenceu(tok *token.Token) int {
 	switch tok.Kind() {
 	case token.Star, token.Exclam, token.Worm, token.Minus,
 		token.DPlus, token.DMinus, token.Ampersand:
-		return 10
+		return precunary
 	default:
 		panic(fmt.Sprintf("invalid unary operator: %s", tok))
 	}
@@ -63,7 +67,7 @@ func precedenceu(tok *token.Token) int {
 
 func isleftassocb(tok *token.Token) bool {
 	switch tok.Kind() {
-	case token.Quest, token.Colon,
+	case token.Quest,
 		token.Assign, token.AssignPlus, token.AssignMinus,
 		token.AssignStar, token.AssignSlash, token.AssignPercent,
 		token.AssignAmpersand, token.AssignHat, token.AssignPipe,
@@ -94,8 +98,6 @@ var tok_to_binop = map[token.Kind]node.KindOpBin{
 	token.LParen:     node.OPBIN_FUNCALL,
 	token.Dot:        node.OPBIN_STRUCTDEC,
 	token.Arrow:      node.OPBIN_STRUCTPTRDEC,
-	token.Quest:      node.OPBIN_TERNARYCOND,
-	token.Colon:      node.OPBIN_TERNARYVALS,
 	token.DGt:        node.OPBIN_SHIFTR,
 	token.DLt:        node.OPBIN_SHIFTL,
 	token.Le:         node.OPBIN_LE,
@@ -139,12 +141,21 @@ func (p *Parser) expratom(toks *token.Tokens) (node.Node, error) {
 		//   - casting, eg. "(int *)"
 		//   - a subexpression, eg. "(...)"
 		toks.Pop()
-		castkind, err := p.Type(toks)
+		// We only attempt a cast if a type follows as Type would otherwise
+		// record an error about an unknown typedef for eg. "(a + b)".
+		var castkind node.Kind
+		err := errors.New("not a cast")
+		if next := toks.Peek(); next != nil && next.Kind() == token.Id &&
+			(p.dialect.IsValidPrimitive(next.Value()) || p.IsTypedef(next.Value())) {
+			castkind, err = p.Type(toks)
+		}
 		if err == nil {
 			if err := toks.Accept(token.RParen); err != nil {
 				return nil, p.errorf(this, "invalid cast: %w", err)
 			}
-			castwhat, err := p.expratom(toks)
+			// Casts bind like the other prefix operators, so eg.
+			// "(int)x->f" casts "x->f" and "(char)x + 1" adds to the cast.
+			castwhat, err := p.exprparse(toks, precunary+1)
 			if err != nil {
 				return nil, err
 			}
@@ -171,12 +182,21 @@ func (p *Parser) expratom(toks *token.Tokens) (node.Node, error) {
 				val = val[2:]
 			}
 		}
-		pi, err := strconv.ParseInt(val, base, 32)
-		if err != nil {
+		// Hexadecimal literals give the bit pattern of the 32-bit two's
+		// complement integer, so eg. 0xFFFFFFFF is -1. Decimal literals
+		// have to be non-negative integers.
+		bits := 31
+		if base == 16 {
+			bits = 32
+		}
+		pi, err := strconv.ParseUint(val, base, bits)
+		if ne, ok := err.(*strconv.NumError); ok && ne.Err == strconv.ErrRange {
+			return nil, p.errorf(this, "%w: %s", ErrIntRange, this.Value())
+		} else if err != nil {
 			return nil, p.errorf(this, "invalid integer: %w", err)
 		}
 		return node.Store(
-				this, &node.Numeric{Value: int32(pi), Base: base}),
+				this, &node.Numeric{Value: int32(uint32(pi)), Base: base}),
 			nil
 	case token.Id:
 		iv := this.Value()
@@ -205,8 +225,8 @@ func (p *Parser) expratom(toks *token.Tokens) (node.Node, error) {
 				}
 				n, err := p.Expr(toks)
 				if err != nil {
-					return nil, p.errorf(this,
-						"invalid size expression for alloc_array: %w", err)
+					return nil, p.nestedf(this, err,
+						"invalid size expression for alloc_array: %w")
 				}
 				ret = node.Store(this, &node.AllocArray{
 					Kind: ak,
@@ -219,8 +239,26 @@ func (p *Parser) expratom(toks *token.Tokens) (node.Node, error) {
 				return nil, p.errorf(this, "%s missing ')'", iv)
 			}
 			return ret, nil
+		case "sizeof":
+			toks.Pop()
+			if err := toks.Accept(token.LParen); err != nil {
+				return nil, p.errorf(this, "sizeof missing '('")
+			}
+			sk, err := p.Type(toks)
+			if err != nil {
+				return nil, p.errorf(this, "invalid type for sizeof: %w", err)
+			}
+			if err := toks.Accept(token.RParen); err != nil {
+				return nil, p.errorf(this, "sizeof missing ')'")
+			}
+			return node.Store(this, &node.SizeOf{Kind: sk}), nil
 		default:
-			if analyze.IsReserved(this.Value()) {
+			// Like a typedef name, a primitive of the dialect begins a
+			// declaration instead.
+			if p.dialect.IsValidPrimitive(iv) {
+				return nil, ErrAtomTypedef
+			}
+			if p.dialect.IsReserved(this.Value()) {
 				return nil, fmt.Errorf(
 					"reserved identifier %q in expression", iv)
 			}
@@ -238,13 +276,21 @@ func (p *Parser) expratom(toks *token.Tokens) (node.Node, error) {
 		return node.Store(this, &node.StrLit{Value: this.Value()}), nil
 	case token.ChrLit:
 		toks.Pop()
-		return node.Store(this, &node.ChrLit{Value: []rune(this.Value())[0]}), nil
+		val := []rune(this.Value())
+		if len(val) != 1 {
+			return nil, p.errorf(this, "%w: %q", ErrBadCharLiteral, this.Value())
+		}
+		return node.Store(this, &node.ChrLit{Value: val[0]}), nil
 	default:
 		return nil, p.errorf(this, "invalid expression atom: %q", this.Kind())
 	}
 }
 
 func (p *Parser) exprparse(toks *token.Tokens, minprec int) (node.Node, error) {
+	if err := p.enter(toks.Peek()); err != nil {
+		return nil, err
+	}
+	defer p.leave()
 	lhs, err := p.expratom(toks)
 	if err != nil {
 		return nil, err
@@ -256,6 +302,34 @@ out:
 		if op == nil {
 			break out
 		}
+		if op.Kind() == token.Quest {
+			// The ternary operator has the lowest precedence and binds
+			// right, so "a ? b : c ? d : e" is "a ? b : (c ? d : e)". The
+			// middle operand is parenthesized by '?' and ':' and may hence
+			// be any expression.
+			prec := precedenceb(op)
+			if prec < minprec {
+				break out
+			}
+			toks.Pop()
+			tv, err := p.exprparse(toks, 0)
+			if err != nil {
+				return nil, err
+			}
+			if err := toks.Accept(token.Colon); err != nil {
+				return nil, p.errorf(op, "ternary operator missing ':': %w", err)
+			}
+			fv, err := p.exprparse(toks, prec)
+			if err != nil {
+				return nil, err
+			}
+			lhs = node.Store(op, &node.Ternary{
+				Cond:  lhs,
+				True:  tv,
+				False: fv,
+			})
+			continue out
+		}
 		binop, ok := tok_to_binop[op.Kind()]
 		if !ok {
 			break out
@@ -264,18 +338,13 @@ out:
 		// maximally greedy postfix operators -- the C0 Reference specifies
 		// them with the highest precedence. All other binary operators are
 		// treated with the precedence-climbing machinery.
-		//
-		// NB: We also do not validate whether '?' is followed by ':' here.
-		//     That is done at a later stage in syntax checking.
 		switch op.Kind() {
 		case token.LBrack:
 			// Array subscript.
 			toks.Pop()
 			index, err := p.exprparse(toks, 0)
 			if err != nil {
-				return nil, p.errorf(
-					op,
-					"invalid function argument: %w", err)
+				return nil, p.nestedf(op, err, "invalid function argument: %w")
 			}
 			if err := toks.Accept(token.RBrack); err != nil {
 				return nil, p.errorf(op, "unbalanced array subscript: %w", err)
@@ -295,9 +364,8 @@ out:
 				for toks.Peek() != nil {
 					arg, err := p.exprparse(toks, 0)
 					if err != nil {
-						return nil, p.errorf(
-							op,
-							"invalid function argument: %w", err)
+						return nil, p.nestedf(op, err,
+							"invalid function argument: %w")
 					}
 					args = append(args, arg)
 					if err := toks.Accept(token.Comma); err == nil {
@@ -3,6 +3,7 @@ package parse
 import (
 	"errors"
 	"fmt"
+	"sort"
 
 	"github.com/susji/c0/analyze"
 	"github.com/susji/c0/node"
@@ -10,16 +11,77 @@ import (
 )
 
 var (
-	ErrUse   = errors.New("use encountered errors")
-	ErrParse = errors.New("parsing met with error(s)")
-	EOT      = errors.New("end of tokens")
+	ErrUse      = errors.New("use encountered errors")
+	ErrParse    = errors.New("parsing met with error(s)")
+	EOT         = errors.New("end of tokens")
+	ErrDepth    = errors.New("nesting too deep")
+	ErrRedef    = errors.New("redefined")
+	ErrCycle    = errors.New("#use cycle")
+	ErrNoLib    = errors.New("library not found in search path")
+	ErrNoLoop   = errors.New("not inside a loop")
+	ErrStepDecl = errors.New("`for' step may not be a declaration")
 )
 
+// stdin is the file name of a Parser created with New.
+const stdin = "<stdin>"
+
+// DefaultMaxDepth is the default maximum nesting of expressions and
+// statements. It is far beyond anything written by hand but keeps us from
+// running out of stack with pathological input.
+const DefaultMaxDepth = 2000
+
 type Parser struct {
 	fn       string
 	nodes    []node.Node
 	errs     []error
 	typedefs map[string]struct{}
+	// known contains the typedefs given with SetTypedefs
+	known map[string]struct{}
+	// defined maps the functions and structs defined so far to the file
+	// they came from. This way a #use'd file cannot redefine what the
+	// including file defines and vice versa.
+	defined map[string]string
+	// using contains the absolute paths of the files being parsed when
+	// we are parsing a #use'd file, starting from the outermost one
+	using []string
+	// libpaths are the directories searched for library #use files
+	libpaths []string
+	// depth is the current nesting of expressions and statements
+	depth, maxdepth int
+	// loops is the nesting of loop bodies, in which break and continue
+	// are permitted
+	loops int
+	// dialect tells which words are reserved and which begin types
+	dialect *analyze.Dialect
+}
+
+// SetMaxDepth replaces the maximum nesting of expressions and statements.
+func (p *Parser) SetMaxDepth(maxdepth int) {
+	p.maxdepth = maxdepth
+}
+
+// enter is called when descending into a nested expression or statement.
+// Each successful call has to be paired with leave.
+func (p *Parser) enter(tok *token.Token) error {
+	if p.depth >= p.maxdepth {
+		return p.errorf(tok, "%w: maximum is %d", ErrDepth, p.maxdepth)
+	}
+	p.depth++
+	return nil
+}
+
+func (p *Parser) leave() {
+	p.depth--
+}
+
+// nestedf is errorf for errors from parsing a nested expression. Running out
+// of depth has already been recorded once, so it is passed up as is instead of
+// adding another error for each level.
+func (p *Parser) nestedf(tok *token.Token, err error, format string, a ...interface{}) error {
+	if errors.Is(err, ErrDepth) {
+		return err
+	}
+	return p.errorf(tok, format, append(a, err)...)
 }
 
 func (p *Parser) errorf(tok *token.Token, format string, a ...interface{}) error {
@@ -47,12 +109,50 @@ func (p *Parser) Typedefs() map[string]struct{} {
 	return p.typedefs
 }
 
+// AllTypedefs returns a sorted snapshot of every typedef name known to the
+// Parser. This includes the typedefs merged from successful #use directives.
+// Unlike Typedefs, the returned value is not affected by subsequent parsing.
+func (p *Parser) AllTypedefs() []string {
+	ret := []string{}
+	for td := range p.typedefs {
+		ret = append(ret, td)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// SetTypedefs makes the Parser know typedef names defined elsewhere, like in a
+// prelude parsed with another Parser -- see AllTypedefs. The names are kept
+// over calls to Parse, which otherwise forgets the typedefs of previous calls.
+// A #use directive merging a typedef with one of the names fails just like
+// with a typedef defined by the parsed file itself.
+func (p *Parser) SetTypedefs(names []string) {
+	p.known = map[string]struct{}{}
+	for _, name := range names {
+		p.known[name] = struct{}{}
+		p.typedefs[name] = struct{}{}
+	}
+}
+
+// SetLibPaths sets the directories searched, in order, for library files
+// included with #use <...>. Without any, no library file can be found.
+func (p *Parser) SetLibPaths(dirs []string) {
+	p.libpaths = dirs
+}
+
+// SetDialect replaces the reserved words and primitives of plain C0. A
+// primitive which is not one of the built-in types is parsed like a typedef
+// name, so the analysis has to know a typedef with the name.
+func (p *Parser) SetDialect(d *analyze.Dialect) {
+	p.dialect = d
+}
+
 func (p *Parser) Fn() string {
 	return p.fn
 }
 
 func (p *Parser) AddTypedef(tok *token.Token, name string) error {
-	if analyze.IsReserved(name) {
+	if p.dialect.IsReserved(name) {
 		return p.errorf(tok, "typedef name %q is reserved", name)
 	}
 	if _, ok := p.typedefs[name]; ok {
@@ -67,6 +167,27 @@ func (p *Parser) IsTypedef(name string) bool {
 	return ok
 }
 
+// define records the function or struct defined by n, if any, as coming from
+// origin. Definitions already seen in another file are reported with both
+// origins. Redefinitions within a single file are left for the analyzer.
+func (p *Parser) define(tok *token.Token, n node.Node, origin string) error {
+	var what string
+	switch t := n.(type) {
+	case *node.FunDef:
+		what = fmt.Sprintf("function %q", t.Name)
+	case *node.Struct:
+		what = fmt.Sprintf("struct %q", t.Name)
+	default:
+		return nil
+	}
+	if prev, ok := p.defined[what]; ok && prev != origin {
+		return p.errorf(tok, "%s %w in %s, first defined in %s",
+			what, ErrRedef, origin, prev)
+	}
+	p.defined[what] = origin
+	return nil
+}
+
 func (p *Parser) handleUse(tok *token.Token, use *node.DirectiveUse) error {
 	inerr := false
 	if !use.Success {
@@ -79,6 +200,9 @@ func (p *Parser) handleUse(tok *token.Token, use *node.DirectiveUse) error {
 		}
 		return p.errorf(tok, "errors in #use %s", use.How)
 	}
+	// The included typedefs join the ones we know, which includes both what
+	// we have parsed so far and what was given with SetTypedefs. Either way,
+	// a name may be typedef'd only once.
 	for td, _ := range use.Typedefs {
 		if err := p.AddTypedef(tok, td); err != nil {
 			inerr = true
@@ -86,6 +210,9 @@ func (p *Parser) handleUse(tok *token.Token, use *node.DirectiveUse) error {
 		}
 	}
 	for _, usenode := range use.Nodes {
+		if err := p.define(tok, usenode, use.How.String()); err != nil {
+			inerr = true
+		}
 		p.nodes = append(p.nodes, usenode)
 	}
 	if inerr {
@@ -99,24 +226,79 @@ func (p *Parser) handleUse(tok *token.Token, use *node.DirectiveUse) error {
 	return nil
 }
 
+// Parse parses a file. The typedefs from previous calls are forgotten except
+// for the ones given with SetTypedefs.
 func (p *Parser) Parse(toks *token.Tokens) error {
+	p.typedefs = map[string]struct{}{}
+	for name := range p.known {
+		p.typedefs[name] = struct{}{}
+	}
+	p.defined = map[string]string{}
+	return p.ParseMore(toks)
+}
+
+// leadingComments pops the comments before the next token and returns them as
+// written. The comments starting on the line where the previous token ends
+// are returned separately as trailing, as they are about what came before.
+func leadingComments(toks *token.Tokens) (leading, trailing []string) {
+	leading = []string{}
+	prev := toks.Prev()
+	for tok := toks.PeekAll(); tok != nil; tok = toks.PeekAll() {
+		var comment string
+		switch tok.Kind() {
+		case token.CommentOne:
+			comment = "//" + tok.Value()
+		case token.CommentMulti:
+			comment = "/*" + tok.Value() + "*/"
+		default:
+			return leading, trailing
+		}
+		if prev != nil && tok.Lineno() == prev.Span().Lineno {
+			trailing = append(trailing, comment)
+		} else {
+			leading = append(leading, comment)
+		}
+		toks.Pop()
+	}
+	return leading, trailing
+}
+
+// ParseMore is like Parse except that the typedefs and definitions known from
+// previous calls are kept. This way a program may be parsed piecewise, like in
+// a REPL. Nodes and Errors only return what was met during the latest call.
+//
+// The comments right before each global declaration or definition are
+// attached to its node. So are the ones following it on the line where it
+// ends.
+func (p *Parser) ParseMore(toks *token.Tokens) error {
 	p.errs = []error{}
 	p.nodes = []node.Node{}
-	p.typedefs = map[string]struct{}{}
 	for toks.Len() > 0 {
+		comments, trailing := leadingComments(toks)
+		if len(p.nodes) > 0 {
+			for _, comment := range trailing {
+				node.AttachComment(p.nodes[len(p.nodes)-1].Id(), comment)
+			}
+		}
+		if toks.Len() == 0 {
+			break
+		}
 		cur := toks.Peek()
+		before := toks.Len()
 		if newnode, err := p.GlobalDeclDef(toks); err == nil {
+			for _, comment := range comments {
+				node.AttachComment(newnode.Id(), comment)
+			}
 			p.nodes = append(p.nodes, newnode)
 			switch t := newnode.(type) {
 			case *node.DirectiveUse:
 				p.handleUse(cur, t)
+			default:
+				p.define(cur, t, fmt.Sprintf("%q", p.fn))
 			}
 		} else {
-			// If we completely failed in parsing, rewind until the next ';' or
-			// '}' is reached. This gives us a better chance to catch multiple
-			// errors.
-			toks.Find(token.Semicolon, token.RCurly)
-			toks.Pop()
+			p.nodes = append(p.nodes, node.Store(cur, &node.ErrorNode{Err: err}))
+			p.skipDecl(toks, before)
 		}
 	}
 	if len(p.errs) > 0 {
@@ -125,13 +307,49 @@ func (p *Parser) Parse(toks *token.Tokens) error {
 	return nil
 }
 
+// syncs are the tokens which always begin a new global declaration, so
+// recovering from an error never skips past them.
+var syncs = []token.Kind{token.UseStrLit, token.UseLibLit}
+
+// skipDecl skips the rest of a global declaration which we failed to parse,
+// that is, until the next ';' or '}'. This gives us a better chance to catch
+// multiple errors. The declaration may already have been consumed up to its
+// end, as with a function body containing errors or a #use which failed, in
+// which case we do not skip anything. before is the amount of tokens we had
+// before the declaration.
+func (p *Parser) skipDecl(toks *token.Tokens, before int) {
+	if toks.Len() < before {
+		if prev := toks.Prev(); prev != nil {
+			switch prev.Kind() {
+			case token.Semicolon, token.RCurly, token.UseStrLit, token.UseLibLit:
+				return
+			}
+		}
+	}
+	if toks.FindUntil(syncs, token.Semicolon, token.RCurly) != nil ||
+		toks.Len() == before {
+		toks.Pop()
+	}
+}
+
 func New() *Parser {
-	return NewFile("<stdin>")
+	return NewFile(stdin)
+}
+
+// NewFileWithLibPath returns a Parser for the file fn seeking library #use
+// files from libdirs, see SetLibPaths.
+func NewFileWithLibPath(fn string, libdirs []string) *Parser {
+	p := NewFile(fn)
+	p.SetLibPaths(libdirs)
+	return p
 }
 
 func NewFile(fn string) *Parser {
 	return &Parser{
 		fn:       fn,
 		typedefs: map[string]struct{}{},
+		defined:  map[string]string{},
+		maxdepth: DefaultMaxDepth,
+		dialect:  analyze.DefaultDialect(),
 	}
 }
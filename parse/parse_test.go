@@ -1,13 +1,20 @@
 package parse_test
 
 import (
+	"errors"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/susji/c0/analyze"
+	"github.com/susji/c0/lex"
 	"github.com/susji/c0/node"
 	"github.com/susji/c0/parse"
 	"github.com/susji/c0/span"
 	"github.com/susji/c0/testers/assert"
+	"github.com/susji/c0/testers/require"
 	"github.com/susji/c0/token"
 )
 
@@ -109,6 +116,7 @@ func TestGlobalDeclUse(t *testing.T) {
 	toks := &token.Tokens{}
 	toks.Add(token.New(token.UseLibLit, sp(), "testdata/test.h0"))
 	p := parse.New()
+	p.SetLibPaths([]string{"."})
 	want := &node.DirectiveUse{
 		Success:     true,
 		Nodes:       []node.Node{&node.StructForwardDecl{Value: "asd"}},
@@ -123,6 +131,271 @@ func TestGlobalDeclUse(t *testing.T) {
 	DumpErrors(t, p.Errors())
 }
 
+func TestUseCycle(t *testing.T) {
+	table := []struct {
+		fn, code string
+	}{
+		{"<stdin>", "#use \"testdata/cycle_a.h0\"\n"},
+		{"<stdin>", "#use \"testdata/self.h0\"\n"},
+		{"testdata/self.h0", "#use \"self.h0\"\n"},
+	}
+	for _, cur := range table {
+		t.Run(cur.fn+" "+cur.code, func(t *testing.T) {
+			toks, lexerrs := lex.Lex([]rune(cur.code))
+			assert.Equal(t, 0, len(lexerrs))
+			p := parse.NewFile(cur.fn)
+			assert.NotNil(t, p.Parse(toks))
+			DumpErrors(t, p.Errors())
+			found := false
+			for _, err := range p.Errors() {
+				found = found || errors.Is(err, parse.ErrCycle)
+			}
+			assert.True(t, found)
+		})
+	}
+}
+
+func TestUsePaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "c0use")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"main.c0":    "#use \"lib/b.h0\"\n#use <l.h0>\nbint f(lbool a) { return 1; }\n",
+		"lib/b.h0":   "#use \"c.h0\"\ntypedef cint bint;\n",
+		"lib/c.h0":   "typedef int cint;\n",
+		"inc/l.h0":   "typedef bool lbool;\n",
+		"nolib.c0":   "#use <l.h0>\n",
+		"missing.c0": "#use \"c.h0\"\n",
+		"after.c0":   "#use \"missing.h0\"\nint f() { return 1; }\n#use <l.h0>\nint g() { return 2; }\n",
+	}
+	for fn, code := range files {
+		path := filepath.Join(dir, fn)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(code), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	parsed := func(fn string, libpaths []string) *parse.Parser {
+		toks, lexerrs := lex.Lex([]rune(files[fn]))
+		assert.Equal(t, 0, len(lexerrs))
+		p := parse.NewFile(filepath.Join(dir, fn))
+		p.SetLibPaths(libpaths)
+		p.Parse(toks)
+		DumpErrors(t, p.Errors())
+		return p
+	}
+
+	p := parsed("main.c0", []string{filepath.Join(dir, "inc")})
+	assert.Nil(t, p.Errors())
+	assert.Equal(t, []string{"bint", "cint", "lbool"}, p.AllTypedefs())
+	// Library files are not sought next to the including file and string
+	// literals are not sought from the library paths.
+	assert.NotNil(t, parsed("nolib.c0", nil).Errors())
+	assert.NotNil(t, parsed("missing.c0", []string{filepath.Join(dir, "lib")}).Errors())
+
+	toks, _ := lex.Lex([]rune(files["nolib.c0"]))
+	libdirs := []string{filepath.Join(dir, "lib"), filepath.Join(dir, "nonexistent")}
+	p = parse.NewFileWithLibPath(filepath.Join(dir, "nolib.c0"), libdirs)
+	assert.NotNil(t, p.Parse(toks))
+	DumpErrors(t, p.Errors())
+	require.Equal(t, 1, len(p.Errors()))
+	err = p.Errors()[0]
+	assert.True(t, errors.Is(err, parse.ErrNoLib))
+	assert.True(t, strings.HasSuffix(err.Error(), "l.h0, searched "+strings.Join(libdirs, ", ")))
+
+	// Without a search path, library files are not sought from the working
+	// directory either.
+	toks, _ = lex.Lex([]rune(files["nolib.c0"]))
+	p = parse.NewFileWithLibPath(filepath.Join(dir, "nolib.c0"), nil)
+	assert.NotNil(t, p.Parse(toks))
+	DumpErrors(t, p.Errors())
+	require.Equal(t, 1, len(p.Errors()))
+	err = p.Errors()[0]
+	assert.True(t, errors.Is(err, parse.ErrNoLib))
+	assert.True(t, strings.HasSuffix(err.Error(), "l.h0, no library paths given"))
+
+	// Files which cannot be read are reported as such.
+	toks, _ = lex.Lex([]rune(files["missing.c0"]))
+	p = parse.NewFile(filepath.Join(dir, "missing.c0"))
+	assert.NotNil(t, p.Parse(toks))
+	DumpErrors(t, p.Errors())
+	require.Equal(t, 1, len(p.Errors()))
+	assert.True(t, errors.Is(p.Errors()[0], os.ErrNotExist))
+
+	// Declarations following a failed #use are not lost.
+	p = parsed("after.c0", nil)
+	require.Equal(t, 2, len(p.Errors()))
+	assert.True(t, errors.Is(p.Errors()[0], os.ErrNotExist))
+	assert.True(t, errors.Is(p.Errors()[1], parse.ErrNoLib))
+	funcs := []string{}
+	for _, n := range p.Nodes() {
+		if fd, ok := n.(*node.FunDef); ok {
+			funcs = append(funcs, fd.Name)
+		}
+	}
+	assert.Equal(t, []string{"f", "g"}, funcs)
+}
+
+func TestUseErrorFiles(t *testing.T) {
+	table := []struct {
+		use, want string
+	}{
+		{"testdata/lexerr.h0", "testdata/lexerr.h0:1:10: "},
+		{"testdata/parseerr.h0", "testdata/parseerr.h0:2:2: "},
+		{"testdata/sub/nested.h0", "testdata/lexerr.h0:1:10: "},
+	}
+	for _, cur := range table {
+		t.Run(cur.use, func(t *testing.T) {
+			toks, lexerrs := lex.Lex([]rune("#use \"" + cur.use + "\"\n"))
+			assert.Equal(t, 0, len(lexerrs))
+			p := parse.New()
+			assert.NotNil(t, p.Parse(toks))
+			DumpErrors(t, p.Errors())
+			require.True(t, len(p.Errors()) > 0)
+			assert.True(t, strings.HasPrefix(p.Errors()[0].Error(), cur.want))
+		})
+	}
+}
+
+func TestPartialNodes(t *testing.T) {
+	toks, lexerrs := lex.Lex([]rune(`int f() { return 1; }
+int g( {
+	return 0;
+}
+int h() { return 2; }
+`))
+	assert.Equal(t, 0, len(lexerrs))
+	p := parse.New()
+	assert.NotNil(t, p.Parse(toks))
+	DumpErrors(t, p.Errors())
+	n := p.Nodes()
+	t.Log(n)
+	require.True(t, len(n) > 2)
+	assert.Equal(t, "f", n[0].(*node.FunDef).Name)
+	assert.Equal(t, "h", n[len(n)-1].(*node.FunDef).Name)
+	for _, cur := range n[1 : len(n)-1] {
+		en, ok := cur.(*node.ErrorNode)
+		require.True(t, ok)
+		assert.NotNil(t, en.Err)
+	}
+}
+
+func TestRecoveryKeepsLater(t *testing.T) {
+	type entry struct {
+		code string
+		// want describes each node, see below
+		want []string
+	}
+	table := []entry{
+		{"void f() { a = }\nint g() { return 1; }\n",
+			[]string{"error", "g"}},
+		{"void f() { a = ; b = }\nint g() { return 1; }\n",
+			[]string{"error", "g"}},
+		{"typedef int\n#use \"testdata/fundecl.h0\"\nint h() { return 1; }\n",
+			[]string{"error", "#use", "(struct-fwd point)",
+				`(fundecl "f" (kind "Int") ())`, "h"}},
+	}
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			toks, lexerrs := lex.Lex([]rune(cur.code))
+			assert.Equal(t, 0, len(lexerrs))
+			p := parse.New()
+			assert.NotNil(t, p.Parse(toks))
+			DumpErrors(t, p.Errors())
+			n := p.Nodes()
+			t.Log(n)
+			require.Equal(t, len(cur.want), len(n))
+			for i, want := range cur.want {
+				got := n[i].String()
+				switch tn := n[i].(type) {
+				case *node.ErrorNode:
+					got = "error"
+				case *node.DirectiveUse:
+					got = "#use"
+				case *node.FunDef:
+					got = tn.Name
+				}
+				assert.Equal(t, want, got)
+			}
+		})
+	}
+}
+
+func TestAllTypedefs(t *testing.T) {
+	toks, lexerrs := lex.Lex([]rune(`#use "testdata/typedef.h0"
+typedef myint* myintp;
+myint f(myintp a) { return *a; }
+`))
+	assert.Equal(t, 0, len(lexerrs))
+	p := parse.New()
+	assert.Nil(t, p.Parse(toks))
+	DumpErrors(t, p.Errors())
+	got := p.AllTypedefs()
+	assert.Equal(t, []string{"mybool", "myint", "myintp"}, got)
+	// The snapshot should not be affected by the Parser afterwards.
+	p.AddTypedef(nil, "another")
+	assert.Equal(t, []string{"mybool", "myint", "myintp"}, got)
+}
+
+func TestSetTypedefs(t *testing.T) {
+	parsed := func(p *parse.Parser, code string) error {
+		toks, lexerrs := lex.Lex([]rune(code))
+		assert.Equal(t, 0, len(lexerrs))
+		err := p.Parse(toks)
+		DumpErrors(t, p.Errors())
+		return err
+	}
+	prelude := parse.New()
+	assert.Nil(t, parsed(prelude, "typedef int myint;\n"))
+
+	p := parse.New()
+	p.SetTypedefs(prelude.AllTypedefs())
+	assert.Nil(t, parsed(p, "typedef myint* myintp;\nmyint f(myintp a) { return *a; }\n"))
+	assert.Equal(t, []string{"myint", "myintp"}, p.AllTypedefs())
+	// Typedefs from the previous file are forgotten but the given ones are
+	// not.
+	assert.Nil(t, parsed(p, "myint g() { return 1; }\n"))
+	assert.NotNil(t, parsed(p, "myintp g() { return NULL; }\n"))
+	assert.Equal(t, []string{"myint"}, p.AllTypedefs())
+	// A #use'd file cannot typedef a given name again.
+	assert.NotNil(t, parsed(p, "#use \"testdata/typedef.h0\"\n"))
+}
+
+func TestDialect(t *testing.T) {
+	parsed := func(p *parse.Parser, code string) error {
+		toks, lexerrs := lex.Lex([]rune(code))
+		assert.Equal(t, 0, len(lexerrs))
+		err := p.Parse(toks)
+		DumpErrors(t, p.Errors())
+		return err
+	}
+	code := "int f() { int const; const = 1; return const; }\n"
+	assert.Nil(t, parsed(parse.New(), code))
+
+	d := analyze.DefaultDialect()
+	d.Reserve("const")
+	p := parse.New()
+	p.SetDialect(d)
+	assert.NotNil(t, parsed(p, code))
+	assert.NotNil(t, parsed(p, "int f(int const) { return 0; }\n"))
+	assert.NotNil(t, parsed(p, "struct s { int const; };\n"))
+	assert.NotNil(t, parsed(p, "typedef int const;\n"))
+	// The plain words are still there.
+	assert.NotNil(t, parsed(p, "int f() { int while; return 0; }\n"))
+	// Registering a dialect does not change the default one.
+	assert.Nil(t, parsed(parse.New(), code))
+
+	// Extra primitives begin types without being typedef'd.
+	prim := "void f() { i64 a; }\n"
+	assert.NotNil(t, parsed(parse.New(), prim))
+	d.AddPrimitive("i64")
+	assert.Nil(t, parsed(p, prim))
+}
+
 func TestGlobalDeclFuncSimple(t *testing.T) {
 	toks := &token.Tokens{}
 	// int foo();
@@ -484,22 +757,102 @@ func TestExprTernary(t *testing.T) {
 		Add(token.New(token.DecNum, sp(), "2"))
 
 	p := parse.New()
-	want := &node.OpBinary{
-		Op: node.OPBIN_TERNARYCOND,
-		Left: &node.OpBinary{
+	want := &node.Ternary{
+		Cond: &node.OpBinary{
 			Op:    node.OPBIN_ADD,
 			Left:  &node.Variable{Value: "one"},
 			Right: &node.Variable{Value: "two"},
 		},
-		Right: &node.OpBinary{
-			Op: node.OPBIN_TERNARYVALS,
-			Left: &node.OpBinary{Op: node.OPBIN_ADD,
-				Left:  &node.Variable{Value: "yes"},
-				Right: &node.Numeric{Base: 10, Value: 1},
-			},
-			Right: &node.OpBinary{Op: node.OPBIN_SUB,
-				Left:  &node.Variable{Value: "no"},
-				Right: &node.Numeric{Base: 10, Value: 2},
+		True: &node.OpBinary{Op: node.OPBIN_ADD,
+			Left:  &node.Variable{Value: "yes"},
+			Right: &node.Numeric{Base: 10, Value: 1},
+		},
+		False: &node.OpBinary{Op: node.OPBIN_SUB,
+			Left:  &node.Variable{Value: "no"},
+			Right: &node.Numeric{Base: 10, Value: 2},
+		},
+	}
+	n, err := p.Expr(toks)
+	assert.Nil(t, err)
+	assert.Equal(t, want, n)
+	DumpErrors(t, p.Errors())
+}
+
+func TestExprTernaryNested(t *testing.T) {
+	type entry struct {
+		code string
+		want string
+	}
+	table := []entry{
+		{"a ? b : c ? d : e", "(? a b (? c d e))"},
+		{"a ? b ? c : d : e", "(? a (? b c d) e)"},
+		{"a || b ? c + 1 : d", "(? (|| a b) (+ c 1) d)"},
+	}
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			toks, lexerrs := lex.Lex([]rune(cur.code))
+			assert.Equal(t, 0, len(lexerrs))
+			p := parse.New()
+			got, err := p.Expr(toks)
+			assert.Nil(t, err)
+			assert.NotNil(t, got)
+			assert.Equal(t, cur.want, got.String())
+			assert.Equal(t, 0, toks.Len())
+		})
+	}
+}
+
+func TestExprTernaryShouldFail(t *testing.T) {
+	table := []string{
+		"true ? 1;",
+		"f(c ? 1, d ? 3 : 4);",
+		"a ? : b;",
+		"1 : 0;",
+	}
+	for _, cur := range table {
+		t.Run(cur, func(t *testing.T) {
+			toks, lexerrs := lex.Lex([]rune(cur))
+			assert.Equal(t, 0, len(lexerrs))
+			p := parse.New()
+			_, err := p.Stmt(toks)
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestExprFuncallTernaryArgs(t *testing.T) {
+	toks := &token.Tokens{}
+	// f(c ? 1 : 2, d ? 3 : 4)
+	toks.Add(token.New(token.Id, sp(), "f")).
+		Add(token.New(token.LParen, sp(), "")).
+		Add(token.New(token.Id, sp(), "c")).
+		Add(token.New(token.Quest, sp(), "")).
+		Add(token.New(token.DecNum, sp(), "1")).
+		Add(token.New(token.Colon, sp(), "")).
+		Add(token.New(token.DecNum, sp(), "2")).
+		Add(token.New(token.Comma, sp(), "")).
+		Add(token.New(token.Id, sp(), "d")).
+		Add(token.New(token.Quest, sp(), "")).
+		Add(token.New(token.DecNum, sp(), "3")).
+		Add(token.New(token.Colon, sp(), "")).
+		Add(token.New(token.DecNum, sp(), "4")).
+		Add(token.New(token.RParen, sp(), ""))
+	p := parse.New()
+	want := &node.OpBinary{
+		Op:   node.OPBIN_FUNCALL,
+		Left: &node.Variable{Value: "f"},
+		Right: &node.Args{
+			Value: []node.Node{
+				&node.Ternary{
+					Cond:  &node.Variable{Value: "c"},
+					True:  &node.Numeric{Base: 10, Value: 1},
+					False: &node.Numeric{Base: 10, Value: 2},
+				},
+				&node.Ternary{
+					Cond:  &node.Variable{Value: "d"},
+					True:  &node.Numeric{Base: 10, Value: 3},
+					False: &node.Numeric{Base: 10, Value: 4},
+				},
 			},
 		},
 	}
@@ -509,6 +862,48 @@ func TestExprTernary(t *testing.T) {
 	DumpErrors(t, p.Errors())
 }
 
+func TestExprIntRange(t *testing.T) {
+	type entry struct {
+		code    string
+		want    int32
+		wanterr error
+	}
+	table := []entry{
+		{"0", 0, nil},
+		{"2147483647", 2147483647, nil},
+		{"2147483648", 0, parse.ErrIntRange},
+		{"4294967296", 0, parse.ErrIntRange},
+		{"99999999999999999999", 0, parse.ErrIntRange},
+		{"0x0", 0, nil},
+		{"0x7FFFFFFF", 2147483647, nil},
+		{"0x80000000", -2147483648, nil},
+		{"0xFFFFFFFF", -1, nil},
+		{"0xffffffff", -1, nil},
+		{"0x100000000", 0, parse.ErrIntRange},
+		{"0x000000000001", 1, nil},
+	}
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			toks, lexerrs := lex.Lex([]rune(cur.code))
+			require.Equal(t, 0, len(lexerrs))
+			p := parse.New()
+			got, err := p.Expr(toks)
+			DumpErrors(t, p.Errors())
+			if cur.wanterr != nil {
+				require.NotNil(t, err)
+				require.Equal(t, 1, len(p.Errors()))
+				assert.True(t, errors.Is(p.Errors()[0], cur.wanterr))
+				assert.True(t, strings.Contains(err.Error(), cur.code))
+				return
+			}
+			require.Nil(t, err)
+			num, ok := got.(*node.Numeric)
+			require.True(t, ok)
+			assert.Equal(t, cur.want, num.Value)
+		})
+	}
+}
+
 func TestExprShouldFail(t *testing.T) {
 	type entry struct {
 		what string
@@ -571,8 +966,6 @@ func TestExprBinops(t *testing.T) {
 		token.Percent,
 		token.Dot,
 		token.Arrow,
-		token.Quest,
-		token.Colon,
 		token.DGt,
 		token.DLt,
 		token.Le,
@@ -669,6 +1062,110 @@ func TestSimpleAssign(t *testing.T) {
 	DumpErrors(t, p.Errors())
 }
 
+func TestChainedAssign(t *testing.T) {
+	type entry struct {
+		code string
+		want string
+	}
+	table := []entry{
+		{"a = b = 0", "(assign= a (assign= b 0))"},
+		{"a = b = c = 10", "(assign= a (assign= b (assign= c 10)))"},
+		{"a += b -= 2", "(assign+= a (assign-= b 2))"},
+		{"*p = s->x = f(1)", "(assign= (* p) (assign= (-> s x) (CALL f [1])))"},
+	}
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			toks, lexerrs := lex.Lex([]rune(cur.code))
+			assert.Equal(t, 0, len(lexerrs))
+			p := parse.New()
+			got, err := p.SimpleStmt(toks)
+			assert.Nil(t, err)
+			assert.NotNil(t, got)
+			assert.Equal(t, cur.want, got.String())
+			assert.Equal(t, 0, toks.Len())
+			DumpErrors(t, p.Errors())
+		})
+	}
+}
+
+func TestMultipleDeclarators(t *testing.T) {
+	toks, lexerrs := lex.Lex([]rune("int a, b = 2, c"))
+	assert.Equal(t, 0, len(lexerrs))
+	kind := node.Kind{Kind: node.KIND_INT}
+	want := &node.VarDeclList{
+		Value: []node.Node{
+			&node.OpAssign{
+				Op: node.OPASN_PLAIN,
+				To: &node.VarDecl{Name: "a", Kind: kind},
+			},
+			&node.OpAssign{
+				Op:   node.OPASN_PLAIN,
+				To:   &node.VarDecl{Name: "b", Kind: kind},
+				What: &node.Numeric{Base: 10, Value: 2},
+			},
+			&node.OpAssign{
+				Op: node.OPASN_PLAIN,
+				To: &node.VarDecl{Name: "c", Kind: kind},
+			},
+		},
+	}
+	p := parse.New()
+	got, err := p.SimpleStmt(toks)
+	assert.Nil(t, err)
+	assert.Equal(t, want, got)
+	assert.Equal(t, 0, toks.Len())
+	DumpErrors(t, p.Errors())
+}
+
+func TestMultipleDeclaratorsShouldFail(t *testing.T) {
+	table := []string{
+		"int a, ;",
+		"int a, 1;",
+		"int a, b = ;",
+		"int a, while;",
+	}
+	for _, cur := range table {
+		t.Run(cur, func(t *testing.T) {
+			toks, lexerrs := lex.Lex([]rune(cur))
+			assert.Equal(t, 0, len(lexerrs))
+			p := parse.New()
+			_, err := p.Stmt(toks)
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestExprSizeOf(t *testing.T) {
+	type entry struct {
+		code string
+		want string
+	}
+	table := []entry{
+		{"sizeof(int)", `(sizeof (kind "Int"))`},
+		{"sizeof(struct s*)", `(sizeof (kind "struct s*"))`},
+		{"1 + sizeof(char[])", `(+ 1 (sizeof (kind "Char[]")))`},
+	}
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			toks, lexerrs := lex.Lex([]rune(cur.code))
+			assert.Equal(t, 0, len(lexerrs))
+			p := parse.New()
+			got, err := p.Expr(toks)
+			assert.Nil(t, err)
+			assert.NotNil(t, got)
+			assert.Equal(t, cur.want, got.String())
+			DumpErrors(t, p.Errors())
+		})
+	}
+	for _, code := range []string{"sizeof int", "sizeof(1)", "sizeof(int"} {
+		t.Run(code, func(t *testing.T) {
+			toks, _ := lex.Lex([]rune(code))
+			_, err := parse.New().Expr(toks)
+			assert.NotNil(t, err)
+		})
+	}
+}
+
 func TestStmtIf(t *testing.T) {
 	toks := &token.Tokens{}
 	// if (true) {} return 123;
@@ -785,6 +1282,286 @@ func TestStmtFor(t *testing.T) {
 	DumpErrors(t, p.Errors())
 }
 
+func TestStmtEmpty(t *testing.T) {
+	type entry struct {
+		code string
+		want node.Node
+	}
+	table := []entry{
+		{";", &node.Empty{}},
+		{"{ ; ; }", &node.Block{Value: []node.Node{&node.Empty{}, &node.Empty{}}}},
+		{"for (;;) break;", &node.For{Body: &node.Break{}}},
+		{"for (;;) ;", &node.For{Body: &node.Empty{}}},
+		{"for (; i < 5;) i++;", &node.For{
+			Cond: &node.OpBinary{
+				Op:    node.OPBIN_LT,
+				Left:  &node.Variable{Value: "i"},
+				Right: &node.Numeric{Base: 10, Value: 5},
+			},
+			Body: &node.OpUnary{
+				Op: node.OPUN_ADDONESUFFIX,
+				To: &node.Variable{Value: "i"},
+			},
+		}},
+		{"for (i = 1; ; i++) break;", &node.For{
+			Init: &node.OpAssign{
+				Op:   node.OPASN_PLAIN,
+				To:   &node.Variable{Value: "i"},
+				What: &node.Numeric{Base: 10, Value: 1},
+			},
+			OnEach: &node.OpUnary{
+				Op: node.OPUN_ADDONESUFFIX,
+				To: &node.Variable{Value: "i"},
+			},
+			Body: &node.Break{},
+		}},
+		{"for (int i = 1; i < 5;) i++;", &node.For{
+			Init: &node.OpAssign{
+				Op:   node.OPASN_PLAIN,
+				To:   &node.VarDecl{Name: "i", Kind: node.Kind{Kind: node.KIND_INT}},
+				What: &node.Numeric{Base: 10, Value: 1},
+			},
+			Cond: &node.OpBinary{
+				Op:    node.OPBIN_LT,
+				Left:  &node.Variable{Value: "i"},
+				Right: &node.Numeric{Base: 10, Value: 5},
+			},
+			Body: &node.OpUnary{
+				Op: node.OPUN_ADDONESUFFIX,
+				To: &node.Variable{Value: "i"},
+			},
+		}},
+		{"if (true) ; else ;", &node.If{
+			Cond:  &node.Bool{Value: true},
+			True:  &node.Empty{},
+			False: &node.Empty{},
+		}},
+	}
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			toks, lexerrs := lex.Lex([]rune(cur.code))
+			assert.Equal(t, 0, len(lexerrs))
+			p := parse.New()
+			got, err := p.Stmt(toks)
+			assert.Nil(t, err)
+			assert.Equal(t, cur.want, got)
+			assert.Equal(t, 0, toks.Len())
+			DumpErrors(t, p.Errors())
+		})
+	}
+}
+
+func TestStmtDoWhile(t *testing.T) {
+	toks := &token.Tokens{}
+	// do { a++; } while (a < 5);
+	toks.Add(token.New(token.Id, sp(), "do")).
+		Add(token.New(token.LCurly, sp(), "")).
+		Add(token.New(token.Id, sp(), "a")).
+		Add(token.New(token.DPlus, sp(), "")).
+		Add(token.New(token.Semicolon, sp(), "")).
+		Add(token.New(token.RCurly, sp(), "")).
+		Add(token.New(token.Id, sp(), "while")).
+		Add(token.New(token.LParen, sp(), "")).
+		Add(token.New(token.Id, sp(), "a")).
+		Add(token.New(token.Lt, sp(), "")).
+		Add(token.New(token.DecNum, sp(), "5")).
+		Add(token.New(token.RParen, sp(), "")).
+		Add(token.New(token.Semicolon, sp(), ""))
+
+	want := &node.DoWhile{
+		Body: &node.Block{
+			Value: []node.Node{
+				&node.OpUnary{
+					Op: node.OPUN_ADDONESUFFIX,
+					To: &node.Variable{Value: "a"},
+				},
+			},
+		},
+		Cond: &node.OpBinary{
+			Op:    node.OPBIN_LT,
+			Left:  &node.Variable{Value: "a"},
+			Right: &node.Numeric{Base: 10, Value: 5},
+		},
+	}
+	p := parse.New()
+	got, err := p.Stmt(toks)
+	assert.Nil(t, err)
+	assert.NotNil(t, got)
+	assert.Equal(t, want, got)
+	DumpErrors(t, p.Errors())
+}
+
+func TestStmtDoWhileShouldFail(t *testing.T) {
+	table := []string{
+		"do { a++; } (a < 5);",
+		"do { a++; } while a < 5;",
+		"do { a++; } while (a < 5)",
+	}
+	for _, cur := range table {
+		t.Run(cur, func(t *testing.T) {
+			toks, lexerrs := lex.Lex([]rune(cur))
+			assert.Equal(t, 0, len(lexerrs))
+			p := parse.New()
+			_, err := p.Stmt(toks)
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestStmtMissingSemicolon(t *testing.T) {
+	type entry struct {
+		code        string
+		lineno, col int
+		toplevel    bool
+	}
+	table := []entry{
+		{"x = aaaa + bbbb\ny = 1;", 2, 1, false},
+		{"return aaaa + bbbb }", 1, 20, false},
+		{"x = a + b", 1, 9, false},
+		{"for (i = 0 i < 2; i++) {}", 1, 12, false},
+		{"for (;i < 2 i++) {}", 1, 13, false},
+		{"do {} while (a) b", 1, 17, false},
+		{"assert(a) b", 1, 11, false},
+		{"while (a) {\n\tbreak\n}", 3, 1, false},
+		{"int a = 1 return a;", 1, 11, false},
+		{"{\n\tint a = 1\n\treturn a;\n}", 3, 2, false},
+		{"typedef int num\nint f();", 2, 1, true},
+		{"typedef int num", 1, 13, true},
+		{"struct s { int a int b; };", 1, 18, true},
+		{"struct s { int a; }\nint f();", 2, 1, true},
+	}
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			toks, lexerrs := lex.Lex([]rune(cur.code))
+			assert.Equal(t, 0, len(lexerrs))
+			p := parse.New()
+			if cur.toplevel {
+				assert.NotNil(t, p.Parse(toks))
+			} else {
+				_, err := p.Stmt(toks)
+				assert.NotNil(t, err)
+			}
+			DumpErrors(t, p.Errors())
+			// Blocks report their own error after the ones inside them.
+			require.True(t, len(p.Errors()) > 0)
+			err := p.Errors()[0]
+			var perr *parse.ParseError
+			require.True(t, errors.As(err, &perr))
+			require.NotNil(t, perr.Tok)
+			assert.True(t, strings.Contains(err.Error(), "missing ';'"))
+			assert.Equal(t, cur.lineno, perr.Tok.Lineno())
+			assert.Equal(t, cur.col, perr.Tok.Col())
+		})
+	}
+}
+
+func TestStmtLabelGoto(t *testing.T) {
+	type entry struct {
+		code string
+		want string
+	}
+	table := []entry{
+		{"goto end;", `(goto "end")`},
+		{"end:", `(label "end")`},
+		{"again: a++;", `(label "again")`},
+	}
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			toks, lexerrs := lex.Lex([]rune(cur.code))
+			assert.Equal(t, 0, len(lexerrs))
+			p := parse.New()
+			got, err := p.Stmt(toks)
+			assert.Nil(t, err)
+			assert.NotNil(t, got)
+			assert.Equal(t, cur.want, got.String())
+			DumpErrors(t, p.Errors())
+		})
+	}
+}
+
+func TestStmtGotoShouldFail(t *testing.T) {
+	table := []string{
+		"goto ;",
+		"goto end",
+		"goto 1;",
+	}
+	for _, cur := range table {
+		t.Run(cur, func(t *testing.T) {
+			toks, lexerrs := lex.Lex([]rune(cur))
+			assert.Equal(t, 0, len(lexerrs))
+			p := parse.New()
+			_, err := p.Stmt(toks)
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestStmtLoopOnly(t *testing.T) {
+	type entry struct {
+		code string
+		ok   bool
+	}
+	table := []entry{
+		{"break;", false},
+		{"continue;", false},
+		{"{ if (a) break; }", false},
+		{"while (a) break;", true},
+		{"while (a) { if (b) continue; }", true},
+		{"do { break; } while (a);", true},
+		{"for (;;) continue;", true},
+		{"{ while (a) {} break; }", false},
+	}
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			toks, lexerrs := lex.Lex([]rune(cur.code))
+			assert.Equal(t, 0, len(lexerrs))
+			p := parse.New()
+			_, err := p.Stmt(toks)
+			DumpErrors(t, p.Errors())
+			if cur.ok {
+				assert.Nil(t, err)
+				return
+			}
+			assert.NotNil(t, err)
+			require.True(t, len(p.Errors()) > 0)
+			assert.True(t, errors.Is(p.Errors()[0], parse.ErrNoLoop))
+		})
+	}
+}
+
+func TestStmtForStep(t *testing.T) {
+	type entry struct {
+		code string
+		ok   bool
+	}
+	table := []entry{
+		{"for (int i=0;i<n;int j=0){}", false},
+		{"for (int i=0;i<n;int j){}", false},
+		{"for (int i=0;i<n;int j, k=1){}", false},
+		{"for (int i=0;i<n;i++){}", true},
+		{"for (i=0;i<n;i+=2){}", true},
+		{"for (i=0;i<n;f(i)){}", true},
+		{"for (i=0;i<n;*p=i){}", true},
+	}
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			toks, lexerrs := lex.Lex([]rune(cur.code))
+			assert.Equal(t, 0, len(lexerrs))
+			p := parse.New()
+			_, err := p.Stmt(toks)
+			DumpErrors(t, p.Errors())
+			if cur.ok {
+				assert.Nil(t, err)
+				assert.Equal(t, 0, toks.Len())
+				return
+			}
+			assert.NotNil(t, err)
+			require.True(t, len(p.Errors()) > 0)
+			assert.True(t, errors.Is(p.Errors()[0], parse.ErrStepDecl))
+		})
+	}
+}
+
 func TestDefTypedef(t *testing.T) {
 	toks := &token.Tokens{}
 	toks.Add(token.New(token.Id, sp(), "typedef")).
@@ -958,6 +1735,34 @@ func TestCasting(t *testing.T) {
 	DumpErrors(t, p.Errors())
 }
 
+func TestCastingExpr(t *testing.T) {
+	type entry struct {
+		code string
+		want string
+	}
+	table := []entry{
+		{"(int*)(a+b)", "(cast (kind \"Int*\") (+ a b))"},
+		{"(char)x + 1", "(+ (cast (kind \"Char\") x) 1)"},
+		{"(struct s*)malloc_like_call()", "(cast (kind \"struct s*\") (CALL malloc_like_call []))"},
+		{"(int)x->f", "(cast (kind \"Int\") (-> x f))"},
+		{"(a + b) * 2", "(* (+ a b) 2)"},
+		{"(int)-x * 2", "(* (cast (kind \"Int\") (u- x)) 2)"},
+	}
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			toks, lexerrs := lex.Lex([]rune(cur.code))
+			assert.Equal(t, 0, len(lexerrs))
+			p := parse.New()
+			got, err := p.Expr(toks)
+			assert.Nil(t, err)
+			assert.NotNil(t, got)
+			assert.Equal(t, cur.want, got.String())
+			assert.Equal(t, 0, toks.Len())
+			DumpErrors(t, p.Errors())
+		})
+	}
+}
+
 func TestExprChrLit(t *testing.T) {
 	toks := &token.Tokens{}
 	// 'r'
@@ -970,6 +1775,45 @@ func TestExprChrLit(t *testing.T) {
 	DumpErrors(t, p.Errors())
 }
 
+func TestExprChrLitLexed(t *testing.T) {
+	type entry struct {
+		code    string
+		want    rune
+		wanterr error
+	}
+	table := []entry{
+		{`'a'`, 'a', nil},
+		{`'\n'`, '\n', nil},
+		{`'\0'`, 0, nil},
+		{`'\''`, '\'', nil},
+		{`'ab'`, 0, parse.ErrBadCharLiteral},
+		{`'\n\n'`, 0, parse.ErrBadCharLiteral},
+		{`'a\0'`, 0, parse.ErrBadCharLiteral},
+	}
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			toks, lexerrs := lex.Lex([]rune(cur.code))
+			require.Equal(t, 0, len(lexerrs))
+			p := parse.New()
+			got, err := p.Expr(toks)
+			DumpErrors(t, p.Errors())
+			if cur.wanterr != nil {
+				require.NotNil(t, err)
+				require.Equal(t, 1, len(p.Errors()))
+				assert.True(t, errors.Is(p.Errors()[0], cur.wanterr))
+				var perr *parse.ParseError
+				require.True(t, errors.As(p.Errors()[0], &perr))
+				assert.True(t, strings.HasPrefix(perr.Error(), "<stdin>:1:1: "))
+				return
+			}
+			require.Nil(t, err)
+			chr, ok := got.(*node.ChrLit)
+			require.True(t, ok)
+			assert.Equal(t, cur.want, chr.Value)
+		})
+	}
+}
+
 func TestPrecedenceUnary(t *testing.T) {
 	toks := &token.Tokens{}
 	// *s.f
@@ -1029,3 +1873,133 @@ func TestPrecedenceUnaryParens(t *testing.T) {
 	assert.Equalf(t, want, got, "want: %s, got %s", want, got)
 	DumpErrors(t, p.Errors())
 }
+
+// repeated builds the tokens of n times pre, mid, and n times post without
+// going through the lexer.
+func repeated(n int, pre []token.Kind, mid []token.Kind, post []token.Kind) *token.Tokens {
+	toks := &token.Tokens{}
+	add := func(kinds []token.Kind) {
+		for _, kind := range kinds {
+			toks.Add(token.New(kind, sp(), "a"))
+		}
+	}
+	for i := 0; i < n; i++ {
+		add(pre)
+	}
+	add(mid)
+	for i := 0; i < n; i++ {
+		add(post)
+	}
+	return toks
+}
+
+func TestTooDeep(t *testing.T) {
+	const n = 100000
+	id := []token.Kind{token.Id}
+	table := []struct {
+		what string
+		toks *token.Tokens
+	}{
+		{"parens", repeated(n, []token.Kind{token.LParen}, id, []token.Kind{token.RParen})},
+		{"unary", repeated(n, []token.Kind{token.Minus}, id, nil)},
+		{"subscripts", repeated(n, []token.Kind{token.Id, token.LBrack}, id, []token.Kind{token.RBrack})},
+		{"calls", repeated(n, []token.Kind{token.Id, token.LParen}, id, []token.Kind{token.RParen})},
+	}
+	for _, cur := range table {
+		t.Run(cur.what, func(t *testing.T) {
+			p := parse.New()
+			n, err := p.Expr(cur.toks)
+			assert.Nil(t, n)
+			assert.True(t, errors.Is(err, parse.ErrDepth))
+			// Each enclosing level must not add an error of its own.
+			assert.True(t, len(p.Errors()) <= 2)
+		})
+	}
+}
+
+func TestTooDeepStmt(t *testing.T) {
+	toks, lexerrs := lex.Lex([]rune("int main() "))
+	assert.Equal(t, 0, len(lexerrs))
+	body := repeated(100000, []token.Kind{token.LCurly}, nil, []token.Kind{token.RCurly})
+	for body.Len() > 0 {
+		toks.Add(*body.Pop())
+	}
+	p := parse.New()
+	assert.NotNil(t, p.Parse(toks))
+	found := false
+	for _, err := range p.Errors() {
+		found = found || errors.Is(err, parse.ErrDepth)
+	}
+	assert.True(t, found)
+}
+
+func TestSetMaxDepth(t *testing.T) {
+	code := "((((a))))"
+	for _, cur := range []struct {
+		depth int
+		ok    bool
+	}{{4, false}, {5, true}} {
+		toks, _ := lex.Lex([]rune(code))
+		p := parse.New()
+		p.SetMaxDepth(cur.depth)
+		_, err := p.Expr(toks)
+		assert.Equal(t, cur.ok, err == nil)
+	}
+	// Hitting the limit at the very end of input leaves no token to blame.
+	toks := repeated(3, []token.Kind{token.LParen}, nil, nil)
+	p := parse.New()
+	p.SetMaxDepth(3)
+	_, err := p.Expr(toks)
+	assert.True(t, errors.Is(err, parse.ErrDepth))
+	assert.NotNil(t, err.Error())
+}
+
+func TestUseRedefinitions(t *testing.T) {
+	type entry struct {
+		what, code string
+		want       []string
+	}
+	table := []entry{
+		{
+			"declared", `#use "testdata/fundecl.h0"
+struct point { int x; };
+int f() { return 2; }`,
+			nil,
+		},
+		{
+			"function", `#use "testdata/fundef.h0"
+int f() { return 2; }`,
+			[]string{`function "f" redefined in "<stdin>", first defined in "testdata/fundef.h0"`},
+		},
+		{
+			"struct", `struct point { int y; };
+#use "testdata/fundef.h0"
+`,
+			[]string{`struct "point" redefined in "testdata/fundef.h0", first defined in "<stdin>"`},
+		},
+		{
+			"local", `int f() { return 1; }
+int f() { return 2; }`,
+			nil,
+		},
+	}
+	for _, cur := range table {
+		t.Run(cur.what, func(t *testing.T) {
+			toks, lexerrs := lex.Lex([]rune(cur.code))
+			assert.Equal(t, 0, len(lexerrs))
+			p := parse.New()
+			err := p.Parse(toks)
+			DumpErrors(t, p.Errors())
+			assert.Equal(t, len(cur.want), len(p.Errors()))
+			if len(cur.want) == 0 {
+				assert.Nil(t, err)
+				return
+			}
+			assert.NotNil(t, err)
+			for i, want := range cur.want {
+				assert.True(t, errors.Is(p.Errors()[i], parse.ErrRedef))
+				assert.True(t, strings.HasSuffix(p.Errors()[i].Error(), want))
+			}
+		})
+	}
+}
@@ -32,11 +32,15 @@ var tok_to_stmtsuffix = map[token.Kind]node.KindOpUn{
 //
 // This is our modified grammar:
 //
-// <simple> = <tp> <vid> [ "="" <exp> ]
-//          | <exp> <asnop> <exp>
+// <simple> = <tp> <vid> [ "="" <rv> ] ( "," <vid> [ "=" <rv> ] )*
+//          | <exp> <asnop> <rv>
 //          | <exp> "++"
 //          | <exp> "--"
 //          | <exp>
+// <rv>     = <exp> [ <asnop> <rv> ]
+//
+// The last rule makes assignments right-associative, so "a = b = 0" means
+// "a = (b = 0)".
 //
 func (p *Parser) SimpleStmt(toks *token.Tokens) (node.Node, error) {
 	first := toks.Peek()
@@ -56,7 +60,7 @@ func (p *Parser) SimpleStmt(toks *token.Tokens) (node.Node, error) {
 		if ak, ok := tok_to_asnop[next.Kind()]; ok {
 			// Looks like an assignment statement.
 			toks.Pop()
-			rv, err := p.Expr(toks)
+			rv, err := p.rvalue(toks)
 			if err != nil {
 				return nil, p.errorf(next, "invalid rvalue: %w", err)
 			}
@@ -76,29 +80,96 @@ func (p *Parser) SimpleStmt(toks *token.Tokens) (node.Node, error) {
 		// A plain expression-looking thing.
 		return lv, nil
 	}
-	// <tp> <vid> ["="" <exp>]
+	// <tp> <vid> ["="" <exp>] ("," <vid> ["=" <exp>])*
 	if vd, err := p.VarDecl(toks); err == nil {
-		var av node.Node
-		if toks.Peek() != nil && toks.Peek().Kind() == token.Assign {
+		decl, err := p.declarator(toks, first, vd)
+		if err != nil {
+			return nil, err
+		}
+		if toks.Peek() == nil || toks.Peek().Kind() != token.Comma {
+			return decl, nil
+		}
+		decls := []node.Node{decl}
+		for toks.Peek() != nil && toks.Peek().Kind() == token.Comma {
 			toks.Pop()
-			av, err = p.Expr(toks)
+			next := toks.Peek()
+			if next == nil {
+				return nil, EOT
+			}
+			if next.Kind() != token.Id {
+				return nil, p.errorf(next,
+					"expecting identifier after ',' in declaration, got %v", next)
+			}
+			if p.dialect.IsReserved(next.Value()) {
+				return nil, p.errorf(next,
+					"reserved identifier %q for variable declaration", next.Value())
+			}
+			toks.Pop()
+			nvd := node.Store(next, &node.VarDecl{
+				Name: next.Value(),
+				Kind: vd.Kind,
+			}).(*node.VarDecl)
+			decl, err := p.declarator(toks, next, nvd)
 			if err != nil {
-				return nil, p.errorf(
-					first,
-					"erroneous variable assignment: %w", err)
+				return nil, err
 			}
+			decls = append(decls, decl)
 		}
-		return node.Store(first, &node.OpAssign{
-			Op:   node.OPASN_PLAIN,
-			To:   vd,
-			What: av,
-		}), nil
+		return node.Store(first, &node.VarDeclList{Value: decls}), nil
 	}
 	// We prefer the expression error, if nothing else was found. For instance,
 	// a reserved word might have been encountered.
 	return nil, exprerr
 }
 
+// declarator parses the optional initializer of a declared variable.
+func (p *Parser) declarator(toks *token.Tokens, first *token.Token, vd *node.VarDecl) (node.Node, error) {
+	var av node.Node
+	if toks.Peek() != nil && toks.Peek().Kind() == token.Assign {
+		toks.Pop()
+		var err error
+		av, err = p.rvalue(toks)
+		if err != nil {
+			return nil, p.errorf(
+				first,
+				"erroneous variable assignment: %w", err)
+		}
+	}
+	return node.Store(first, &node.OpAssign{
+		Op:   node.OPASN_PLAIN,
+		To:   vd,
+		What: av,
+	}), nil
+}
+
+// rvalue implements "<rv>", that is, the right-hand side of an assignment,
+// which may be another assignment.
+func (p *Parser) rvalue(toks *token.Tokens) (node.Node, error) {
+	first := toks.Peek()
+	rv, err := p.Expr(toks)
+	if err != nil {
+		return nil, err
+	}
+	next := toks.Peek()
+	if next == nil {
+		return rv, nil
+	}
+	ak, ok := tok_to_asnop[next.Kind()]
+	if !ok {
+		return rv, nil
+	}
+	toks.Pop()
+	what, err := p.rvalue(toks)
+	if err != nil {
+		return nil, p.errorf(next, "invalid rvalue: %w", err)
+	}
+	return node.Store(first, &node.OpAssign{
+		Op:   ak,
+		To:   rv,
+		What: what,
+	}), nil
+}
+
 func (p *Parser) Block(toks *token.Tokens) (*node.Block, error) {
 	first := toks.Peek()
 	if first == nil {
@@ -116,8 +187,11 @@ func (p *Parser) Block(toks *token.Tokens) (*node.Block, error) {
 		if err != nil {
 			inerror = true
 			// Attempt finding next statement for the block for more errors.
-			toks.Find(token.Semicolon, token.RCurly)
-			toks.Pop()
+			// The block's own '}' is left for us to accept.
+			if toks.FindUntil(
+				[]token.Kind{token.RCurly}, token.Semicolon) != nil {
+				toks.Pop()
+			}
 		}
 		stmts = append(stmts, stmt)
 	}
@@ -132,15 +206,71 @@ func (p *Parser) Block(toks *token.Tokens) (*node.Block, error) {
 	return node.Store(first, &node.Block{Value: stmts}).(*node.Block), nil
 }
 
+// loopBody parses the body of a while, do-while or for loop.
+func (p *Parser) loopBody(toks *token.Tokens) (node.Node, error) {
+	p.loops++
+	defer func() { p.loops-- }()
+	return p.Stmt(toks)
+}
+
+// isDecl tells if the simple statement n declares variables.
+func isDecl(n node.Node) bool {
+	switch t := n.(type) {
+	case *node.VarDecl, *node.VarDeclList:
+		return true
+	case *node.OpAssign:
+		_, ok := t.To.(*node.VarDecl)
+		return ok
+	}
+	return false
+}
+
+// nextis tells if the next token is of the given kind.
+func nextis(toks *token.Tokens, kind token.Kind) bool {
+	next := toks.Peek()
+	return next != nil && next.Kind() == kind
+}
+
+// semicolon accepts the ';' ending a statement or a declaration. If it is
+// missing, the error points to where it was expected, that is, the token
+// following the statement or, at the end of input, the last token of the
+// statement.
+func (p *Parser) semicolon(toks *token.Tokens, format string, a ...interface{}) error {
+	if err := toks.Accept(token.Semicolon); err == nil {
+		return nil
+	}
+	at := toks.Peek()
+	if at == nil {
+		at = toks.Prev()
+	}
+	return p.errorf(at, format, a...)
+}
+
 func (p *Parser) Stmt(toks *token.Tokens) (node.Node, error) {
 	first := toks.Peek()
 	if first == nil {
 		return nil, EOT
 	}
+	if err := p.enter(first); err != nil {
+		return nil, err
+	}
+	defer p.leave()
 	// Plain block?
 	if block, err := p.Block(toks); err == nil {
 		return block, nil
 	}
+	if first.Kind() == token.Semicolon {
+		toks.Pop()
+		return node.Store(first, &node.Empty{}), nil
+	}
+	// Labeled statement? We represent "<vid> ':'" as its own statement
+	// preceding the labeled one.
+	if next := toks.PeekNext(); first.Kind() == token.Id && next != nil &&
+		next.Kind() == token.Colon && !p.dialect.IsReserved(first.Value()) {
+		toks.Pop()
+		toks.Pop()
+		return node.Store(first, &node.Label{Name: first.Value()}), nil
+	}
 	switch first.Value() {
 	case "if":
 		toks.Pop()
@@ -186,7 +316,7 @@ func (p *Parser) Stmt(toks *token.Tokens) (node.Node, error) {
 		if err := toks.Accept(token.RParen); err != nil {
 			return nil, p.errorf(first, "`while' condition missing ')'")
 		}
-		body, err := p.Stmt(toks)
+		body, err := p.loopBody(toks)
 		if err != nil {
 			return nil, err
 		}
@@ -194,33 +324,72 @@ func (p *Parser) Stmt(toks *token.Tokens) (node.Node, error) {
 			Cond: cond,
 			Body: body,
 		}), nil
-	case "for":
+	case "do":
 		toks.Pop()
-		if err := toks.Accept(token.LParen); err != nil {
-			return nil, p.errorf(first, "`for' missing '('")
-		}
-		init, err := p.SimpleStmt(toks)
+		body, err := p.loopBody(toks)
 		if err != nil {
 			return nil, err
 		}
-		if err := toks.Accept(token.Semicolon); err != nil {
-			return nil, p.errorf(first, "`for' missing ';' after initializer")
+		next := toks.Peek()
+		if next == nil || !(next.Kind() == token.Id && next.Value() == "while") {
+			return nil, p.errorf(first, "`do' missing `while'")
+		}
+		toks.Pop()
+		if err := toks.Accept(token.LParen); err != nil {
+			return nil, p.errorf(first, "`do-while' condition missing '('")
 		}
 		cond, err := p.Expr(toks)
 		if err != nil {
 			return nil, err
 		}
-		if err := toks.Accept(token.Semicolon); err != nil {
-			return nil, p.errorf(first, "`for' missing ';' after condition")
+		if err := toks.Accept(token.RParen); err != nil {
+			return nil, p.errorf(first, "`do-while' condition missing ')'")
 		}
-		oneach, err := p.SimpleStmt(toks)
-		if err != nil {
+		if err := p.semicolon(toks, "`do-while' missing ';'"); err != nil {
 			return nil, err
 		}
+		return node.Store(first, &node.DoWhile{
+			Body: body,
+			Cond: cond,
+		}), nil
+	case "for":
+		toks.Pop()
+		if err := toks.Accept(token.LParen); err != nil {
+			return nil, p.errorf(first, "`for' missing '('")
+		}
+		// All three parts are optional. A missing condition means the loop
+		// is only left with "break".
+		var init, cond, oneach node.Node
+		var err error
+		if !nextis(toks, token.Semicolon) {
+			if init, err = p.SimpleStmt(toks); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.semicolon(toks, "`for' missing ';' after initializer"); err != nil {
+			return nil, err
+		}
+		if !nextis(toks, token.Semicolon) {
+			if cond, err = p.Expr(toks); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.semicolon(toks, "`for' missing ';' after condition"); err != nil {
+			return nil, err
+		}
+		if !nextis(toks, token.RParen) {
+			step := toks.Peek()
+			if oneach, err = p.SimpleStmt(toks); err != nil {
+				return nil, err
+			}
+			if isDecl(oneach) {
+				return nil, p.errorf(step, "%w", ErrStepDecl)
+			}
+		}
 		if err := toks.Accept(token.RParen); err != nil {
 			return nil, p.errorf(first, "`for' missing ')'")
 		}
-		body, err := p.Stmt(toks)
+		body, err := p.loopBody(toks)
 		if err != nil {
 			return nil, err
 		}
@@ -239,8 +408,8 @@ func (p *Parser) Stmt(toks *token.Tokens) (node.Node, error) {
 		if err != nil {
 			return nil, p.errorf(first, "invalid return expression: %w", err)
 		}
-		if err := toks.Accept(token.Semicolon); err != nil {
-			return nil, p.errorf(first, "return missing ';'")
+		if err := p.semicolon(toks, "return missing ';'"); err != nil {
+			return nil, err
 		}
 		return node.Store(first, &node.Return{Expr: expr}), nil
 	case "assert", "error":
@@ -256,8 +425,8 @@ func (p *Parser) Stmt(toks *token.Tokens) (node.Node, error) {
 		if err := toks.Accept(token.RParen); err != nil {
 			return nil, p.errorf(first, "%s statement missing ')'", which)
 		}
-		if err := toks.Accept(token.Semicolon); err != nil {
-			return nil, p.errorf(first, "%s statement missing ';'", which)
+		if err := p.semicolon(toks, "%s statement missing ';'", which); err != nil {
+			return nil, err
 		}
 		var ret node.Node
 		switch which {
@@ -271,20 +440,38 @@ func (p *Parser) Stmt(toks *token.Tokens) (node.Node, error) {
 		return ret, nil
 	case "break":
 		toks.Pop()
-		if err := toks.Accept(token.Semicolon); err != nil {
-			return nil, p.errorf(first, "break statement missing ';'")
+		if p.loops == 0 {
+			return nil, p.errorf(first, "break statement %w", ErrNoLoop)
+		}
+		if err := p.semicolon(toks, "break statement missing ';'"); err != nil {
+			return nil, err
 		}
 		return node.Store(first, &node.Break{}), nil
 	case "continue":
 		toks.Pop()
-		if err := toks.Accept(token.Semicolon); err != nil {
-			return nil, p.errorf(first, "continue statement missing ';'")
+		if p.loops == 0 {
+			return nil, p.errorf(first, "continue statement %w", ErrNoLoop)
+		}
+		if err := p.semicolon(toks, "continue statement missing ';'"); err != nil {
+			return nil, err
 		}
 		return node.Store(first, &node.Continue{}), nil
+	case "goto":
+		toks.Pop()
+		target := toks.Peek()
+		if target == nil || target.Kind() != token.Id ||
+			p.dialect.IsReserved(target.Value()) {
+			return nil, p.errorf(first, "goto missing label")
+		}
+		toks.Pop()
+		if err := p.semicolon(toks, "goto statement missing ';'"); err != nil {
+			return nil, err
+		}
+		return node.Store(first, &node.Goto{Target: target.Value()}), nil
 	default:
 		if ss, err := p.SimpleStmt(toks); err == nil {
-			if err := toks.Accept(token.Semicolon); err != nil {
-				return nil, p.errorf(first, "statement missing ';'")
+			if err := p.semicolon(toks, "statement missing ';'"); err != nil {
+				return nil, err
 			}
 			return ss, nil
 		} else {
@@ -3,8 +3,8 @@ package parse
 import (
 	"errors"
 
-	"github.com/susji/c0/analyze"
 	"github.com/susji/c0/node"
+	"github.com/susji/c0/span"
 	"github.com/susji/c0/token"
 )
 
@@ -32,13 +32,16 @@ func (p *Parser) Type(toks *token.Tokens) (node.Kind, error) {
 	if atom.Kind() != token.Id {
 		return node.Kind{}, errors.New("not a type declaration")
 	}
-	if !analyze.IsValidPrimitive(atom.Value()) {
+	if !p.dialect.IsValidPrimitive(atom.Value()) {
 		if _, ok := p.typedefs[atom.Value()]; !ok {
 			return node.Kind{}, p.errorf(atom, "typedef %q not defined", atom)
 		}
 	}
 
 	toks.Pop()
+	// last is the final token of the type, so that the Kind may span all of
+	// it
+	last := atom
 
 	var pointerlevel, arraylevel int
 	var name string
@@ -66,6 +69,7 @@ func (p *Parser) Type(toks *token.Tokens) (node.Kind, error) {
 		}
 		kind = node.KIND_STRUCT
 		name = sid.Value()
+		last = sid
 	default:
 		// If it's not a primitive type or a struct, it must be a typedef. Or
 		// invalid, but this will be resolved later.
@@ -81,7 +85,7 @@ func (p *Parser) Type(toks *token.Tokens) (node.Kind, error) {
 			break
 		}
 		pointerlevel++
-		toks.Pop()
+		last = toks.Pop()
 	}
 
 	// array level?
@@ -91,9 +95,25 @@ func (p *Parser) Type(toks *token.Tokens) (node.Kind, error) {
 			break
 		}
 		arraylevel++
-		toks.Pop()
+		last = toks.Pop()
 	}
 	k := node.NewKind(kind, pointerlevel, arraylevel, name)
-	ret := node.Store(atom, &k).(*node.Kind)
+	ret := node.Store(spanning(atom, last), &k).(*node.Kind)
 	return *ret, nil
 }
+
+// spanning returns a token like first, which covers everything from first to
+// last.
+func spanning(first, last *token.Token) *token.Token {
+	if first == last {
+		return first
+	}
+	from, to := first.Span(), last.Span()
+	tok := token.New(first.Kind(), span.Span{
+		Lineno0: from.Lineno0,
+		Col0:    from.Col0,
+		Lineno:  to.Lineno,
+		Col:     to.Col,
+	}, first.Value())
+	return &tok
+}
@@ -0,0 +1,102 @@
+// Package program ties together the top-level declarations of an analyzed
+// source file, so the later stages of the compiler need not go through the
+// nodes looking for the ones they are interested in.
+package program
+
+import (
+	"github.com/susji/c0/analyze"
+	"github.com/susji/c0/node"
+)
+
+// Program contains the top-level nodes of a source file sorted by their kind
+// along with the results of analyzing them. The nodes brought in by #use
+// directives are included. Each accessor keeps the nodes in source order.
+type Program struct {
+	nodes        []node.Node
+	functions    []*node.FunDef
+	declarations []*node.FunDecl
+	globals      []*node.VarDecl
+	structs      []*node.Struct
+	typedefs     []node.Node
+	results      *analyze.Results
+}
+
+// New sorts nodes, which should have been analyzed with the results res.
+func New(nodes []node.Node, res *analyze.Results) *Program {
+	ret := &Program{nodes: nodes, results: res}
+	ret.add(nodes)
+	return ret
+}
+
+func (p *Program) add(nodes []node.Node) {
+	for _, n := range nodes {
+		switch t := n.(type) {
+		case *node.FunDef:
+			p.functions = append(p.functions, t)
+		case *node.FunDecl:
+			p.declarations = append(p.declarations, t)
+		case *node.VarDecl, *node.OpAssign:
+			p.addGlobal(t)
+		case *node.VarDeclList:
+			for _, decl := range t.Value {
+				p.addGlobal(decl)
+			}
+		case *node.Struct:
+			p.structs = append(p.structs, t)
+		case *node.Typedef, *node.TypedefFunc:
+			p.typedefs = append(p.typedefs, t)
+		case *node.DirectiveUse:
+			if t.Success {
+				p.add(t.Nodes)
+			}
+		}
+	}
+}
+
+// addGlobal records n if it declares a variable, possibly with an
+// initializer.
+func (p *Program) addGlobal(n node.Node) {
+	if oa, ok := n.(*node.OpAssign); ok {
+		n = oa.To
+	}
+	if vd, ok := n.(*node.VarDecl); ok {
+		p.globals = append(p.globals, vd)
+	}
+}
+
+// Nodes returns the top-level nodes New was given.
+func (p *Program) Nodes() []node.Node {
+	return p.nodes
+}
+
+// Functions returns the function definitions.
+func (p *Program) Functions() []*node.FunDef {
+	return p.functions
+}
+
+// Declarations returns the function declarations without a body.
+func (p *Program) Declarations() []*node.FunDecl {
+	return p.declarations
+}
+
+// Globals returns the variables declared outside functions. C0 does not
+// permit them, so this is empty for programs without errors.
+func (p *Program) Globals() []*node.VarDecl {
+	return p.globals
+}
+
+// Structs returns the struct definitions. Forward declarations are left out.
+func (p *Program) Structs() []*node.Struct {
+	return p.structs
+}
+
+// Typedefs returns the type definitions, which are either *node.Typedef or
+// *node.TypedefFunc.
+func (p *Program) Typedefs() []node.Node {
+	return p.typedefs
+}
+
+// Results returns the results of analyzing the nodes.
+func (p *Program) Results() *analyze.Results {
+	return p.results
+}
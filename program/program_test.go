@@ -0,0 +1,83 @@
+package program_test
+
+import (
+	"testing"
+
+	"github.com/susji/c0/driver"
+	"github.com/susji/c0/lex"
+	"github.com/susji/c0/node"
+	"github.com/susji/c0/parse"
+	"github.com/susji/c0/program"
+	"github.com/susji/c0/testers/assert"
+	"github.com/susji/c0/testers/require"
+)
+
+func TestProgram(t *testing.T) {
+	res := driver.Run([]rune(`
+struct point;
+struct point {
+	int x;
+	int y;
+};
+typedef struct point* pp;
+typedef int cmp(int a, int b);
+int get(pp p);
+int get(pp p) {
+	return p->x;
+}
+int main() {
+	pp p = alloc(struct point);
+	return get(p);
+}
+`), driver.Options{})
+	require.Equal(t, 0, len(res.Errors))
+	p := res.Program()
+	require.NotNil(t, p)
+	assert.Equal(t, len(res.Nodes), len(p.Nodes()))
+	assert.Equal(t, res.Analyzer.Results(), p.Results())
+
+	funcs := p.Functions()
+	require.Equal(t, 2, len(funcs))
+	assert.Equal(t, "get", funcs[0].Name)
+	assert.Equal(t, "main", funcs[1].Name)
+
+	decls := p.Declarations()
+	require.Equal(t, 1, len(decls))
+	assert.Equal(t, "get", decls[0].Name)
+
+	structs := p.Structs()
+	require.Equal(t, 1, len(structs))
+	assert.Equal(t, 2, len(structs[0].Members))
+
+	typedefs := p.Typedefs()
+	require.Equal(t, 2, len(typedefs))
+	_, ok := typedefs[0].(*node.Typedef)
+	assert.True(t, ok)
+	_, ok = typedefs[1].(*node.TypedefFunc)
+	assert.True(t, ok)
+
+	assert.Equal(t, 0, len(p.Globals()))
+}
+
+func TestProgramGlobals(t *testing.T) {
+	// C0 does not have globals and our parser will not produce them, but
+	// they are still sorted correctly if someone gives us them.
+	nodes := []node.Node{}
+	for _, code := range []string{"int a", "int b = 1", "int c, d = 2"} {
+		toks, lexerrs := lex.Lex([]rune(code))
+		require.Equal(t, 0, len(lexerrs))
+		n, err := parse.New().SimpleStmt(toks)
+		require.Nil(t, err)
+		nodes = append(nodes, n)
+	}
+	names := []string{}
+	for _, g := range program.New(nodes, nil).Globals() {
+		names = append(names, g.Name)
+	}
+	assert.Equal(t, []string{"a", "b", "c", "d"}, names)
+}
+
+func TestProgramNotAnalyzed(t *testing.T) {
+	res := driver.Run([]rune("int f( {"), driver.Options{})
+	assert.Nil(t, res.Program())
+}
@@ -2,92 +2,306 @@ package ssa
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/susji/c0/cfg"
 	"github.com/susji/c0/ir"
 	"github.com/susji/c0/node"
+	"github.com/susji/c0/types"
 )
 
 var typeInt = &ir.Type{Kind: ir.TYPE_INT32, Elements: 0, PointerLevel: 0}
+var typePtr = &ir.Type{Kind: ir.TYPE_PTR, Elements: 0, PointerLevel: 0}
 var valueZero = &ir.Numeric32i{Value: 0}
 
+var icmppreds = map[node.KindOpBin]int{
+	node.OPBIN_EQ: ir.ICMP_EQ,
+	node.OPBIN_NE: ir.ICMP_NE,
+	node.OPBIN_LT: ir.ICMP_LT,
+	node.OPBIN_GT: ir.ICMP_GT,
+	node.OPBIN_LE: ir.ICMP_LE,
+	node.OPBIN_GE: ir.ICMP_GE,
+}
+
+var irkinds = map[types.TypeEnum]int{
+	types.TYPE_INT:  ir.TYPE_INT32,
+	types.TYPE_BOOL: ir.TYPE_BOOL,
+	types.TYPE_CHAR: ir.TYPE_CHAR,
+}
+
+// irType maps a C0 type to the IR. Integers, booleans, and characters keep
+// their pointer levels, but everything else is a reference we do not know
+// more about. We have no IR type for void, so it stays an integer nobody will
+// look at.
+func irType(k *types.Type) *ir.Type {
+	if k.ArrayLevel > 0 {
+		return typePtr
+	}
+	if k.Type == types.TYPE_VOID && k.PointerLevel == 0 {
+		return typeInt
+	}
+	if kind, ok := irkinds[k.Type]; ok {
+		return &ir.Type{Kind: kind, PointerLevel: k.PointerLevel}
+	}
+	return typePtr
+}
+
+// typeOf returns the IR type of the value n evaluates to as determined by
+// analysis. Without the results, everything is an integer.
+func (s *SSA) typeOf(n node.Node) *ir.Type {
+	if s.results == nil {
+		return typeInt
+	}
+	k := s.results.TypeOf(n)
+	if k == nil {
+		return typeInt
+	}
+	return irType(k)
+}
+
+func (s *SSA) returnType() *ir.Type {
+	if s.results == nil {
+		return typeInt
+	}
+	f, ok := s.results.Functions[s.cfg.Definition().Name]
+	if !ok {
+		return typeInt
+	}
+	return irType(s.results.Canonical(&f.Returns))
+}
+
+// varType returns the type of the variable called name. Phis may need it
+// before the variable has been declared in the instruction stream, so the
+// types of all declarations are collected before emitting anything.
+//
+// Like the rest of SSA construction, this goes by name only. If sibling
+// scopes declare the same name with different types, as in
+// "{ bool x; } { int x; }", the last declaration decides the type and a phi
+// merging them gets the wrong type for one of its edges.
+func (s *SSA) varType(name string) *ir.Type {
+	if k, ok := s.vartypes[name]; ok {
+		return k
+	}
+	return typeInt
+}
+
+func (s *SSA) collectVarTypes() {
+	def := s.cfg.Definition()
+	for i := range def.Params {
+		s.vartypes[def.Params[i].Name] = s.typeOf(&def.Params[i])
+	}
+	node.Walk(&def.Body, func(n node.Node, _ int) bool {
+		if vd, ok := n.(*node.VarDecl); ok {
+			s.vartypes[vd.Name] = s.typeOf(vd)
+		}
+		return true
+	})
+}
+
+func (s *SSA) emitFunCall(n *node.OpBinary) {
+	callee, ok := n.Left.(*node.Variable)
+	if !ok {
+		s.unsupported(n, "function pointer call")
+		s.registerNew()
+		return
+	}
+	args := []ir.Value{}
+	for _, arg := range n.Right.(*node.Args).Value {
+		args = append(args, s.emitLoadable(arg))
+	}
+	s.emit(ir.FunCall{
+		Type:   s.typeOf(n),
+		To:     s.registerNew(),
+		Callee: callee.Value,
+		Args:   args,
+	})
+}
+
 func (s *SSA) emitOpBinary(n *node.OpBinary) {
+	defer s.from(n)()
 	fmt.Println("emitOpBinary:", n)
+	if n.Op == node.OPBIN_FUNCALL {
+		s.emitFunCall(n)
+		return
+	}
+	// Operands of unsupported operators, such as the field name of "p->a",
+	// may not be values at all, so they are left alone.
+	switch n.Op {
+	case node.OPBIN_ADD, node.OPBIN_SUB, node.OPBIN_MUL, node.OPBIN_DIV,
+		node.OPBIN_MOD, node.OPBIN_EQ, node.OPBIN_NE, node.OPBIN_LT,
+		node.OPBIN_GT, node.OPBIN_LE, node.OPBIN_GE:
+	default:
+		s.unsupported(n, "binary operator")
+		s.registerNew()
+		return
+	}
 	left := s.emitLoadable(n.Left)
 	right := s.emitLoadable(n.Right)
 	to := s.registerNew()
+	k := s.typeOf(n)
 	switch n.Op {
 	case node.OPBIN_ADD:
-		s.emit(ir.Add{Type: typeInt, To: to, Left: left, Right: right})
+		s.emit(ir.Add{Type: k, To: to, Left: left, Right: right})
+	case node.OPBIN_SUB:
+		s.emit(ir.Sub{Type: k, To: to, Left: left, Right: right})
 	case node.OPBIN_MUL:
-		s.emit(ir.Mul{Type: typeInt, To: to, Left: left, Right: right})
+		s.emit(ir.Mul{Type: k, To: to, Left: left, Right: right})
+	case node.OPBIN_DIV:
+		s.emit(ir.Div{Type: k, To: to, Left: left, Right: right})
+	case node.OPBIN_MOD:
+		s.emit(ir.Mod{Type: k, To: to, Left: left, Right: right})
+	case node.OPBIN_EQ, node.OPBIN_NE, node.OPBIN_LT, node.OPBIN_GT,
+		node.OPBIN_LE, node.OPBIN_GE:
+		s.emit(ir.ICmp{
+			Type:  s.typeOf(n.Left),
+			Pred:  icmppreds[n.Op],
+			To:    to,
+			Left:  left,
+			Right: right,
+		})
+	}
+}
+
+func (s *SSA) emitOpUnary(n *node.OpUnary) *ir.Variable {
+	defer s.from(n)()
+	switch n.Op {
+	case node.OPUN_ADDONE, node.OPUN_SUBONE,
+		node.OPUN_ADDONESUFFIX, node.OPUN_SUBONESUFFIX:
+		return s.emitIncrement(n)
 	default:
-		fmt.Println("XXX UNHANDLED OP BINARY:", n.String())
+		s.unsupported(n, "unary operator")
+		return s.registerNew()
 	}
 }
 
-func (s *SSA) emitOpUnary(n *node.OpUnary) {
-	s.emitNode(n.To)
+// emitIncrement stores the incremented or decremented value into a new
+// generation of the target. The prefix forms evaluate to the value after the
+// change and the suffix forms to the one before it.
+func (s *SSA) emitIncrement(n *node.OpUnary) *ir.Variable {
+	k := s.typeOf(n.To)
+	before := s.emitLoadable(n.To)
+	one := s.registerNew()
+	s.emit(ir.Mov{Type: k, What: &ir.Numeric32i{Value: 1}, To: one})
+	after := s.registerNew()
 	switch n.Op {
+	case node.OPUN_ADDONE, node.OPUN_ADDONESUFFIX:
+		s.emit(ir.Add{Type: k, To: after, Left: before, Right: one})
 	default:
-		fmt.Println("XXX UNHANDLED OP UNARY:", n.String())
+		s.emit(ir.Sub{Type: k, To: after, Left: before, Right: one})
+	}
+	s.emit(ir.Store{Type: k, From: after, To: s.getNewStorable(n.To)})
+	if n.Op == node.OPUN_ADDONESUFFIX || n.Op == node.OPUN_SUBONESUFFIX {
+		return before
 	}
+	return after
 }
 
 func (s *SSA) emitReturn(n *node.Return) {
-	s.emit(ir.Return{Type: typeInt, With: s.emitLoadable(n.Expr)})
+	if n.Expr == nil {
+		s.emit(ir.Return{Type: s.returnType()})
+		return
+	}
+	s.emit(ir.Return{Type: s.returnType(), With: s.emitLoadable(n.Expr)})
+}
+
+func (s *SSA) getBool(n *node.Bool) *ir.Variable {
+	var val int32
+	if n.Value {
+		val = 1
+	}
+	s.emit(ir.Mov{
+		Type: s.typeOf(n),
+		What: &ir.Numeric32i{Value: val},
+		To:   s.registerNew(),
+	})
+	return s.register()
 }
 
 func (s *SSA) getNumeric32i(n *node.Numeric) *ir.Variable {
 	s.emit(ir.Mov{
-		Type: typeInt,
+		Type: s.typeOf(n),
 		What: &ir.Numeric32i{Value: n.Value},
 		To:   s.registerNew(),
 	})
 	return s.register()
 }
 
-func (s *SSA) getNewVariable(name string) *ir.Variable {
+func (s *SSA) getChar(n *node.ChrLit) *ir.Variable {
+	s.emit(ir.Mov{
+		Type: s.typeOf(n),
+		What: &ir.Numeric32i{Value: int32(n.Value)},
+		To:   s.registerNew(),
+	})
+	return s.register()
+}
+
+func (s *SSA) define(name string) *ir.Variable {
 	n := &ir.Variable{Name: name, Count: s.generations.increase(name)}
-	s.emit(ir.Alloca{Type: typeInt, Align: 4, To: n})
+	s.stacks.push(name, n.Count)
+	s.defined = append(s.defined, name)
 	return n
 }
 
-func (s *SSA) getCurrentVariable(name string) *ir.Variable {
-	return &ir.Variable{Name: name, Count: s.generations.get(name)}
+func (s *SSA) getNewVariable(name string, k *ir.Type) *ir.Variable {
+	n := s.define(name)
+	s.emit(ir.Alloca{Type: k, Align: k.Align(), To: n})
+	return n
+}
+
+func (s *SSA) getCurrentVariable(n *node.Variable) *ir.Variable {
+	gen, ok := s.stacks.top(n.Value)
+	if !ok {
+		s.unsupported(n, "variable without a definition")
+		return s.registerNew()
+	}
+	return &ir.Variable{Name: n.Value, Count: gen}
 }
 
 func (s *SSA) getNewStorable(n node.Node) *ir.Variable {
 	switch t := n.(type) {
 	case *node.Variable:
-		return s.getCurrentVariable(t.Value)
+		return s.getNewVariable(t.Value, s.typeOf(t))
 	case *node.VarDecl:
-		return s.getNewVariable(t.Name)
+		return s.getNewVariable(t.Name, s.typeOf(t))
 	default:
-		panic(fmt.Sprintf("XXX unhandled storable: %s", t))
+		s.unsupported(n, "assignment target")
+		return s.registerNew()
 	}
 }
 
 func (s *SSA) emitLoadable(n node.Node) *ir.Variable {
+	defer s.from(n)()
 	switch t := n.(type) {
 	case *node.Variable:
 		s.emit(ir.Load{
-			Type: typeInt,
-			From: s.getCurrentVariable(t.Value),
+			Type: s.typeOf(t),
+			From: s.getCurrentVariable(t),
 			To:   s.registerNew(),
 		})
 	case *node.VarDecl:
+		k := s.typeOf(t)
 		s.emit(ir.Load{
-			Type: typeInt,
-			From: s.getNewVariable(t.Name),
+			Type: k,
+			From: s.getNewVariable(t.Name, k),
 			To:   s.registerNew(),
 		})
 	case *node.Numeric:
 		s.getNumeric32i(t)
+	case *node.Bool:
+		s.getBool(t)
+	case *node.ChrLit:
+		s.getChar(t)
 	case *node.OpBinary:
 		s.emitOpBinary(t)
+	case *node.OpUnary:
+		return s.emitOpUnary(t)
+	case *node.OpAssign:
+		// A chained assignment evaluates to its freshly assigned target.
+		s.emitAssign(t)
+		return s.emitLoadable(t.To)
 	default:
-		panic(fmt.Sprintf("XXX unhandled assignment source: %s", t))
+		s.unsupported(n, "expression")
+		s.registerNew()
 	}
 	return s.register()
 }
@@ -95,11 +309,22 @@ func (s *SSA) emitLoadable(n node.Node) *ir.Variable {
 func (s *SSA) emitAssign(n *node.OpAssign) {
 	fmt.Println("emitAssign:", n)
 	// each assignment means a new variable generation
+	// the source has to be evaluated with the previous generation visible
+	if n.Op != node.OPASN_PLAIN {
+		s.unsupported(n, "compound assignment")
+		return
+	}
+	if n.What == nil {
+		s.getNewStorable(n.To)
+		return
+	}
+	from := s.emitLoadable(n.What)
 	to := s.getNewStorable(n.To)
-	s.emit(ir.Store{Type: typeInt, From: s.emitLoadable(n.What), To: to})
+	s.emit(ir.Store{Type: s.typeOf(n.To), From: from, To: to})
 }
 
 func (s *SSA) emitNode(n node.Node) {
+	defer s.from(n)()
 	switch t := n.(type) {
 	case *node.OpAssign:
 		s.emitAssign(t)
@@ -109,22 +334,246 @@ func (s *SSA) emitNode(n node.Node) {
 		s.emitOpUnary(t)
 	case *node.Return:
 		s.emitReturn(t)
+	case *node.VarDecl:
+		s.getNewVariable(t.Name, s.typeOf(t))
+	case *node.Break, *node.Continue, *node.Goto, *node.Label:
+		// the CFG edges already encode these
+	default:
+		s.unsupported(n, "statement")
+	}
+}
+
+// label returns the name of the IR label starting a basic block.
+func label(bb *cfg.BasicBlock) string {
+	switch bb.Id {
+	case cfg.BLOCKID_ENTRY:
+		return "entry"
+	case cfg.BLOCKID_EXIT:
+		return "exit"
+	}
+	return fmt.Sprintf("bb%d", bb.Id)
+}
+
+// definitions returns the names of variables assigned to within a block.
+func definitions(bb *cfg.BasicBlock) []string {
+	ret := []string{}
+	for _, stmt := range bb.Stmts {
+		// Assignments and increments may be nested in expressions, as in
+		// "j = i++".
+		node.Walk(stmt, func(n node.Node, _ int) bool {
+			switch t := n.(type) {
+			case *node.VarDecl:
+				ret = append(ret, t.Name)
+			case *node.OpAssign:
+				if to, ok := t.To.(*node.Variable); ok {
+					ret = append(ret, to.Value)
+				}
+			case *node.OpUnary:
+				switch t.Op {
+				case node.OPUN_ADDONE, node.OPUN_SUBONE,
+					node.OPUN_ADDONESUFFIX, node.OPUN_SUBONESUFFIX:
+					if to, ok := t.To.(*node.Variable); ok {
+						ret = append(ret, to.Value)
+					}
+				}
+			}
+			return true
+		})
+	}
+	return ret
+}
+
+type phi struct {
+	name  string
+	edges []ir.PhiEdge
+}
+
+// placePhis determines which variables need a phi in which blocks. A phi is
+// needed at the iterated dominance frontier of all blocks defining a variable.
+func (s *SSA) placePhis() {
+	defsites := map[string][]*cfg.BasicBlock{}
+	for _, bb := range s.dom.order {
+		for _, name := range definitions(bb) {
+			defsites[name] = append(defsites[name], bb)
+		}
+	}
+	names := []string{}
+	for name := range defsites {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		has := map[*cfg.BasicBlock]bool{}
+		work := defsites[name]
+		for len(work) > 0 {
+			bb := work[len(work)-1]
+			work = work[:len(work)-1]
+			for _, df := range s.dom.frontier[bb] {
+				if has[df] {
+					continue
+				}
+				has[df] = true
+				s.phis[df] = append(s.phis[df], phi{
+					name:  name,
+					edges: make([]ir.PhiEdge, len(s.dom.preds[df])),
+				})
+				work = append(work, df)
+			}
+		}
+	}
+}
+
+// branchCond returns the condition deciding a two-way branch or nil if we do
+// not know where to find it.
+func branchCond(kind cfg.Kind) node.Node {
+	switch t := kind.Node.(type) {
+	case *node.If:
+		return t.Cond
+	case *node.While:
+		return t.Cond
+	case *node.For:
+		return t.Cond
+	case *node.DoWhile:
+		return t.Cond
+	case *node.Assert:
+		return t.Expr
 	default:
-		// XXX array subs will have to be handled somehow
-		panic(fmt.Sprintf("XXX unhandled node: %s", t))
+		return nil
+	}
+}
+
+func (s *SSA) emitTerminator(bb *cfg.BasicBlock) {
+	switch len(bb.Successors) {
+	case 0:
+		s.emit(ir.Return{Type: s.returnType()})
+	case 1:
+		if n := len(bb.Stmts); n > 0 {
+			if _, ok := bb.Stmts[n-1].(*node.Return); ok {
+				return
+			}
+		}
+		if to := bb.Successors[0].To; s.next[bb] != to {
+			s.emit(ir.Jump{To: label(to)})
+		}
+	case 2:
+		// Whichever branch target is laid out right after us is reached by
+		// falling through.
+		t, f := bb.Successors[0], bb.Successors[1]
+		switch f.Kind.Kind {
+		case cfg.BK_IFTRUE, cfg.BK_WHILETRUE, cfg.BK_FORTRUE, cfg.BK_DOTRUE,
+			cfg.BK_ASSERTTRUE:
+			t, f = f, t
+		}
+		c := branchCond(t.Kind)
+		if c == nil {
+			s.unsupported(t.Kind.Node, "branch")
+			return
+		}
+		// The jumps come from the condition as well.
+		defer s.from(c)()
+		cond := s.emitLoadable(c)
+		switch s.next[bb] {
+		case t.To:
+			s.emit(ir.JumpZero{Cond: cond, To: label(f.To)})
+		case f.To:
+			s.emit(ir.JumpNonZero{Cond: cond, To: label(t.To)})
+		default:
+			s.emit(ir.JumpZero{Cond: cond, To: label(f.To)})
+			s.emit(ir.Jump{To: label(t.To)})
+		}
+	default:
+		s.unsupported(bb.Successors[0].Kind.Node,
+			fmt.Sprintf("block with %d successors", len(bb.Successors)))
+	}
+}
+
+// emitParams places the values of function parameters, which the caller has
+// placed into our parameter registers, into the first generation of each
+// parameter variable.
+func (s *SSA) emitParams() {
+	for _, param := range s.cfg.Definition().Params {
+		restore := s.from(&param)
+		k := s.typeOf(&param)
+		reg := s.registerNew()
+		s.Params = append(s.Params, reg)
+		s.ParamTypes = append(s.ParamTypes, k)
+		to := s.getNewVariable(param.Name, k)
+		s.emit(ir.Store{Type: k, From: reg, To: to})
+		restore()
 	}
 }
 
+// emitBlock emits the code of a block and then recurses into the blocks it
+// immediately dominates. As this is done in dominator tree order, the topmost
+// generation of each variable is the one reaching the current statement.
 func (s *SSA) emitBlock(bb *cfg.BasicBlock) {
+	mark := len(s.defined)
+	s.cur = bb
+	s.emit(ir.Label{Name: label(bb)})
+	if bb == s.cfg.First() {
+		s.emitParams()
+	}
+	for _, phi := range s.phis[bb] {
+		s.emit(ir.Phi{Type: s.varType(phi.name), To: s.define(phi.name), Edges: phi.edges})
+	}
 	for _, stmt := range bb.Stmts {
 		s.emitNode(stmt)
 	}
+	s.emitTerminator(bb)
+
+	// Fill in our part of the phis in successors. The successors may or may
+	// not have been emitted yet, so the edges are shared with placePhis.
 	for _, succ := range bb.Successors {
-		s.emitBlock(succ.To)
+		for j, pred := range s.dom.preds[succ.To] {
+			if pred != succ {
+				continue
+			}
+			for _, phi := range s.phis[succ.To] {
+				edge := ir.PhiEdge{From: label(bb)}
+				if gen, ok := s.stacks.top(phi.name); ok {
+					edge.Value = &ir.Variable{Name: phi.name, Count: gen}
+				}
+				phi.edges[j] = edge
+			}
+		}
+	}
+
+	for _, child := range s.dom.children[bb] {
+		s.emitBlock(child)
+	}
+	for _, name := range s.defined[mark:] {
+		s.stacks.pop(name)
 	}
+	s.defined = s.defined[:mark]
 }
 
 func (s *SSA) build() {
-	s.emit(ir.Label{Name: "entry"})
+	s.dom = newDominance(s.cfg)
+	s.collectVarTypes()
+	s.placePhis()
+	s.layout()
 	s.emitBlock(s.cfg.First())
+	for _, bb := range s.blocks {
+		s.Instructions = append(s.Instructions, s.code[bb]...)
+		s.Spans = append(s.Spans, s.spans[bb]...)
+	}
+}
+
+// layout decides the order in which blocks end up in the instruction stream.
+// We use reverse postorder except for the exit block, which is placed last.
+func (s *SSA) layout() {
+	var exit *cfg.BasicBlock
+	for _, bb := range s.dom.order {
+		if bb.Id == cfg.BLOCKID_EXIT {
+			exit = bb
+			continue
+		}
+		s.blocks = append(s.blocks, bb)
+	}
+	if exit != nil {
+		s.blocks = append(s.blocks, exit)
+	}
+	for i := 1; i < len(s.blocks); i++ {
+		s.next[s.blocks[i-1]] = s.blocks[i]
+	}
 }
@@ -0,0 +1,32 @@
+package ssa
+
+import (
+	"github.com/susji/c0/cfg"
+)
+
+// dominance collects the CFG information we need for placing phi nodes and
+// renaming variables.
+type dominance struct {
+	// order lists the reachable blocks in reverse postorder
+	order []*cfg.BasicBlock
+	// preds lists the incoming branches of each block
+	preds map[*cfg.BasicBlock][]*cfg.Branch
+	// children forms the dominator tree
+	children map[*cfg.BasicBlock][]*cfg.BasicBlock
+	// frontier is the dominance frontier of each block
+	frontier map[*cfg.BasicBlock][]*cfg.BasicBlock
+}
+
+func newDominance(c *cfg.CFG) *dominance {
+	d := &dominance{
+		order:    c.ReversePostorder(),
+		preds:    c.Predecessors(),
+		children: map[*cfg.BasicBlock][]*cfg.BasicBlock{},
+		frontier: c.DominanceFrontier(),
+	}
+	idom := c.Dominators()
+	for _, bb := range d.order[1:] {
+		d.children[idom[bb]] = append(d.children[idom[bb]], bb)
+	}
+	return d
+}
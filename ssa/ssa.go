@@ -8,8 +8,10 @@
 //    2) Insert phi nodes after branch points
 //
 // As C0 does not permit variable shadowing, scoping issues are easier to
-// manage. Our first approach to phi nodes will be wasteful as we are more
-// interested about a working implementation than efficiency.
+// manage. Phi nodes are placed at the iterated dominance frontiers of the
+// blocks assigning to a variable, and the generations are then renamed by
+// walking the dominator tree. Each generation of a variable is a separate
+// memory slot, so a phi merges the slot addresses of its incoming generations.
 //
 // Note: The SSA generation is meant to be called on per-function basis. The
 // aggregate instructions of these separate runs forms the complete program.
@@ -17,13 +19,19 @@
 package ssa
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
+	"github.com/susji/c0/analyze"
 	"github.com/susji/c0/cfg"
 	"github.com/susji/c0/ir"
+	"github.com/susji/c0/node"
+	"github.com/susji/c0/span"
 )
 
+var ErrUnsupported = errors.New("unsupported construct")
+
 type generations map[string]int
 
 func (g generations) increase(name string) int {
@@ -38,24 +46,88 @@ func (g generations) increase(name string) int {
 	return g[name]
 }
 
-func (g generations) get(name string) int {
-	ret, ok := g[name]
-	if !ok {
-		panic(fmt.Sprintf("unknown generation for %q", name))
+// stacks contain the visible generations of each variable while we walk the
+// dominator tree. The topmost generation is the current one.
+type stacks map[string][]int
+
+func (st stacks) push(name string, gen int) {
+	st[name] = append(st[name], gen)
+}
+
+func (st stacks) pop(name string) {
+	st[name] = st[name][:len(st[name])-1]
+}
+
+func (st stacks) top(name string) (int, bool) {
+	gens := st[name]
+	if len(gens) == 0 {
+		return 0, false
 	}
-	return ret
+	return gens[len(gens)-1], true
 }
 
 type SSA struct {
 	cfg          *cfg.CFG
+	results      *analyze.Results
+	vartypes     map[string]*ir.Type
 	reggen       int
 	generations  generations
+	stacks       stacks
+	dom          *dominance
+	cur          *cfg.BasicBlock
+	blocks       []*cfg.BasicBlock
+	next         map[*cfg.BasicBlock]*cfg.BasicBlock
+	code         map[*cfg.BasicBlock][]ir.Instruction
+	spans        map[*cfg.BasicBlock][]span.Span
+	phis         map[*cfg.BasicBlock][]phi
+	defined      []string
 	Instructions []ir.Instruction
-	Errors       []error
+	// Spans contains the source span of the node each instruction was
+	// emitted for, or a zero Span if there is none, like for labels.
+	Spans  []span.Span
+	Errors []error
+	// Params contains the registers in which the function expects to find
+	// its arguments when called.
+	Params []*ir.Variable
+	// ParamTypes contains the types of Params
+	ParamTypes []*ir.Type
+	// at is the source span of the node we are emitting code for
+	at span.Span
 }
 
 func (s *SSA) emit(inst ir.Instruction) {
-	s.Instructions = append(s.Instructions, inst)
+	s.code[s.cur] = append(s.code[s.cur], inst)
+	s.spans[s.cur] = append(s.spans[s.cur], s.at)
+}
+
+// from makes the instructions emitted until the returned function is called
+// come from n. Nested nodes override it, so an instruction gets the span of
+// the innermost node it was emitted for. Nodes without tokens keep the
+// current span.
+func (s *SSA) from(n node.Node) func() {
+	prev := s.at
+	if n != nil {
+		if tok := n.Tok(); tok != nil {
+			s.at = tok.Span()
+		}
+	}
+	return func() {
+		s.at = prev
+	}
+}
+
+// unsupported records that we cannot generate code for n. We still emit a
+// placeholder so that the rest of the function is generated and remains
+// readable.
+func (s *SSA) unsupported(n node.Node, what string) {
+	err := fmt.Errorf("%w: %s: %s", ErrUnsupported, what, n)
+	if n != nil {
+		if tok := n.Tok(); tok != nil {
+			err = fmt.Errorf("%d:%d: %w", tok.Lineno(), tok.Col(), err)
+		}
+	}
+	s.Errors = append(s.Errors, err)
+	s.emit(ir.Unreachable{Reason: fmt.Sprintf("%s: %s", what, n)})
 }
 
 func (s *SSA) registerNew() *ir.Variable {
@@ -70,15 +142,41 @@ func (s *SSA) register() *ir.Variable {
 func (s *SSA) Dump() string {
 	b := &strings.Builder{}
 	for i, instr := range s.Instructions {
-		b.WriteString(fmt.Sprintf("[%03d] %s\n", i, instr))
+		b.WriteString(fmt.Sprintf("[%03d] %s", i, instr))
+		if at := s.Spans[i]; at != (span.Span{}) {
+			b.WriteString(fmt.Sprintf(" ; %d:%d", at.Lineno0, at.Col0))
+		}
+		b.WriteString("\n")
 	}
 	return b.String()
 }
 
+// Function returns the generated code as an ir.Function, which may be added
+// to an ir.Module.
+func (s *SSA) Function() *ir.Function {
+	return ir.NewFunction(s.cfg.Definition().Name, s.returnType(),
+		s.Params, s.ParamTypes, s.Instructions)
+}
+
+// New generates code for c. Without the results of analysis we do not know
+// the types of anything, so everything is assumed to be an integer.
 func New(c *cfg.CFG) *SSA {
+	return NewWithResults(c, nil)
+}
+
+// NewWithResults generates code for c with the types of values taken from
+// res.
+func NewWithResults(c *cfg.CFG, res *analyze.Results) *SSA {
 	ret := &SSA{
 		cfg:         c,
+		results:     res,
+		vartypes:    map[string]*ir.Type{},
 		generations: generations{},
+		stacks:      stacks{},
+		code:        map[*cfg.BasicBlock][]ir.Instruction{},
+		spans:       map[*cfg.BasicBlock][]span.Span{},
+		phis:        map[*cfg.BasicBlock][]phi{},
+		next:        map[*cfg.BasicBlock]*cfg.BasicBlock{},
 	}
 	ret.build()
 	return ret
@@ -1,37 +1,69 @@
 package ssa_test
 
 import (
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/susji/c0/analyze"
 	"github.com/susji/c0/cfg"
-	"github.com/susji/c0/lex"
+	"github.com/susji/c0/driver"
+	"github.com/susji/c0/ir"
 	"github.com/susji/c0/node"
-	"github.com/susji/c0/parse"
+	"github.com/susji/c0/span"
 	"github.com/susji/c0/ssa"
 	"github.com/susji/c0/ssa/vm"
+	"github.com/susji/c0/testers/assert"
 	"github.com/susji/c0/testers/require"
 )
 
-func do(t *testing.T, code string) *cfg.CFG {
-	toks, lexerrs := lex.Lex([]rune(code))
-	require.Equal(t, 0, len(lexerrs))
-	p := parse.New()
-	perr := p.Parse(toks)
-	require.Nil(t, perr)
-	nn := p.Nodes()
-	require.NotNil(t, nn)
-	a := analyze.New(p.Fn())
-	aerrs := a.Analyze(nn)
-	t.Log("analysis errors:", aerrs)
-	require.Equal(t, 0, len(aerrs))
-	c, cerrs := cfg.Form(nn[0].(*node.FunDef))
-	require.Equal(t, 0, len(cerrs))
-	return c
+// analyzed runs the front-end stages for code, which should pass them.
+func analyzed(t *testing.T, code string) ([]node.Node, *analyze.Results) {
+	res := driver.Run([]rune(code), driver.Options{})
+	t.Log("errors:", res.Errors)
+	require.Equal(t, 0, len(res.Errors))
+	require.NotNil(t, res.Nodes)
+	return res.Nodes, res.Analyzer.Results()
+}
+
+// do forms the CFG of the first function definition in code. The results of
+// analysis are returned for ssa.NewWithResults.
+func do(t *testing.T, code string) (*cfg.CFG, *analyze.Results) {
+	nn, res := analyzed(t, code)
+	for _, n := range nn {
+		if fd, ok := n.(*node.FunDef); ok {
+			c, cerrs := cfg.Form(fd)
+			require.Equal(t, 0, len(cerrs))
+			return c, res
+		}
+	}
+	t.Fatal("no function definition")
+	return nil, nil
+}
+
+// program forms the SSA of all function definitions in code and inserts them
+// into a VM.
+func program(t *testing.T, code string) *vm.VM {
+	nn, res := analyzed(t, code)
+	v := vm.New()
+	for _, n := range nn {
+		fd, ok := n.(*node.FunDef)
+		if !ok {
+			continue
+		}
+		c, cerrs := cfg.Form(fd)
+		require.Equal(t, 0, len(cerrs))
+		s := ssa.NewWithResults(c, res)
+		require.Equal(t, 0, len(s.Errors))
+		t.Log(s.Dump())
+		v.Insert(fd.Name, s)
+	}
+	return v
 }
 
 func TestSimple(t *testing.T) {
-	cfg := do(t, `
+	cfg, res := do(t, `
 int f() {
 	int a = 1;
 	int b = a + 3; // b = 4
@@ -39,10 +71,524 @@ int f() {
 	return a + 1; // 7
 }
 `)
-	s := ssa.New(cfg)
+	s := ssa.NewWithResults(cfg, res)
 	require.Equal(t, 0, len(s.Errors))
 	//fmt.Println(s.Dump())
 	v := vm.New()
 	v.Insert("f", s)
-	require.Equal(t, int32(7), *v.Run(true))
+	ret, err := v.Run(true)
+	require.Nil(t, err)
+	require.Equal(t, int32(7), *ret)
+}
+
+func TestArithmetic(t *testing.T) {
+	cfg, res := do(t, `
+int f() {
+	int a = 17;
+	int b = a - 20;  // -3
+	int c = a / b;   // -5
+	int d = a % b;   // 2
+	int e = (0 - a) % 5; // -2
+	return c * 100 + d * 10 + e; // -500 + 20 - 2 = -482
+}
+`)
+	s := ssa.NewWithResults(cfg, res)
+	require.Equal(t, 0, len(s.Errors))
+	v := vm.New()
+	v.Insert("f", s)
+	ret, err := v.Run(false)
+	require.Nil(t, err)
+	require.Equal(t, int32(-482), *ret)
+}
+
+func TestComparison(t *testing.T) {
+	type entry struct {
+		code string
+		want int32
+	}
+	table := []entry{
+		{"3 < 5", 1},
+		{"5 < 3", 0},
+		{"3 > 5", 0},
+		{"3 <= 3", 1},
+		{"4 >= 5", 0},
+		{"3 == 3", 1},
+		{"3 != 3", 0},
+		{"true", 1},
+		{"false", 0},
+	}
+	for _, e := range table {
+		t.Run(e.code, func(t *testing.T) {
+			cfg, res := do(t, "bool f() { return "+e.code+"; }")
+			s := ssa.NewWithResults(cfg, res)
+			require.Equal(t, 0, len(s.Errors))
+			v := vm.New()
+			v.Insert("f", s)
+			ret, err := v.Run(false)
+			require.Nil(t, err)
+			require.Equal(t, e.want, *ret)
+		})
+	}
+}
+
+func TestIfElse(t *testing.T) {
+	type entry struct {
+		cond string
+		want int32
+	}
+	table := []entry{
+		{"1 < 2", 10},
+		{"2 < 1", 20},
+	}
+	for _, e := range table {
+		t.Run(e.cond, func(t *testing.T) {
+			cfg, res := do(t, "int f(){ int a=0; if("+e.cond+"){a=10;} else {a=20;} return a; }")
+			s := ssa.NewWithResults(cfg, res)
+			require.Equal(t, 0, len(s.Errors))
+			t.Log(s.Dump())
+			v := vm.New()
+			v.Insert("f", s)
+			ret, err := v.Run(false)
+			require.Nil(t, err)
+			require.Equal(t, e.want, *ret)
+		})
+	}
+}
+
+func TestIfNoElse(t *testing.T) {
+	cfg, res := do(t, `
+int f() {
+	int a = 1;
+	if (a < 2)
+		a = a + 5;
+	if (a > 100)
+		a = 0;
+	return a;
+}
+`)
+	s := ssa.NewWithResults(cfg, res)
+	require.Equal(t, 0, len(s.Errors))
+	t.Log(s.Dump())
+	v := vm.New()
+	v.Insert("f", s)
+	ret, err := v.Run(false)
+	require.Nil(t, err)
+	require.Equal(t, int32(6), *ret)
+}
+
+func TestPhiIfElse(t *testing.T) {
+	type entry struct {
+		cond string
+		want int32
+	}
+	table := []entry{
+		{"true", 11},
+		{"false", 21},
+	}
+	for _, e := range table {
+		t.Run(e.cond, func(t *testing.T) {
+			cfg, res := do(t, `
+int f() {
+	int a = 1;
+	int b = 1;
+	if (`+e.cond+`) {
+		a = 10;
+	} else {
+		a = 20;
+	}
+	return a + b;
+}
+`)
+			s := ssa.NewWithResults(cfg, res)
+			require.Equal(t, 0, len(s.Errors))
+			t.Log(s.Dump())
+			v := vm.New()
+			v.Insert("f", s)
+			ret, err := v.Run(false)
+			require.Nil(t, err)
+			require.Equal(t, e.want, *ret)
+		})
+	}
+}
+
+func TestPhiLoop(t *testing.T) {
+	cfg, res := do(t, `
+int f() {
+	int n = 5;
+	bool again = true;
+	while (again) {
+		n = n * 2;
+		again = false;
+	}
+	return n;
+}
+`)
+	s := ssa.NewWithResults(cfg, res)
+	require.Equal(t, 0, len(s.Errors))
+	t.Log(s.Dump())
+	v := vm.New()
+	v.Insert("f", s)
+	ret, err := v.Run(false)
+	require.Nil(t, err)
+	require.Equal(t, int32(10), *ret)
+}
+
+func TestDoWhile(t *testing.T) {
+	cfg, res := do(t, `
+int f() {
+	int n = 5;
+	do {
+		n = n * 2;
+	} while (n < 5);
+	return n;
+}
+`)
+	s := ssa.NewWithResults(cfg, res)
+	require.Equal(t, 0, len(s.Errors))
+	t.Log(s.Dump())
+	v := vm.New()
+	v.Insert("f", s)
+	ret, err := v.Run(false)
+	require.Nil(t, err)
+	require.Equal(t, int32(10), *ret)
+}
+
+func TestChainedAssign(t *testing.T) {
+	v := program(t, `
+int f() {
+	int a;
+	int b;
+	a = b = 3;
+	return a + b;
+}
+`)
+	ret, err := v.Run(false)
+	require.Nil(t, err)
+	require.Equal(t, int32(6), *ret)
+}
+
+func TestGoto(t *testing.T) {
+	v := program(t, `
+int f() {
+	int i = 0;
+	int sum = 0;
+again:
+	sum = sum + i;
+	i = i + 1;
+	if (i <= 4)
+		goto again;
+	return sum;
+}
+`)
+	ret, err := v.Run(false)
+	require.Nil(t, err)
+	require.Equal(t, int32(10), *ret)
+}
+
+func TestForInfinite(t *testing.T) {
+	v := program(t, `
+int f() {
+	int n = 1;
+	for (;;) {
+		if (n > 100)
+			break;
+		n = n * 3;
+	}
+	return n;
+}
+`)
+	ret, err := v.Run(false)
+	require.Nil(t, err)
+	require.Equal(t, int32(243), *ret)
+}
+
+func TestMultipleDeclarators(t *testing.T) {
+	v := program(t, `
+int f() {
+	int a = 1, b, c = 3;
+	b = 2;
+	return a + b * c;
+}
+`)
+	ret, err := v.Run(false)
+	require.Nil(t, err)
+	require.Equal(t, int32(7), *ret)
+}
+
+func TestFunCall(t *testing.T) {
+	v := program(t, `
+int add(int a, int b) {
+	return a + b;
+}
+
+int twice(int a) {
+	return add(a, a);
+}
+
+int main() {
+	int x = add(3, 4);
+	return twice(x) - add(x, 1); // 14 - 8
+}
+`)
+	ret, err := v.Run(false)
+	require.Nil(t, err)
+	require.Equal(t, int32(6), *ret)
+}
+
+func TestFunCallRecursive(t *testing.T) {
+	v := program(t, `
+int fact(int n) {
+	if (n <= 1)
+		return 1;
+	return n * fact(n - 1);
+}
+
+int main() {
+	return fact(5);
+}
+`)
+	ret, err := v.Run(false)
+	require.Nil(t, err)
+	require.Equal(t, int32(120), *ret)
+}
+
+func TestIncrement(t *testing.T) {
+	type entry struct {
+		code string
+		want int32
+	}
+	// Like in C0, the suffix forms are only permitted as statements, so
+	// their value is never used.
+	table := []entry{
+		{"int i = 1; int j = i; i++; return i * 10 + j;", 21},
+		{"int i = 1; int j = ++i; return i * 10 + j;", 22},
+		{"int i = 5; int j = i; i--; return i * 10 + j;", 45},
+		{"int i = 5; int j = --i; return i * 10 + j;", 44},
+		{"int i = 1; i++; ++i; return i;", 3},
+		{"int i = 1; int j = ++i + ++i; return i * 10 + j;", 35},
+		{"int j = 0; for (int i = 0; i < 5; i++) { j = j + i; } return j;", 10},
+		{"int i = 0; int j = 0; while (i < 3) { j = j + ++i; } return i * 10 + j;", 36},
+	}
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			v := program(t, "int main() { "+cur.code+" }")
+			ret, err := v.Run(false)
+			require.Nil(t, err)
+			assert.Equal(t, cur.want, *ret)
+		})
+	}
+}
+
+func TestIncrementSuffixValue(t *testing.T) {
+	type entry struct {
+		code string
+		op   node.KindOpUn
+		want int32
+	}
+	// The parser does not let suffix forms into expressions, so we parse
+	// the prefix form and turn it into a suffix one by hand.
+	table := []entry{
+		{"int i = 1; int j = ++i; return i * 10 + j;", node.OPUN_ADDONESUFFIX, 21},
+		{"int i = 5; int j = --i; return i * 10 + j;", node.OPUN_SUBONESUFFIX, 45},
+	}
+	for _, cur := range table {
+		t.Run(cur.code, func(t *testing.T) {
+			nn, res := analyzed(t, "int main() { "+cur.code+" }")
+			fd := nn[0].(*node.FunDef)
+			init := fd.Body.Value[1].(*node.OpAssign).What.(*node.OpUnary)
+			init.Op = cur.op
+			c, cerrs := cfg.Form(fd)
+			require.Equal(t, 0, len(cerrs))
+			s := ssa.NewWithResults(c, res)
+			require.Equal(t, 0, len(s.Errors))
+			t.Log(s.Dump())
+			v := vm.New()
+			v.Insert(fd.Name, s)
+			ret, err := v.Run(false)
+			require.Nil(t, err)
+			assert.Equal(t, cur.want, *ret)
+		})
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	type entry struct {
+		name, code string
+	}
+	table := []entry{
+		{"string", `
+int f() {
+	int a = 1;
+	string s = "unsupported";
+	a = a + 1;
+	return a;
+}
+`},
+		{"struct field", `
+struct s { int a; };
+int f() {
+	struct s* p = alloc(struct s);
+	return p->a;
+}
+`},
+	}
+	for _, e := range table {
+		t.Run(e.name, func(t *testing.T) {
+			cfg, res := do(t, e.code)
+			s := ssa.NewWithResults(cfg, res)
+			t.Log(s.Dump())
+			require.True(t, len(s.Errors) > 0)
+			for _, err := range s.Errors {
+				t.Log(err)
+				require.True(t, errors.Is(err, ssa.ErrUnsupported))
+			}
+			// The rest of the function is still generated.
+			require.True(t, strings.Contains(s.Dump(), "UNREACHABLE"))
+			require.True(t, strings.Contains(s.Dump(), "RET"))
+
+			v := vm.New()
+			v.Insert("f", s)
+			_, err := v.Run(false)
+			require.True(t, errors.Is(err, vm.ErrUnreachable))
+		})
+	}
+}
+
+func TestUnsupportedAssert(t *testing.T) {
+	// The CFG branches on the condition of an assert, but we do not know yet
+	// how to abort.
+	cfg, res := do(t, `
+int f(int a) {
+	assert(a > 0);
+	return a;
+}
+`)
+	s := ssa.NewWithResults(cfg, res)
+	t.Log(s.Dump())
+	require.Equal(t, 1, len(s.Errors))
+	require.True(t, errors.Is(s.Errors[0], ssa.ErrUnsupported))
+	require.True(t, strings.Contains(s.Dump(), "RET"))
+}
+
+func TestSpans(t *testing.T) {
+	s := ssa.NewWithResults(do(t, `int f(int a) {
+	int b = a * 3;
+	if (b > 10) {
+		b = 10;
+	}
+	return b;
+}
+`))
+	require.Equal(t, 0, len(s.Errors))
+	require.Equal(t, len(s.Instructions), len(s.Spans))
+	dump := s.Dump()
+	t.Log(dump)
+	lines := strings.Split(strings.TrimSpace(dump), "\n")
+	require.Equal(t, len(s.Instructions), len(lines))
+	kinds := map[string]int{}
+	for i, instr := range s.Instructions {
+		// Labels, phis, and the return of the exit block do not come from
+		// any node.
+		switch instr.(type) {
+		case ir.Label, ir.Phi:
+			assert.Equal(t, span.Span{}, s.Spans[i])
+			assert.False(t, strings.Contains(lines[i], " ; "))
+			continue
+		case ir.Mul:
+			kinds["mul"] = s.Spans[i].Lineno0
+		case ir.ICmp:
+			kinds["cmp"] = s.Spans[i].Lineno0
+		case ir.JumpZero, ir.JumpNonZero:
+			kinds["jump"] = s.Spans[i].Lineno0
+		case ir.Return:
+			if i == len(s.Instructions)-1 {
+				assert.Equal(t, span.Span{}, s.Spans[i])
+				continue
+			}
+			kinds["return"] = s.Spans[i].Lineno0
+		}
+		assert.Truef(t, strings.HasSuffix(lines[i],
+			fmt.Sprintf(" ; %d:%d", s.Spans[i].Lineno0, s.Spans[i].Col0)),
+			"no span in %q", lines[i])
+	}
+	assert.Equal(t, map[string]int{"mul": 2, "cmp": 3, "jump": 3, "return": 6}, kinds)
+}
+
+func TestModuleString(t *testing.T) {
+	m := &ir.Module{}
+	m.Add(ssa.NewWithResults(do(t, `int f(int a) {
+	if (a > 0)
+		return a + 1;
+	return 0;
+}
+`)).Function())
+	got := m.String()
+	t.Log(got)
+	assert.Equal(t, `define [i32] @f([i32] %1) {
+entry:
+  %a_0 = ALLOCA [i32], align 4
+  STORE<[i32]> %1, [%a_0]
+bb2:
+  LOAD<[i32]> [%a_0], %2
+  MOV<[i32]> 0 [32i], %3
+  %4 = ICMP<[i32]> gt %2, %3
+  JZ %4, %bb3
+bb4:
+  LOAD<[i32]> [%a_0], %5
+  MOV<[i32]> 1 [32i], %6
+  %7 = ADD<[i32]> %5, %6
+  RET<[i32]> %7
+bb3:
+  MOV<[i32]> 0 [32i], %8
+  RET<[i32]> %8
+exit:
+  RET<[i32]>
+}
+`, got)
+
+	// Each parameter is shown with its own type, not with the return type.
+	f := ssa.NewWithResults(do(t, `bool g(char c, int a) {
+	return a > 0;
+}
+`)).Function()
+	got = f.String()
+	t.Log(got)
+	assert.True(t, strings.HasPrefix(got, "define [i1] @g([i8] %1, [i32] %2) {\n"))
+}
+
+func TestTypes(t *testing.T) {
+	s := ssa.NewWithResults(do(t, `bool f(int a) {
+	bool b = a > 3;
+	char c = 'x';
+	if (b) {
+		b = false;
+	}
+	return b;
+}
+`))
+	require.Equal(t, 0, len(s.Errors))
+	t.Log(s.Dump())
+	typeInt := &ir.Type{Kind: ir.TYPE_INT32}
+	typeBool := &ir.Type{Kind: ir.TYPE_BOOL}
+	typeChar := &ir.Type{Kind: ir.TYPE_CHAR}
+	allocas := map[string]ir.Alloca{}
+	for _, instr := range s.Instructions {
+		switch in := instr.(type) {
+		case ir.Alloca:
+			allocas[in.To.Name] = in
+		case ir.ICmp:
+			// The operands are compared as integers, which gives a boolean.
+			assert.Equal(t, typeInt, in.Type)
+		case ir.Phi:
+			assert.Equal(t, typeBool, in.Type)
+		case ir.Return:
+			assert.Equal(t, typeBool, in.Type)
+		}
+	}
+	assert.Equal(t, typeInt, allocas["a"].Type)
+	assert.Equal(t, uint(4), allocas["a"].Align)
+	assert.Equal(t, typeBool, allocas["b"].Type)
+	assert.Equal(t, uint(1), allocas["b"].Align)
+	assert.Equal(t, typeChar, allocas["c"].Type)
+	assert.True(t, strings.HasPrefix(s.Function().String(), "define [i1] @f([i32] %1) {"))
 }
@@ -1,16 +1,45 @@
 package vm
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"strings"
 
 	"github.com/susji/c0/ir"
 	"github.com/susji/c0/ssa"
 )
 
+var (
+	ErrAddressOutOfRange = errors.New("memory address out of range")
+	ErrUnreachable       = errors.New("reached code which could not be generated")
+	ErrDivByZero         = errors.New("division by zero or overflow")
+)
+
+// RuntimeError describes a fault in the program being run.
+type RuntimeError struct {
+	Func    string
+	Inst    ir.Instruction
+	Wrapped error
+}
+
+func (e *RuntimeError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", e.Func, e.Inst, e.Wrapped)
+}
+
+func (e *RuntimeError) Unwrap() error {
+	return e.Wrapped
+}
+
+// Entry is the name of the function Run starts from.
+const Entry = "main"
+
 type VM struct {
 	funcs map[string]*ssa.SSA
+	// regs are the registers of the function currently running, and stack
+	// contains the registers of its callers.
 	regs  map[ir.Variable]int32
+	stack []map[ir.Variable]int32
 	mem   []int32
 }
 
@@ -30,9 +59,20 @@ func (vm *VM) Inst(name, f string, va ...interface{}) {
 	fmt.Printf(fmt.Sprintf("%-10s | ", name)+f+"\n", va...)
 }
 
-func (vm *VM) Load(from *ir.Variable, to *ir.Variable) {
+func (vm *VM) checkAddr(addr int32) error {
+	if addr < 0 || int(addr) >= len(vm.mem) {
+		return fmt.Errorf("%w: %d", ErrAddressOutOfRange, addr)
+	}
+	return nil
+}
+
+func (vm *VM) Load(from *ir.Variable, to *ir.Variable) error {
 	fi := vm.regs[*from]
+	if err := vm.checkAddr(fi); err != nil {
+		return err
+	}
 	vm.regs[*to] = vm.mem[fi]
+	return nil
 }
 
 func (vm *VM) Set(to *ir.Variable, what ir.Value) {
@@ -46,9 +86,13 @@ func (vm *VM) Set(to *ir.Variable, what ir.Value) {
 	vm.regs[*to] = val
 }
 
-func (vm *VM) Store(variable, value *ir.Variable) {
+func (vm *VM) Store(variable, value *ir.Variable) error {
 	ptr := vm.regs[*variable]
+	if err := vm.checkAddr(ptr); err != nil {
+		return err
+	}
 	vm.mem[ptr] = vm.regs[*value]
+	return nil
 }
 
 func (vm *VM) Alloca() int32 {
@@ -74,6 +118,18 @@ func (vm *VM) BinOp(to *ir.Variable, left, right ir.Value, op func(v1, v2 int32)
 	vm.Set(to, &ir.Numeric32i{Value: op(l, r)})
 }
 
+// DivOp is BinOp for division and modulus. Like in C0, dividing by zero and
+// dividing math.MinInt32 by -1 are faults.
+func (vm *VM) DivOp(to *ir.Variable, left, right ir.Value, op func(v1, v2 int32) int32) error {
+	l := vm.ExtractValue(left)
+	r := vm.ExtractValue(right)
+	if r == 0 || (l == math.MinInt32 && r == -1) {
+		return fmt.Errorf("%w: %d, %d", ErrDivByZero, l, r)
+	}
+	vm.Set(to, &ir.Numeric32i{Value: op(l, r)})
+	return nil
+}
+
 func (vm *VM) DumpMem() string {
 	b := &strings.Builder{}
 	b.WriteString("# memory\n")
@@ -92,53 +148,220 @@ func (vm *VM) DumpRegs() string {
 	return b.String()
 }
 
-func (vm *VM) Run(verbose bool) *int32 {
-	ret := new(int32)
-	for fun, fus := range vm.funcs {
-		fmt.Println("# func:", fun)
-		for _, inst := range fus.Instructions {
-			switch t := inst.(type) {
-			case ir.Alloca:
-				vm.Inst("alloca", "%s", t.To)
-				vm.regs[*t.To] = vm.Alloca()
-			case ir.Mov:
-				vm.Inst("mov", "%s -> %s", t.What, t.To)
-				vm.Set(t.To, t.What)
-			case ir.Store:
-				vm.Inst("store", "%s -> [%s]", t.From, t.To)
-				vm.Store(t.To, t.From)
-			case ir.Load:
-				vm.Inst("load", "[%s] -> %s", t.From, t.To)
-				vm.Load(t.From, t.To)
-			case ir.Add:
-				vm.Inst("add", "%s = %s + %s", t.To, t.Left, t.Right)
-				vm.BinOp(t.To, t.Left, t.Right, func(v1, v2 int32) int32 {
-					return v1 + v2
-				})
-			case ir.Mul:
-				vm.Inst("mul", "%s = %s * %s", t.To, t.Left, t.Right)
-				vm.BinOp(t.To, t.Left, t.Right, func(v1, v2 int32) int32 {
-					return v1 * v2
-				})
-			case ir.Xor:
-				vm.Inst("xor", "%s = %s ^ %s", t.To, t.Left, t.Right)
-				vm.BinOp(t.To, t.Left, t.Right, func(v1, v2 int32) int32 {
-					return v1 ^ v2
-				})
-			case ir.Return:
-				vm.Inst("return", "%s", t.With)
-				*ret = vm.ExtractValue(t.With)
-				break
-			case ir.Label:
-				vm.Inst("label", "%s", t.Name)
-			default:
-				panic(fmt.Sprintf("unknown instruction: %s", inst))
+// Phis evaluates the consecutive phis starting at pc simultaneously. The
+// position of the first non-phi instruction is returned.
+func (vm *VM) Phis(insts []ir.Instruction, pc int, pred string) int {
+	type result struct {
+		to  *ir.Variable
+		val int32
+	}
+	results := []result{}
+	for ; pc < len(insts); pc++ {
+		phi, ok := insts[pc].(ir.Phi)
+		if !ok {
+			break
+		}
+		vm.Inst("phi", "%s <- %s", phi.To, pred)
+		found := false
+		for _, edge := range phi.Edges {
+			if edge.From != pred {
+				continue
 			}
-			if verbose {
-				fmt.Println(vm.DumpMem())
-				fmt.Println(vm.DumpRegs())
+			var val int32
+			if edge.Value != nil {
+				val = vm.ExtractValue(edge.Value)
 			}
+			results = append(results, result{phi.To, val})
+			found = true
+			break
+		}
+		if !found {
+			panic(fmt.Sprintf("phi %s has no edge from %q", phi.To, pred))
+		}
+	}
+	for _, r := range results {
+		vm.regs[*r.to] = r.val
+	}
+	return pc
+}
+
+func compare(pred int, v1, v2 int32) bool {
+	switch pred {
+	case ir.ICMP_EQ:
+		return v1 == v2
+	case ir.ICMP_NE:
+		return v1 != v2
+	case ir.ICMP_LT:
+		return v1 < v2
+	case ir.ICMP_GT:
+		return v1 > v2
+	case ir.ICMP_LE:
+		return v1 <= v2
+	case ir.ICMP_GE:
+		return v1 >= v2
+	default:
+		panic(fmt.Sprintf("unknown comparison predicate: %d", pred))
+	}
+}
+
+func labels(insts []ir.Instruction) map[string]int {
+	ret := map[string]int{}
+	for i, inst := range insts {
+		if l, ok := inst.(ir.Label); ok {
+			ret[l.Name] = i
 		}
 	}
 	return ret
 }
+
+// Call runs the named function with the given arguments in a fresh register
+// frame and returns its result. Faults are returned as a *RuntimeError.
+func (vm *VM) Call(name string, args []int32, verbose bool) (int32, error) {
+	fus, ok := vm.funcs[name]
+	if !ok {
+		panic(fmt.Sprintf("calling unknown function: %q", name))
+	}
+	if len(args) != len(fus.Params) {
+		panic(fmt.Sprintf("calling %q with %d arguments, wanted %d",
+			name, len(args), len(fus.Params)))
+	}
+	vm.stack = append(vm.stack, vm.regs)
+	vm.regs = map[ir.Variable]int32{}
+	for i, param := range fus.Params {
+		vm.regs[*param] = args[i]
+	}
+	defer func() {
+		vm.regs = vm.stack[len(vm.stack)-1]
+		vm.stack = vm.stack[:len(vm.stack)-1]
+	}()
+
+	fmt.Println("# func:", name)
+	var ret int32
+	var err error
+	insts := fus.Instructions
+	targets := labels(insts)
+	var pred, cur string
+run:
+	for pc := 0; pc < len(insts); {
+		inst := insts[pc]
+		pc++
+		switch t := inst.(type) {
+		case ir.Alloca:
+			vm.Inst("alloca", "%s", t.To)
+			vm.regs[*t.To] = vm.Alloca()
+		case ir.Mov:
+			vm.Inst("mov", "%s -> %s", t.What, t.To)
+			vm.Set(t.To, t.What)
+		case ir.Store:
+			vm.Inst("store", "%s -> [%s]", t.From, t.To)
+			err = vm.Store(t.To, t.From)
+		case ir.Load:
+			vm.Inst("load", "[%s] -> %s", t.From, t.To)
+			err = vm.Load(t.From, t.To)
+		case ir.Add:
+			vm.Inst("add", "%s = %s + %s", t.To, t.Left, t.Right)
+			vm.BinOp(t.To, t.Left, t.Right, func(v1, v2 int32) int32 {
+				return v1 + v2
+			})
+		case ir.Sub:
+			vm.Inst("sub", "%s = %s - %s", t.To, t.Left, t.Right)
+			vm.BinOp(t.To, t.Left, t.Right, func(v1, v2 int32) int32 {
+				return v1 - v2
+			})
+		case ir.Mul:
+			vm.Inst("mul", "%s = %s * %s", t.To, t.Left, t.Right)
+			vm.BinOp(t.To, t.Left, t.Right, func(v1, v2 int32) int32 {
+				return v1 * v2
+			})
+		case ir.Div:
+			// Go's division truncates towards zero like C0 does.
+			vm.Inst("div", "%s = %s / %s", t.To, t.Left, t.Right)
+			err = vm.DivOp(t.To, t.Left, t.Right, func(v1, v2 int32) int32 {
+				return v1 / v2
+			})
+		case ir.Mod:
+			vm.Inst("mod", "%s = %s %% %s", t.To, t.Left, t.Right)
+			err = vm.DivOp(t.To, t.Left, t.Right, func(v1, v2 int32) int32 {
+				return v1 % v2
+			})
+		case ir.ICmp:
+			vm.Inst("icmp", "%s = %s %s, %s", t.To, t.Left, t.Pred, t.Right)
+			vm.BinOp(t.To, t.Left, t.Right, func(v1, v2 int32) int32 {
+				if compare(t.Pred, v1, v2) {
+					return 1
+				}
+				return 0
+			})
+		case ir.Xor:
+			vm.Inst("xor", "%s = %s ^ %s", t.To, t.Left, t.Right)
+			vm.BinOp(t.To, t.Left, t.Right, func(v1, v2 int32) int32 {
+				return v1 ^ v2
+			})
+		case ir.FunCall:
+			vm.Inst("call", "%s", t.Callee)
+			args := make([]int32, len(t.Args))
+			for i, arg := range t.Args {
+				args[i] = vm.ExtractValue(arg)
+			}
+			var res int32
+			if res, err = vm.Call(t.Callee, args, verbose); err != nil {
+				// The callee has already described its fault.
+				return 0, err
+			}
+			vm.regs[*t.To] = res
+		case ir.Return:
+			vm.Inst("return", "%s", t.With)
+			if t.With != nil {
+				ret = vm.ExtractValue(t.With)
+			}
+			break run
+		case ir.Unreachable:
+			vm.Inst("unreachable", "%s", t.Reason)
+			err = ErrUnreachable
+		case ir.Label:
+			vm.Inst("label", "%s", t.Name)
+			pred, cur = cur, t.Name
+		case ir.Phi:
+			pc = vm.Phis(insts, pc-1, pred)
+		case ir.Jump:
+			vm.Inst("jump", "%s", t.To)
+			pc = targets[t.To]
+		case ir.JumpZero:
+			vm.Inst("jumpz", "%s, %s", t.Cond, t.To)
+			if vm.ExtractValue(t.Cond) == 0 {
+				pc = targets[t.To]
+			}
+		case ir.JumpNonZero:
+			vm.Inst("jumpnz", "%s, %s", t.Cond, t.To)
+			if vm.ExtractValue(t.Cond) != 0 {
+				pc = targets[t.To]
+			}
+		default:
+			panic(fmt.Sprintf("unknown instruction: %s", inst))
+		}
+		if err != nil {
+			return 0, &RuntimeError{Func: name, Inst: inst, Wrapped: err}
+		}
+		if verbose {
+			fmt.Println(vm.DumpMem())
+			fmt.Println(vm.DumpRegs())
+		}
+	}
+	return ret, nil
+}
+
+// Run calls the entry function without arguments. If there is no entry
+// function but only one function, that one is called instead.
+func (vm *VM) Run(verbose bool) (*int32, error) {
+	name := Entry
+	if _, ok := vm.funcs[name]; !ok && len(vm.funcs) == 1 {
+		for only := range vm.funcs {
+			name = only
+		}
+	}
+	ret, err := vm.Call(name, nil, verbose)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
@@ -0,0 +1,101 @@
+package vm_test
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/susji/c0/ir"
+	"github.com/susji/c0/ssa"
+	"github.com/susji/c0/ssa/vm"
+	"github.com/susji/c0/testers/assert"
+	"github.com/susji/c0/testers/require"
+)
+
+var typeInt = &ir.Type{Kind: ir.TYPE_INT32}
+
+func TestAddressOutOfRange(t *testing.T) {
+	addr := &ir.Variable{Count: 1}
+	val := &ir.Variable{Count: 2}
+	type entry struct {
+		name  string
+		addr  int32
+		inst  ir.Instruction
+		fault bool
+	}
+	table := []entry{
+		{"load", 0, ir.Load{Type: typeInt, From: addr, To: val}, false},
+		{"store", 0, ir.Store{Type: typeInt, From: val, To: addr}, false},
+		{"load negative", -1, ir.Load{Type: typeInt, From: addr, To: val}, true},
+		{"load past end", 1, ir.Load{Type: typeInt, From: addr, To: val}, true},
+		{"store negative", -1, ir.Store{Type: typeInt, From: val, To: addr}, true},
+		{"store past end", 100, ir.Store{Type: typeInt, From: val, To: addr}, true},
+	}
+	for _, e := range table {
+		t.Run(e.name, func(t *testing.T) {
+			slot := &ir.Variable{Name: "a", Count: 0}
+			s := &ssa.SSA{Instructions: []ir.Instruction{
+				ir.Alloca{Type: typeInt, Align: 4, To: slot},
+				ir.Mov{Type: typeInt, What: &ir.Numeric32i{Value: e.addr}, To: addr},
+				ir.Mov{Type: typeInt, What: &ir.Numeric32i{Value: 7}, To: val},
+				e.inst,
+				ir.Return{Type: typeInt, With: val},
+			}}
+			v := vm.New()
+			v.Insert("f", s)
+			ret, err := v.Run(false)
+			if !e.fault {
+				require.Nil(t, err)
+				assert.NotNil(t, ret)
+				return
+			}
+			require.NotNil(t, err)
+			t.Log(err)
+			assert.Nil(t, ret)
+			assert.True(t, errors.Is(err, vm.ErrAddressOutOfRange))
+			var rerr *vm.RuntimeError
+			require.True(t, errors.As(err, &rerr))
+			assert.Equal(t, "f", rerr.Func)
+			assert.Equal(t, e.inst, rerr.Inst)
+		})
+	}
+}
+
+func TestDivByZero(t *testing.T) {
+	to := &ir.Variable{Count: 1}
+	num := func(v int32) ir.Value { return &ir.Numeric32i{Value: v} }
+	type entry struct {
+		name  string
+		inst  ir.Instruction
+		fault bool
+	}
+	table := []entry{
+		{"div", ir.Div{Type: typeInt, To: to, Left: num(7), Right: num(2)}, false},
+		{"mod", ir.Mod{Type: typeInt, To: to, Left: num(7), Right: num(2)}, false},
+		{"div zero", ir.Div{Type: typeInt, To: to, Left: num(3), Right: num(0)}, true},
+		{"mod zero", ir.Mod{Type: typeInt, To: to, Left: num(3), Right: num(0)}, true},
+		{"div overflow", ir.Div{Type: typeInt, To: to, Left: num(math.MinInt32), Right: num(-1)}, true},
+		{"mod overflow", ir.Mod{Type: typeInt, To: to, Left: num(math.MinInt32), Right: num(-1)}, true},
+	}
+	for _, e := range table {
+		t.Run(e.name, func(t *testing.T) {
+			s := &ssa.SSA{Instructions: []ir.Instruction{
+				e.inst,
+				ir.Return{Type: typeInt, With: to},
+			}}
+			v := vm.New()
+			v.Insert("f", s)
+			_, err := v.Run(false)
+			if !e.fault {
+				require.Nil(t, err)
+				return
+			}
+			require.NotNil(t, err)
+			t.Log(err)
+			assert.True(t, errors.Is(err, vm.ErrDivByZero))
+			var rerr *vm.RuntimeError
+			require.True(t, errors.As(err, &rerr))
+			assert.Equal(t, e.inst, rerr.Inst)
+		})
+	}
+}
@@ -10,9 +10,14 @@ import (
 
 var EOT = errors.New("end of tokens")
 
-// Tokens implements a FIFO for individual tokens.
+// Tokens implements a FIFO for individual tokens. Popped tokens are kept
+// around so that we may return to an earlier position with Restore.
 type Tokens struct {
 	toks []Token
+	// pos is the index of the next token to pop
+	pos int
+	// prev is the latest token popped, not counting comments
+	prev *Token
 }
 
 type Token struct {
@@ -162,6 +167,16 @@ func (k Kind) String() string {
 	return toknames[k]
 }
 
+// KindFromString is the inverse of Kind.String.
+func KindFromString(name string) (Kind, error) {
+	for i, cur := range toknames {
+		if cur == name {
+			return Kind(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unrecognized token kind: %q", name)
+}
+
 func validkind(kind Kind) bool {
 	return kind >= 0 && int(kind) <= (len(toknames)-1)
 }
@@ -210,31 +225,65 @@ func (toks *Tokens) Add(tok Token) *Tokens {
 
 func (toks *Tokens) String() string {
 	b := &strings.Builder{}
-	for _, tok := range toks.toks {
+	for _, tok := range toks.toks[toks.pos:] {
 		b.WriteString(
 			fmt.Sprintf("[%d:%d] %s\n", tok.Lineno(), tok.Col(), tok.String()))
 	}
 	return b.String()
 }
 
+// Len returns the number of tokens left to pop.
 func (toks *Tokens) Len() int {
-	return len(toks.toks)
+	return len(toks.toks) - toks.pos
 }
 
 func (toks *Tokens) Pop() *Token {
 	if toks.Len() == 0 {
 		return nil
 	}
-	if toks.Len() == 1 {
-		tok := &toks.toks[0]
-		toks.toks = nil
-		return tok
+	tok := toks.toks[toks.pos]
+	toks.pos++
+	switch tok.Kind() {
+	case CommentOne, CommentMulti:
+	default:
+		toks.prev = &tok
 	}
-	var tok Token
-	tok, toks.toks = toks.toks[0], toks.toks[1:]
 	return &tok
 }
 
+// Prev returns the latest token popped. Comments skipped with Peek are not
+// counted.
+func (toks *Tokens) Prev() *Token {
+	return toks.prev
+}
+
+// Checkpoint returns the current position so that the tokens consumed after
+// it can be put back with Restore. This lets us speculatively parse something
+// and rewind if it turns out to be something else.
+func (toks *Tokens) Checkpoint() int {
+	return toks.pos
+}
+
+// Restore rewinds to a position returned by Checkpoint, including what Prev
+// returns. Comments Peek skipped after the checkpoint are restored too, and
+// Peek skips them again.
+func (toks *Tokens) Restore(pos int) {
+	if pos < 0 || pos > len(toks.toks) {
+		panic(fmt.Sprintf("restoring to invalid token position %d", pos))
+	}
+	toks.pos = pos
+	toks.prev = nil
+	for i := pos - 1; i >= 0; i-- {
+		switch toks.toks[i].Kind() {
+		case CommentOne, CommentMulti:
+			continue
+		}
+		tok := toks.toks[i]
+		toks.prev = &tok
+		break
+	}
+}
+
 // Peek returns the current token-to-be-parsed. It never returns comment
 // tokens.
 func (toks *Tokens) Peek() *Token {
@@ -243,23 +292,77 @@ nocoms:
 		if toks.Len() == 0 {
 			return nil
 		}
-		switch toks.toks[0].Kind() {
+		switch toks.toks[toks.pos].Kind() {
 		case CommentOne, CommentMulti:
 			toks.Pop()
 			continue nocoms
 		default:
-			return &toks.toks[0]
+			return &toks.toks[toks.pos]
 		}
 	}
 }
 
+// PeekNext returns the token after the one returned by Peek. Like Peek, it
+// skips comment tokens.
+func (toks *Tokens) PeekNext() *Token {
+	next := toks.PeekN(2)
+	if len(next) < 2 {
+		return nil
+	}
+	return next[1]
+}
+
+// PeekN returns up to n tokens starting from the one returned by Peek without
+// consuming any of them. Like Peek, it skips comment tokens.
+func (toks *Tokens) PeekN(n int) []*Token {
+	ret := []*Token{}
+	if toks.Peek() == nil {
+		return ret
+	}
+	for i := toks.pos; i < len(toks.toks) && len(ret) < n; i++ {
+		switch toks.toks[i].Kind() {
+		case CommentOne, CommentMulti:
+		default:
+			ret = append(ret, &toks.toks[i])
+		}
+	}
+	return ret
+}
+
+// Between returns the tokens which lie within the range from the beginning
+// of start to the end of end, regardless of whether they have been popped.
+// Comment tokens are left out. This is meant for showing the source around
+// an error.
+func (toks *Tokens) Between(start, end span.Span) []*Token {
+	ret := []*Token{}
+	for i := range toks.toks {
+		tok := &toks.toks[i]
+		switch tok.Kind() {
+		case CommentOne, CommentMulti:
+			continue
+		}
+		at := tok.Span()
+		if !notBefore(at.Lineno0, at.Col0, start.Lineno0, start.Col0) ||
+			!notBefore(end.Lineno, end.Col, at.Lineno, at.Col) {
+			continue
+		}
+		ret = append(ret, tok)
+	}
+	return ret
+}
+
+// notBefore tells if the position (lineno, col) is at or after (ln, c).
+func notBefore(lineno, col, ln, c int) bool {
+	return lineno > ln || (lineno == ln && col >= c)
+}
+
 // PeekAll returns the current token-to-be-parsed. Unlike Peek, it never
 // discriminates based on token kind.
 func (toks *Tokens) PeekAll() *Token {
 	if toks.Len() == 0 {
 		return nil
 	}
-	return &toks.toks[0]
+	return &toks.toks[toks.pos]
 }
 
 func (toks *Tokens) Accept(kind Kind) error {
@@ -275,11 +378,25 @@ func (toks *Tokens) Accept(kind Kind) error {
 	return nil
 }
 
+// Find consumes tokens until it meets one of the given kinds, which is
+// returned and left unconsumed. If there is no such token, the rest of the
+// tokens are consumed and nil is returned.
 func (toks *Tokens) Find(kinds ...Kind) *Token {
+	return toks.FindUntil(nil, kinds...)
+}
+
+// FindUntil is like Find, but it also stops at any token of the kinds in
+// stops. Such a token is not consumed either and nil is returned for it. This
+// keeps error recovery from swallowing what comes after a sync point.
+func (toks *Tokens) FindUntil(stops []Kind, kinds ...Kind) *Token {
 	find := map[Kind]struct{}{}
 	for _, kind := range kinds {
 		find[kind] = struct{}{}
 	}
+	stop := map[Kind]struct{}{}
+	for _, kind := range stops {
+		stop[kind] = struct{}{}
+	}
 	for {
 		cur := toks.Peek()
 		if cur == nil {
@@ -288,6 +405,9 @@ func (toks *Tokens) Find(kinds ...Kind) *Token {
 		if _, ok := find[cur.Kind()]; ok {
 			return cur
 		}
+		if _, ok := stop[cur.Kind()]; ok {
+			return nil
+		}
 		toks.Pop()
 	}
 }
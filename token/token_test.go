@@ -5,6 +5,7 @@ import (
 
 	"github.com/susji/c0/span"
 	"github.com/susji/c0/testers/assert"
+	"github.com/susji/c0/testers/require"
 	"github.com/susji/c0/token"
 )
 
@@ -49,3 +50,183 @@ func TestTokensFind(t *testing.T) {
 	assert.Equal(t, "7", fourth.Value())
 	assert.Equal(t, "0x123", fifth.Value())
 }
+
+func TestTokensFindAbsent(t *testing.T) {
+	tokens := func() *token.Tokens {
+		toks := &token.Tokens{}
+		toks.Add(token.New(token.DecNum, sp(), "1")).
+			Add(token.New(token.Plus, sp(), "+")).
+			Add(token.New(token.UseLibLit, sp(), "lib")).
+			Add(token.New(token.Id, sp(), "f")).
+			Add(token.New(token.Semicolon, sp(), ";"))
+		return toks
+	}
+
+	toks := tokens()
+	assert.Nil(t, toks.Find(token.RCurly))
+	assert.Equal(t, 0, toks.Len())
+
+	toks = tokens()
+	assert.Nil(t, toks.FindUntil([]token.Kind{token.UseLibLit}, token.RCurly))
+	assert.Equal(t, 3, toks.Len())
+	assert.Equal(t, token.Kind(token.UseLibLit), toks.Peek().Kind())
+
+	// Wanted kinds are preferred if they come first.
+	toks = tokens()
+	found := toks.FindUntil([]token.Kind{token.UseLibLit}, token.Plus)
+	assert.NotNil(t, found)
+	assert.Equal(t, "+", found.Value())
+	assert.Equal(t, 4, toks.Len())
+
+	// Without a stop in the way, we behave like Find.
+	toks = tokens()
+	found = toks.FindUntil([]token.Kind{token.RParen}, token.Semicolon)
+	assert.NotNil(t, found)
+	assert.Equal(t, 1, toks.Len())
+}
+
+func TestTokensCheckpoint(t *testing.T) {
+	toks := &token.Tokens{}
+	toks.Add(token.New(token.Id, sp(), "a")).
+		Add(token.New(token.CommentOne, sp(), "one")).
+		Add(token.New(token.Plus, sp(), "+")).
+		Add(token.New(token.CommentMulti, sp(), "two")).
+		Add(token.New(token.Id, sp(), "b"))
+	// Like the parser, we peek past the comments before popping.
+	next := func() string {
+		require.NotNil(t, toks.Peek())
+		return toks.Pop().Value()
+	}
+
+	start := toks.Checkpoint()
+	assert.Nil(t, toks.Prev())
+	assert.Equal(t, "a", next())
+	mid := toks.Checkpoint()
+	assert.Equal(t, "+", next())
+	assert.Equal(t, "b", next())
+	assert.Nil(t, toks.Peek())
+	assert.Nil(t, toks.Pop())
+	assert.Equal(t, 0, toks.Len())
+	assert.Equal(t, "b", toks.Prev().Value())
+
+	// The comment skipped by Peek comes back but is skipped again.
+	toks.Restore(mid)
+	assert.Equal(t, "a", toks.Prev().Value())
+	assert.Equal(t, 4, toks.Len())
+	assert.Equal(t, token.Kind(token.CommentOne), toks.PeekAll().Kind())
+	assert.Equal(t, "+", toks.Peek().Value())
+	assert.Equal(t, "b", toks.PeekNext().Value())
+	// Prev does not count the comment before the checkpoint.
+	toks.Restore(toks.Checkpoint())
+	assert.Equal(t, "a", toks.Prev().Value())
+
+	toks.Restore(start)
+	assert.Nil(t, toks.Prev())
+	assert.Equal(t, 5, toks.Len())
+	assert.Equal(t, "a", next())
+	assert.Nil(t, toks.Accept(token.Plus))
+	assert.Equal(t, "b", next())
+
+	// A checkpoint may be restored to more than once, and tokens added
+	// after it are kept.
+	toks.Add(token.New(token.Semicolon, sp(), ";"))
+	toks.Restore(mid)
+	toks.Restore(mid)
+	assert.Equal(t, "+", next())
+	assert.Equal(t, "b", next())
+	assert.Equal(t, token.Kind(token.Semicolon), toks.Pop().Kind())
+	assert.Equal(t, 0, toks.Len())
+}
+
+func TestTokensRestoreInvalid(t *testing.T) {
+	toks := &token.Tokens{}
+	toks.Add(token.New(token.Id, sp(), "a"))
+	for _, pos := range []int{-1, 2} {
+		func() {
+			defer func() {
+				assert.NotNil(t, recover())
+			}()
+			toks.Restore(pos)
+		}()
+	}
+	toks.Restore(1)
+	assert.Equal(t, 0, toks.Len())
+	assert.Equal(t, "a", toks.Prev().Value())
+}
+
+func values(toks []*token.Token) []string {
+	ret := []string{}
+	for _, tok := range toks {
+		ret = append(ret, tok.Value())
+	}
+	return ret
+}
+
+func TestTokensPeekN(t *testing.T) {
+	toks := &token.Tokens{}
+	toks.Add(token.New(token.CommentOne, sp(), "zero")).
+		Add(token.New(token.Id, sp(), "a")).
+		Add(token.New(token.CommentOne, sp(), "one")).
+		Add(token.New(token.Plus, sp(), "+")).
+		Add(token.New(token.CommentMulti, sp(), "two")).
+		Add(token.New(token.Id, sp(), "b"))
+
+	assert.Equal(t, []string{}, values(toks.PeekN(0)))
+	assert.Equal(t, []string{"a", "+"}, values(toks.PeekN(2)))
+	assert.Equal(t, []string{"a", "+", "b"}, values(toks.PeekN(10)))
+	// Nothing was consumed except the leading comment, which Peek also
+	// skips.
+	assert.Equal(t, "a", toks.Peek().Value())
+	assert.Equal(t, 5, toks.Len())
+
+	toks.Pop()
+	assert.Equal(t, []string{"+"}, values(toks.PeekN(1)))
+	toks.Peek()
+	toks.Pop()
+	toks.Peek()
+	toks.Pop()
+	assert.Equal(t, []string{}, values(toks.PeekN(3)))
+}
+
+func TestTokensBetween(t *testing.T) {
+	at := func(lineno, col, length int) span.Span {
+		return span.Span{Lineno0: lineno, Col0: col, Lineno: lineno, Col: col + length}
+	}
+	toks := &token.Tokens{}
+	// int a = b + 1; // one
+	// return a;
+	toks.Add(token.New(token.Id, at(1, 1, 3), "int")).
+		Add(token.New(token.Id, at(1, 5, 1), "a")).
+		Add(token.New(token.Assign, at(1, 7, 1), "=")).
+		Add(token.New(token.Id, at(1, 9, 1), "b")).
+		Add(token.New(token.Plus, at(1, 11, 1), "+")).
+		Add(token.New(token.DecNum, at(1, 13, 1), "1")).
+		Add(token.New(token.Semicolon, at(1, 14, 1), ";")).
+		Add(token.New(token.CommentOne, at(1, 16, 6), "one")).
+		Add(token.New(token.Id, at(2, 1, 6), "return")).
+		Add(token.New(token.Id, at(2, 8, 1), "a")).
+		Add(token.New(token.Semicolon, at(2, 9, 1), ";"))
+
+	type entry struct {
+		start, end span.Span
+		want       []string
+	}
+	table := []entry{
+		{at(1, 9, 1), at(1, 13, 1), []string{"b", "+", "1"}},
+		{at(1, 5, 1), at(1, 5, 1), []string{"a"}},
+		{at(1, 14, 1), at(2, 8, 1), []string{";", "return", "a"}},
+		// Tokens only partly within the range are left out.
+		{at(1, 2, 1), at(1, 9, 2), []string{"a", "=", "b"}},
+		{at(3, 1, 1), at(3, 5, 1), []string{}},
+	}
+	for _, cur := range table {
+		assert.Equal(t, cur.want, values(toks.Between(cur.start, cur.end)))
+	}
+
+	// Popped tokens are still there.
+	for toks.Peek() != nil {
+		toks.Pop()
+	}
+	assert.Equal(t, []string{"return", "a", ";"},
+		values(toks.Between(at(2, 1, 1), at(2, 9, 1))))
+}
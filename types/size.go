@@ -0,0 +1,61 @@
+package types
+
+// These are the sizes, in bytes, we assume for a 64-bit target. Strings,
+// pointers, and arrays are all references to memory elsewhere.
+const (
+	SIZE_INT       = 4
+	SIZE_BOOL      = 1
+	SIZE_CHAR      = 1
+	SIZE_REFERENCE = 8
+)
+
+func alignUp(offset, align int) int {
+	return (offset + align - 1) / align * align
+}
+
+// SizeAlign returns the size and alignment of a value of the type. The last
+// return value is false if the size is not known, which is the case with void,
+// forward-declared structs, functions, and NULL.
+func (k *Type) SizeAlign() (size, align int, ok bool) {
+	if k.PointerLevel > 0 || k.ArrayLevel > 0 {
+		return SIZE_REFERENCE, SIZE_REFERENCE, true
+	}
+	switch k.Type {
+	case TYPE_INT:
+		return SIZE_INT, SIZE_INT, true
+	case TYPE_BOOL:
+		return SIZE_BOOL, SIZE_BOOL, true
+	case TYPE_CHAR:
+		return SIZE_CHAR, SIZE_CHAR, true
+	case TYPE_STRING:
+		return SIZE_REFERENCE, SIZE_REFERENCE, true
+	case TYPE_STRUCT:
+		return k.Extra.(*Struct).SizeAlign()
+	}
+	return 0, 0, false
+}
+
+// Size returns the size of a value of the type, see SizeAlign.
+func (k *Type) Size() (int, bool) {
+	size, _, ok := k.SizeAlign()
+	return size, ok
+}
+
+// SizeAlign returns the size and alignment of the struct. Like in C, each
+// field is placed at the next offset suitable for its alignment, and the
+// size is padded to a multiple of the largest field alignment.
+func (s *Struct) SizeAlign() (size, align int, ok bool) {
+	offset := 0
+	align = 1
+	for _, f := range s.Fields {
+		fsize, falign, ok := f.Type.SizeAlign()
+		if !ok {
+			return 0, 0, false
+		}
+		offset = alignUp(offset, falign) + fsize
+		if falign > align {
+			align = falign
+		}
+	}
+	return alignUp(offset, align), align, true
+}
@@ -292,3 +292,4 @@ func (t *Type) DecArray() {
 func (ie *Function) IsExtra()      {}
 func (ie *Struct) IsExtra()        {}
 func (ie *StructForward) IsExtra() {}
+func (ie *Typedef) IsExtra()       {}